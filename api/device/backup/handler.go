@@ -1,6 +1,7 @@
 package backup
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"netops/libs"
@@ -39,3 +40,39 @@ func (h *Handler) Download(ctx *gin.Context) {
 	ctx.Header("response-type", "blob")
 	ctx.Data(http.StatusOK, "application/zip", result)
 }
+
+// Diff 对比同一设备的两次备份
+func (h *Handler) Diff(ctx *gin.Context) {
+	params := struct {
+		OldId int `form:"old_id" binding:"required"`
+		NewId int `form:"new_id" binding:"required"`
+	}{}
+	if e := ctx.ShouldBindQuery(&params); e != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("参数解析失败, err: %s", e.Error()))
+		return
+	}
+	result, e := device.DiffBackup(params.OldId, params.NewId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "ok")
+}
+
+// DiffPrevious 对比设备最新备份与上一次备份
+func (h *Handler) DiffPrevious(ctx *gin.Context) {
+	params := struct {
+		DeviceId   int    `form:"device_id" binding:"required"`
+		DeviceType string `form:"device_type"` // firewall nlb, 默认firewall
+	}{}
+	if e := ctx.ShouldBindQuery(&params); e != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("参数解析失败, err: %s", e.Error()))
+		return
+	}
+	result, e := device.DiffBackupPrevious(params.DeviceType, params.DeviceId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "ok")
+}
@@ -7,4 +7,6 @@ import (
 func Routers(e *gin.RouterGroup) {
 	e.GET("/device/backups", handler.List)
 	e.GET("/device/backup/download", handler.Download)
+	e.GET("/device/backup/diff", handler.Diff)
+	e.GET("/device/backup/diff_previous", handler.DiffPrevious)
 }
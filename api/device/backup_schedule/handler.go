@@ -0,0 +1,64 @@
+package backup_schedule
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"netops/libs"
+	"netops/model"
+	"netops/pkg/schedule"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TBackupSchedule)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TBackupSchedule{}
+	}
+}
+
+// 修改定时备份配置后重新加载定时任务
+func (h *Handler) reload() {
+	if e := schedule.ReloadBackup(); e != nil {
+		zap.L().Error("重新加载定时备份任务失败", zap.Error(e))
+	}
+}
+
+func (h *Handler) Create(ctx *gin.Context) {
+	h.Controller.Create(ctx)
+	h.reload()
+}
+func (h *Handler) Update(ctx *gin.Context) {
+	h.Controller.Update(ctx)
+	h.reload()
+}
+func (h *Handler) Delete(ctx *gin.Context) {
+	h.Controller.Delete(ctx)
+	h.reload()
+}
+
+// Run 立即执行一次定时备份
+func (h *Handler) Run(ctx *gin.Context) {
+	params := struct {
+		ScheduleId int `json:"schedule_id"`
+	}{}
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	libs.AddLog(ctx, fmt.Sprintf("执行定时备份<%d>", params.ScheduleId))
+	go func() {
+		if _, e := schedule.RunBackup(params.ScheduleId); e != nil {
+			zap.L().Error("执行定时备份失败", zap.Int("schedule_id", params.ScheduleId), zap.Error(e))
+		}
+	}()
+	libs.HttpSuccess(ctx, nil, "备份执行中...")
+}
@@ -0,0 +1,15 @@
+package backup_schedule
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/device/backup_schedules", handler.List)
+	e.GET("/device/backup_schedule", handler.Get)
+	e.POST("/device/backup_schedule", handler.Create)
+	e.PUT("/device/backup_schedule", handler.Update)
+	e.DELETE("/device/backup_schedule", handler.Delete)
+	e.POST("/device/backup_schedule/run", handler.Run)
+	e.GET("/device/backup_runs", runHandler.List)
+}
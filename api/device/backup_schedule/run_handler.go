@@ -0,0 +1,18 @@
+package backup_schedule
+
+import (
+	"netops/libs"
+	"netops/model"
+)
+
+var runHandler *Handler
+
+func init() {
+	runHandler = &Handler{}
+	runHandler.NewInstance = func() libs.Instance {
+		return new(model.TBackupRun)
+	}
+	runHandler.NewResults = func() any {
+		return &[]*model.TBackupRun{}
+	}
+}
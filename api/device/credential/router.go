@@ -0,0 +1,13 @@
+package credential
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/device/credentials", handler.List)
+	e.GET("/device/credential", handler.Get)
+	e.POST("/device/credential", handler.Create)
+	e.PUT("/device/credential", handler.Update)
+	e.DELETE("/device/credential", handler.Delete)
+}
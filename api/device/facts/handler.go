@@ -0,0 +1,51 @@
+package facts
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"netops/libs"
+	"netops/pkg/device"
+	"netops/pkg/schedule"
+)
+
+type Handler struct{}
+
+var handler = &Handler{}
+
+// List 查询设备资产信息，支持按厂商、型号、HA角色和版本范围过滤
+func (h *Handler) List(ctx *gin.Context) {
+	params := new(device.FactsQuery)
+	if err := ctx.ShouldBindQuery(params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	results, e := device.FindFacts(params)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpListSuccess(ctx, results, int64(len(results)))
+}
+
+// Collect 立即采集资产信息，未指定设备时后台采集所有设备
+func (h *Handler) Collect(ctx *gin.Context) {
+	params := struct {
+		DeviceId int `json:"device_id"`
+	}{}
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	if params.DeviceId == 0 {
+		libs.AddLog(ctx, "采集所有设备资产信息")
+		go schedule.RunFactsCollect()
+		libs.HttpSuccess(ctx, nil, "采集中...")
+		return
+	}
+	result, e := device.CollectFacts(params.DeviceId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "采集完成")
+}
@@ -0,0 +1,10 @@
+package facts
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/device/facts", handler.List)
+	e.POST("/device/facts/collect", handler.Collect)
+}
@@ -3,9 +3,13 @@ package firewall
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"netops/conf"
+	"netops/database"
 	"netops/libs"
 	"netops/model"
 	"netops/pkg/device"
+	"strconv"
+	"time"
 )
 
 type Handler struct {
@@ -44,6 +48,33 @@ func (h *Handler) Policy(ctx *gin.Context) {
 	libs.HttpSuccess(ctx, nil, "策略解析中...")
 	return
 }
+
+// Offline 上传离线配置解析策略，文件名为命令id(如1.log)时按命令输出处理，否则视为完整配置
+func (h *Handler) Offline(ctx *gin.Context) {
+	deviceId, err := strconv.Atoi(ctx.PostForm("device_id"))
+	if err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("设备ID异常: <%s>", err.Error()))
+		return
+	}
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("接收文件异常: <%s>", err.Error()))
+		return
+	}
+	config, err := device.NewOfflineConfigFromFiles(form.File["files"])
+	if err != nil {
+		libs.HttpParamsError(ctx, err.Error())
+		return
+	}
+	parser, err := device.NewDeviceHandler(deviceId)
+	if err != nil {
+		libs.HttpServerError(ctx, err.Error())
+		return
+	}
+	parser.SetOffline(config)
+	go parser.ParseConfig()
+	libs.HttpSuccess(ctx, nil, "策略解析中...")
+}
 func (h *Handler) PolicyLog(ctx *gin.Context) {
 	id, e := h.GetId(ctx)
 	if e != nil {
@@ -75,3 +106,36 @@ func (h *Handler) Backup(ctx *gin.Context) {
 	}
 	libs.HttpSuccess(ctx, nil, "备份成功")
 }
+
+// Health 立即检查设备的连通性和登录状态
+func (h *Handler) Health(ctx *gin.Context) {
+	params := new(operateParams)
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("接收参数异常: <%s>", err.Error()))
+		return
+	}
+	result, e := device.CheckHealth(params.DeviceId, time.Minute)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "检查完成")
+}
+
+// HealthHistory 设备最近的健康检查记录
+func (h *Handler) HealthHistory(ctx *gin.Context) {
+	id, e := h.GetId(ctx)
+	if e != nil {
+		libs.HttpParamsError(ctx, e.Error())
+		return
+	}
+	page, size := h.GetPagination(ctx)
+	var total int64
+	results := make([]*model.TDeviceHealth, 0)
+	db := database.DB.Model(&model.TDeviceHealth{}).Where("device_id = ? and device_type = ?", id, conf.DeviceTypeFirewall).Count(&total)
+	if e := db.Order("id desc").Scopes(libs.Pagination(page, size)).Find(&results).Error; e != nil {
+		libs.HttpServerError(ctx, fmt.Sprintf("获取健康检查记录失败, err: %s", e.Error()))
+		return
+	}
+	libs.HttpListSuccess(ctx, results, total)
+}
@@ -11,6 +11,9 @@ func Routers(e *gin.RouterGroup) {
 	e.PUT("/device/firewall", handler.Update)
 	e.DELETE("/device/firewall", handler.Delete)
 	e.POST("/device/firewall/policy", handler.Policy)
+	e.POST("/device/firewall/offline", handler.Offline)
 	e.GET("/device/firewall/policy_log", handler.PolicyLog)
 	e.POST("/device/firewall/backup", handler.Backup)
+	e.POST("/device/firewall/health", handler.Health)
+	e.GET("/device/firewall/health_history", handler.HealthHistory)
 }
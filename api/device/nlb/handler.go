@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"netops/conf"
+	"netops/database"
 	"netops/libs"
 	"netops/model"
 	"netops/pkg/device"
+	"strconv"
+	"time"
 )
 
 type Handler struct {
@@ -45,6 +49,84 @@ func (h *Handler) Policy(ctx *gin.Context) {
 	return
 }
 
+// Offline 上传F5接口json解析策略，文件名为接口路径，如pool.json、virtual.json、pool_<name>_members.json
+func (h *Handler) Offline(ctx *gin.Context) {
+	deviceId, err := strconv.Atoi(ctx.PostForm("device_id"))
+	if err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("设备ID异常: <%s>", err.Error()))
+		return
+	}
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("接收文件异常: <%s>", err.Error()))
+		return
+	}
+	config, err := device.NewOfflineConfigFromFiles(form.File["files"])
+	if err != nil {
+		libs.HttpParamsError(ctx, err.Error())
+		return
+	}
+	parser := device.NewF5Policy(deviceId)
+	if e := parser.Error(); e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	go parser.ParseOffline(config)
+	libs.HttpSuccess(ctx, nil, "策略解析中...")
+}
+
+// Backup 导出F5的LTM配置备份
+func (h *Handler) Backup(ctx *gin.Context) {
+	params := &struct {
+		DeviceId int `json:"device_id" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("接收参数异常: <%s>", err.Error()))
+		return
+	}
+	parser := device.NewF5Policy(params.DeviceId)
+	if e := parser.Backup(); e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, nil, "备份成功")
+}
+
+// Health 立即检查负载设备的连通性和登录状态
+func (h *Handler) Health(ctx *gin.Context) {
+	params := &struct {
+		DeviceId int `json:"device_id" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("接收参数异常: <%s>", err.Error()))
+		return
+	}
+	result, e := device.CheckNlbHealth(params.DeviceId, time.Minute)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "检查完成")
+}
+
+// HealthHistory 负载设备最近的健康检查记录
+func (h *Handler) HealthHistory(ctx *gin.Context) {
+	id, e := h.GetId(ctx)
+	if e != nil {
+		libs.HttpParamsError(ctx, e.Error())
+		return
+	}
+	page, size := h.GetPagination(ctx)
+	var total int64
+	results := make([]*model.TDeviceHealth, 0)
+	db := database.DB.Model(&model.TDeviceHealth{}).Where("device_id = ? and device_type = ?", id, conf.DeviceTypeNlb).Count(&total)
+	if e := db.Order("id desc").Scopes(libs.Pagination(page, size)).Find(&results).Error; e != nil {
+		libs.HttpServerError(ctx, fmt.Sprintf("获取健康检查记录失败, err: %s", e.Error()))
+		return
+	}
+	libs.HttpListSuccess(ctx, results, total)
+}
+
 func (h *Handler) PolicyLog(ctx *gin.Context) {
 	id, e := h.GetId(ctx)
 	if e != nil {
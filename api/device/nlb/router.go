@@ -11,5 +11,9 @@ func Routers(e *gin.RouterGroup) {
 	e.PUT("/device/nlb", handler.Update)
 	e.DELETE("/device/nlb", handler.Delete)
 	e.POST("/device/nlb/policy", handler.Policy)
+	e.POST("/device/nlb/offline", handler.Offline)
+	e.POST("/device/nlb/backup", handler.Backup)
+	e.POST("/device/nlb/health", handler.Health)
+	e.GET("/device/nlb/health_history", handler.HealthHistory)
 	e.GET("/device/nlb/policy_log", handler.PolicyLog)
 }
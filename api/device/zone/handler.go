@@ -0,0 +1,22 @@
+package zone
+
+import (
+	"netops/libs"
+	"netops/model"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TDeviceZone)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TDeviceZone{}
+	}
+}
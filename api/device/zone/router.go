@@ -0,0 +1,13 @@
+package zone
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/device/zones", handler.List)
+	e.GET("/device/zone", handler.Get)
+	e.POST("/device/zone", handler.Create)
+	e.PUT("/device/zone", handler.Update)
+	e.DELETE("/device/zone", handler.Delete)
+}
@@ -0,0 +1,42 @@
+package drift_finding
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"netops/libs"
+	"netops/model"
+	"netops/pkg/device"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TDriftFinding)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TDriftFinding{}
+	}
+}
+
+// Detect 重新检查设备配置漂移，解析配置后也会自动检查
+func (h *Handler) Detect(ctx *gin.Context) {
+	params := struct {
+		DeviceId int `json:"device_id" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	count, e := device.DetectDrift(params.DeviceId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, count, "检查完成, 未解决的漂移%d个", count)
+}
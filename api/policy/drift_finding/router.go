@@ -0,0 +1,11 @@
+package drift_finding
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/drift_findings", handler.List)
+	e.GET("/policy/drift_finding", handler.Get)
+	e.POST("/policy/drift_finding/detect", handler.Detect)
+}
@@ -1,10 +1,12 @@
 package firewall
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"netops/libs"
 	"netops/pkg/policy"
+	"netops/pkg/task"
 )
 
 type Handler struct {
@@ -37,3 +39,18 @@ func (h *Handler) List(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, libs.ListSuccess(result, total))
 }
+
+// Explain 说明访问流量经过的设备、方向、每条候选策略的匹配结果和nat转换
+func (h *Handler) Explain(ctx *gin.Context) {
+	params := task.ExplainParams{}
+	if e := ctx.ShouldBindQuery(&params); e != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("参数解析失败, err: %s", e.Error()))
+		return
+	}
+	result, e := task.ExplainFlow(&params)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "ok")
+}
@@ -6,4 +6,5 @@ import (
 
 func Routers(e *gin.RouterGroup) {
 	e.GET("/policy/firewall", handler.List)
+	e.GET("/policy/firewall/explain", handler.Explain)
 }
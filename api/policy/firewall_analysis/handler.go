@@ -0,0 +1,82 @@
+package firewall_analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"netops/libs"
+	"netops/pkg/device"
+	"netops/utils"
+)
+
+type analyzeParams struct {
+	DeviceId int `form:"device_id" binding:"required"`
+}
+
+func analyze(ctx *gin.Context) (*device.PolicyAnalysis, bool) {
+	params := analyzeParams{}
+	if e := ctx.ShouldBindQuery(&params); e != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("参数解析失败, err: %s", e.Error()))
+		return nil, false
+	}
+	result, e := device.AnalyzePolicy(params.DeviceId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return nil, false
+	}
+	return result, true
+}
+
+// Analyze 分析设备中被覆盖、冗余和可合并的策略
+func Analyze(ctx *gin.Context) {
+	result, ok := analyze(ctx)
+	if !ok {
+		return
+	}
+	libs.HttpSuccess(ctx, result, "ok")
+}
+
+// Export 导出策略分析结果
+func Export(ctx *gin.Context) {
+	result, ok := analyze(ctx)
+	if !ok {
+		return
+	}
+	maps := make([]map[string]interface{}, 0)
+	bs, _ := json.Marshal(&result.Findings)
+	if e := json.Unmarshal(bs, &maps); e != nil {
+		libs.HttpServerError(ctx, fmt.Sprintf("转换结果异常: <%s>", e.Error()))
+		return
+	}
+	titles := []map[string]string{
+		{"title": "类型", "key": "type"},
+		{"title": "方向", "key": "direction"},
+		{"title": "策略名称", "key": "name"},
+		{"title": "行号", "key": "line"},
+		{"title": "动作", "key": "action"},
+		{"title": "覆盖策略", "key": "cover_name"},
+		{"title": "覆盖策略行号", "key": "cover_line"},
+		{"title": "覆盖策略动作", "key": "cover_action"},
+		{"title": "合并维度", "key": "field"},
+		{"title": "说明", "key": "description"},
+	}
+	xlsx := utils.Xlsx{}
+	buffers := xlsx.NewFileToBuffer(titles, maps)
+	if e := xlsx.Error(); e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	ctx.Header("response-type", "blob")
+	ctx.Data(http.StatusOK, "application/vnd.ms-excel", buffers.Bytes())
+}
+
+// Commands 下载清理被覆盖和冗余策略的命令
+func Commands(ctx *gin.Context) {
+	result, ok := analyze(ctx)
+	if !ok {
+		return
+	}
+	ctx.Header("response-type", "blob")
+	ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(result.Commands))
+}
@@ -0,0 +1,11 @@
+package firewall_analysis
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/firewall_analysis", Analyze)
+	e.GET("/policy/firewall_analysis/export", Export)
+	e.GET("/policy/firewall_analysis/commands", Commands)
+}
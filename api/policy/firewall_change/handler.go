@@ -0,0 +1,22 @@
+package firewall_change
+
+import (
+	"netops/libs"
+	"netops/model"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TDevicePolicyChange)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TDevicePolicyChange{}
+	}
+}
@@ -0,0 +1,10 @@
+package firewall_change
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/firewall_changes", handler.List)
+	e.GET("/policy/firewall_change", handler.Get)
+}
@@ -0,0 +1,84 @@
+package firewall_decommission
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"netops/libs"
+	"netops/model"
+	"netops/pkg/task"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TPolicyDecommission)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TPolicyDecommission{}
+	}
+}
+
+// List 查询前根据工单执行结果更新下线状态
+func (h *Handler) List(ctx *gin.Context) {
+	if e := task.RefreshDecommissions(); e != nil {
+		zap.L().Error("更新策略下线状态失败", zap.Error(e))
+	}
+	h.Controller.List(ctx)
+}
+
+// Disable 选择策略创建下线记录和禁用策略的工单
+func (h *Handler) Disable(ctx *gin.Context) {
+	params := new(task.DecommissionParams)
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	result, e := task.AddDecommission(params, ctx.GetString("Operator"))
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "禁用工单创建成功")
+}
+
+type stageParams struct {
+	Ids     []int  `json:"ids" binding:"required"`
+	JiraKey string `json:"jira_key" binding:"required"`
+}
+
+// Delete 观察期结束后创建删除策略的工单
+func (h *Handler) Delete(ctx *gin.Context) {
+	params := new(stageParams)
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	result, e := task.AddDecommissionDeleteTask(params.Ids, params.JiraKey, ctx.GetString("Operator"))
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "删除工单创建成功")
+}
+
+// Reactivate 观察期内创建重新启用策略的工单
+func (h *Handler) Reactivate(ctx *gin.Context) {
+	params := new(stageParams)
+	if err := ctx.ShouldBindJSON(params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	result, e := task.AddDecommissionReactivateTask(params.Ids, params.JiraKey, ctx.GetString("Operator"))
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "重新启用工单创建成功")
+}
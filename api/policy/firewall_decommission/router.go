@@ -0,0 +1,13 @@
+package firewall_decommission
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/firewall_decommissions", handler.List)
+	e.GET("/policy/firewall_decommission", handler.Get)
+	e.POST("/policy/firewall_decommission/disable", handler.Disable)
+	e.POST("/policy/firewall_decommission/delete", handler.Delete)
+	e.POST("/policy/firewall_decommission/reactivate", handler.Reactivate)
+}
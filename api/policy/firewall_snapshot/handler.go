@@ -0,0 +1,83 @@
+package firewall_snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"netops/libs"
+	"netops/model"
+	"netops/pkg/device"
+	"netops/utils"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TDeviceSnapshot)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TDeviceSnapshot{}
+	}
+}
+
+type diffParams struct {
+	OldId int `form:"old_id" binding:"required"`
+	NewId int `form:"new_id" binding:"required"`
+}
+
+// Diff 对比两个快照
+func (h *Handler) Diff(ctx *gin.Context) {
+	params := diffParams{}
+	if e := ctx.ShouldBindQuery(&params); e != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("参数解析失败, err: %s", e.Error()))
+		return
+	}
+	result, e := device.DiffSnapshot(params.OldId, params.NewId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "ok")
+}
+
+// DiffExport 导出快照差异
+func (h *Handler) DiffExport(ctx *gin.Context) {
+	params := diffParams{}
+	if e := ctx.ShouldBindQuery(&params); e != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("参数解析失败, err: %s", e.Error()))
+		return
+	}
+	result, e := device.DiffSnapshot(params.OldId, params.NewId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	maps := make([]map[string]interface{}, 0)
+	bs, _ := json.Marshal(&result)
+	if e := json.Unmarshal(bs, &maps); e != nil {
+		libs.HttpServerError(ctx, fmt.Sprintf("转换结果异常: <%s>", e.Error()))
+		return
+	}
+	titles := []map[string]string{
+		{"title": "对象类型", "key": "object_type"},
+		{"title": "对象", "key": "object_key"},
+		{"title": "变更类型", "key": "change_type"},
+		{"title": "变更前", "key": "old"},
+		{"title": "变更后", "key": "new"},
+	}
+	xlsx := utils.Xlsx{}
+	buffers := xlsx.NewFileToBuffer(titles, maps)
+	if e := xlsx.Error(); e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	ctx.Header("response-type", "blob")
+	ctx.Data(http.StatusOK, "application/vnd.ms-excel", buffers.Bytes())
+}
@@ -0,0 +1,11 @@
+package firewall_snapshot
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/firewall_snapshots", handler.List)
+	e.GET("/policy/firewall_snapshot/diff", handler.Diff)
+	e.GET("/policy/firewall_snapshot/diff_export", handler.DiffExport)
+}
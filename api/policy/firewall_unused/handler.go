@@ -0,0 +1,87 @@
+package firewall_unused
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"netops/libs"
+	"netops/pkg/device"
+	"netops/pkg/task"
+	"netops/utils"
+)
+
+type unusedParams struct {
+	DeviceId int `form:"device_id" binding:"required"`
+}
+
+func unused(ctx *gin.Context) (*device.UnusedReport, bool) {
+	params := unusedParams{}
+	if e := ctx.ShouldBindQuery(&params); e != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("参数解析失败, err: %s", e.Error()))
+		return nil, false
+	}
+	result, e := device.FindUnusedObjects(params.DeviceId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return nil, false
+	}
+	return result, true
+}
+
+// Unused 获取设备未被引用的地址组和端口及清理命令
+func Unused(ctx *gin.Context) {
+	result, ok := unused(ctx)
+	if !ok {
+		return
+	}
+	libs.HttpSuccess(ctx, result, "ok")
+}
+
+// Export 导出设备未被引用的对象
+func Export(ctx *gin.Context) {
+	result, ok := unused(ctx)
+	if !ok {
+		return
+	}
+	maps := make([]map[string]interface{}, 0)
+	bs, _ := json.Marshal(&result.Objects)
+	if e := json.Unmarshal(bs, &maps); e != nil {
+		libs.HttpServerError(ctx, fmt.Sprintf("转换结果异常: <%s>", e.Error()))
+		return
+	}
+	titles := []map[string]string{
+		{"title": "对象类型", "key": "object_type"},
+		{"title": "名称", "key": "name"},
+		{"title": "zone", "key": "zone"},
+		{"title": "地址类型", "key": "address_type"},
+		{"title": "内容", "key": "content"},
+		{"title": "删除命令", "key": "command"},
+	}
+	xlsx := utils.Xlsx{}
+	buffers := xlsx.NewFileToBuffer(titles, maps)
+	if e := xlsx.Error(); e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	ctx.Header("response-type", "blob")
+	ctx.Data(http.StatusOK, "application/vnd.ms-excel", buffers.Bytes())
+}
+
+// AddTask 创建清理工单，审核通过后执行
+func AddTask(ctx *gin.Context) {
+	params := struct {
+		DeviceId int    `json:"device_id" binding:"required"`
+		JiraKey  string `json:"jira_key" binding:"required"`
+	}{}
+	if e := ctx.ShouldBindJSON(&params); e != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("参数解析失败, err: %s", e.Error()))
+		return
+	}
+	result, e := task.AddCleanupTask(params.DeviceId, params.JiraKey, ctx.GetString("Operator"))
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, result, "清理工单创建成功")
+}
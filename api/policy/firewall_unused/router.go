@@ -0,0 +1,11 @@
+package firewall_unused
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/firewall_unused", Unused)
+	e.GET("/policy/firewall_unused/export", Export)
+	e.POST("/policy/firewall_unused/task", AddTask)
+}
@@ -0,0 +1,45 @@
+package risk_exception
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"netops/libs"
+	"netops/model"
+	"netops/pkg/device"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TRiskException)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TRiskException{}
+	}
+}
+
+// 修改例外后重新计算风险状态
+func (h *Handler) refresh() {
+	if e := device.RefreshRiskExceptions(); e != nil {
+		zap.L().Error("刷新风险例外状态失败", zap.Error(e))
+	}
+}
+
+func (h *Handler) Create(ctx *gin.Context) {
+	h.Controller.Create(ctx)
+	h.refresh()
+}
+func (h *Handler) Update(ctx *gin.Context) {
+	h.Controller.Update(ctx)
+	h.refresh()
+}
+func (h *Handler) Delete(ctx *gin.Context) {
+	h.Controller.Delete(ctx)
+	h.refresh()
+}
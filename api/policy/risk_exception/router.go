@@ -0,0 +1,13 @@
+package risk_exception
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/risk_exceptions", handler.List)
+	e.GET("/policy/risk_exception", handler.Get)
+	e.POST("/policy/risk_exception", handler.Create)
+	e.PUT("/policy/risk_exception", handler.Update)
+	e.DELETE("/policy/risk_exception", handler.Delete)
+}
@@ -0,0 +1,65 @@
+package risk_finding
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"netops/libs"
+	"netops/model"
+	"netops/pkg/device"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TRiskFinding)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TRiskFinding{}
+	}
+}
+
+// Ack 确认风险
+func (h *Handler) Ack(ctx *gin.Context) {
+	params := struct {
+		Ids     []int  `json:"ids" binding:"required"`
+		Comment string `json:"comment"`
+	}{}
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	user, e := libs.GetUser(ctx)
+	if e != nil {
+		libs.HttpAuthorError(ctx, e.Error())
+		return
+	}
+	if e := device.AckRisk(params.Ids, user.NameCn, params.Comment); e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.AddLog(ctx, "确认风险<%v>", params.Ids)
+	libs.HttpSuccess(ctx, nil, "确认成功")
+}
+
+// Evaluate 重新检查设备策略风险
+func (h *Handler) Evaluate(ctx *gin.Context) {
+	params := struct {
+		DeviceId int `json:"device_id" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		libs.HttpParamsError(ctx, fmt.Sprintf("解析参数异常: <%s>", err.Error()))
+		return
+	}
+	count, e := device.EvaluateRisk(params.DeviceId)
+	if e != nil {
+		libs.HttpServerError(ctx, e.Error())
+		return
+	}
+	libs.HttpSuccess(ctx, count, "检查完成, 未处理的风险%d个", count)
+}
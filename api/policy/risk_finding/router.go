@@ -0,0 +1,12 @@
+package risk_finding
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/risk_findings", handler.List)
+	e.GET("/policy/risk_finding", handler.Get)
+	e.PUT("/policy/risk_finding/ack", handler.Ack)
+	e.POST("/policy/risk_finding/evaluate", handler.Evaluate)
+}
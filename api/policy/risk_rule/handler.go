@@ -0,0 +1,22 @@
+package risk_rule
+
+import (
+	"netops/libs"
+	"netops/model"
+)
+
+type Handler struct {
+	libs.Controller
+}
+
+var handler *Handler
+
+func init() {
+	handler = &Handler{}
+	handler.NewInstance = func() libs.Instance {
+		return new(model.TRiskRule)
+	}
+	handler.NewResults = func() any {
+		return &[]*model.TRiskRule{}
+	}
+}
@@ -0,0 +1,13 @@
+package risk_rule
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func Routers(e *gin.RouterGroup) {
+	e.GET("/policy/risk_rules", handler.List)
+	e.GET("/policy/risk_rule", handler.Get)
+	e.POST("/policy/risk_rule", handler.Create)
+	e.PUT("/policy/risk_rule", handler.Update)
+	e.DELETE("/policy/risk_rule", handler.Delete)
+}
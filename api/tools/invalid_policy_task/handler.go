@@ -3,9 +3,13 @@ package invalid_policy_task
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"netops/libs"
 	"netops/model"
+	"netops/pkg/device"
+	"netops/pkg/schedule"
 	"netops/pkg/tools"
+	"strconv"
 )
 
 type Handler struct {
@@ -24,6 +28,26 @@ func init() {
 	}
 }
 
+// 修改任务后重新加载定时采集任务
+func (h *Handler) reload() {
+	if e := schedule.ReloadInvalidPolicy(); e != nil {
+		zap.L().Error("重新加载定时采集策略命中数任务失败", zap.Error(e))
+	}
+}
+
+func (h *Handler) Create(ctx *gin.Context) {
+	h.Controller.Create(ctx)
+	h.reload()
+}
+func (h *Handler) Update(ctx *gin.Context) {
+	h.Controller.Update(ctx)
+	h.reload()
+}
+func (h *Handler) Delete(ctx *gin.Context) {
+	h.Controller.Delete(ctx)
+	h.reload()
+}
+
 func (h *Handler) Parse(request *gin.Context) {
 	params := struct {
 		TaskId int `json:"task_id"`
@@ -40,3 +64,23 @@ func (h *Handler) Parse(request *gin.Context) {
 	}
 	libs.HttpSuccess(request, nil, "操作成功")
 }
+
+// ZeroHitPolicies 获取设备最近N天没有命中的策略
+func (h *Handler) ZeroHitPolicies(request *gin.Context) {
+	deviceId, _ := strconv.Atoi(request.Query("device_id"))
+	if deviceId == 0 {
+		libs.HttpParamsError(request, "device_id不能为空")
+		return
+	}
+	days, _ := strconv.Atoi(request.DefaultQuery("days", "30"))
+	if days <= 0 {
+		libs.HttpParamsError(request, "days必须大于0")
+		return
+	}
+	results, e := device.FindZeroHitPolicies(deviceId, days)
+	if e != nil {
+		libs.HttpServerError(request, e.Error())
+		return
+	}
+	libs.HttpSuccess(request, results, "获取成功")
+}
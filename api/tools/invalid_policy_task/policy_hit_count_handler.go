@@ -5,7 +5,10 @@ import (
 	"netops/model"
 )
 
-var policyHitCountHandler *Handler
+var (
+	policyHitCountHandler        *Handler
+	policyHitCountHistoryHandler *Handler
+)
 
 func init() {
 	policyHitCountHandler = &Handler{}
@@ -16,3 +19,13 @@ func init() {
 		return &[]*model.TDevicePolicyHitCount{}
 	}
 }
+
+func init() {
+	policyHitCountHistoryHandler = &Handler{}
+	policyHitCountHistoryHandler.NewInstance = func() libs.Instance {
+		return new(model.TDevicePolicyHitCountHistory)
+	}
+	policyHitCountHistoryHandler.NewResults = func() any {
+		return &[]*model.TDevicePolicyHitCountHistory{}
+	}
+}
@@ -12,4 +12,6 @@ func Routers(e *gin.RouterGroup) {
 	e.DELETE("tools/invalid_policy_task", handler.Delete)
 	e.POST("/tools/invalid_policy_task/parse", handler.Parse)
 	e.GET("/tools/invalid_policy_task/policy_hit_counts", policyHitCountHandler.List)
+	e.GET("/tools/invalid_policy_task/policy_hit_count_histories", policyHitCountHistoryHandler.List)
+	e.GET("/tools/invalid_policy_task/zero_hit_policies", handler.ZeroHitPolicies)
 }
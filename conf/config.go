@@ -21,6 +21,12 @@ type config struct {
 	Minio            Minio                      `json:"minio"`
 	Nacos            Nacos                      `json:"nacos"`
 	Yops             Yops                       `json:"yops"`
+	Backup           Backup                     `json:"backup"`
+	Snapshot         Snapshot                   `json:"snapshot"`
+	Credential       Credential                 `json:"credential"`
+	Health           Health                     `json:"health"`
+	Facts            Facts                      `json:"facts"`
+	SafeCommit       SafeCommit                 `json:"safe_commit"`
 	APPAuth          map[string]Auth            // 存放认证用户信息
 	ExcludeAuth      map[string]map[string]bool // 存放不校验的URL
 	LoginExcludeAuth map[string]map[string]bool // 存放不校验的URL
@@ -56,6 +62,65 @@ type Minio struct {
 	Secure    bool   `json:"secure"`
 }
 
+type Backup struct {
+	DiffIgnore map[string][]string `json:"diff_ignore"` // 备份对比时忽略的行，key为设备类型，value为正则
+	Storage    string              `json:"storage"`     // 备份存储: minio local s3，默认minio
+	LocalDir   string              `json:"local_dir"`   // 本地存储目录
+	S3         S3                  `json:"s3"`
+	Encrypt    bool                `json:"encrypt"`     // 是否使用aes_key加密备份文件
+	VerifyCron string              `json:"verify_cron"` // 定时校验备份文件md5，为空则不校验
+}
+
+// Snapshot 策略快照，每次解析成功后保存
+type Snapshot struct {
+	KeepDays int `json:"keep_days"` // 保留最近多少天的全部快照，默认30
+	Monthly  int `json:"monthly"`   // 更早的快照每月保留最后一个，保留的月数，默认12
+}
+
+// Credential 设备凭据加密配置，keys按版本保存密钥，轮换时新增版本并修改active后执行-rotate-credential-key
+type Credential struct {
+	Keys   map[string]string `json:"keys"`   // 密钥版本 -> aes密钥，长度16、24或32，为空时使用aes_key作为版本0
+	Active string            `json:"active"` // 新加密使用的密钥版本
+	Vault  Vault             `json:"vault"`
+}
+
+// Vault 外部密钥存储，凭据的backend为vault时从kv引擎读取账号密码
+type Vault struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+	Mount string `json:"mount"` // kv v2引擎挂载路径，默认secret
+}
+
+// Health 设备健康检查，定时通过net_api登录设备执行轻量命令
+type Health struct {
+	Cron        string `json:"cron"`        // 为空则不检查
+	Threshold   int    `json:"threshold"`   // 连续失败N次后发送告警邮件，默认3
+	Concurrency int    `json:"concurrency"` // 同时检查的设备数，默认10
+	Timeout     int    `json:"timeout"`     // 单台设备超时秒数，默认60
+	KeepDays    int    `json:"keep_days"`   // 健康检查历史保留天数，默认30
+}
+
+// Facts 设备资产信息定时采集
+type Facts struct {
+	Cron        string `json:"cron"`        // 为空则不采集
+	Concurrency int    `json:"concurrency"` // 同时采集的设备数，默认5
+}
+
+// SafeCommit 下发配置时先检查再提交，提交后未确认时设备自动回滚
+type SafeCommit struct {
+	Vendors        []string `json:"vendors"`         // 启用的设备类型，为空时只启用srx，h3c和huawei需要设备支持延时提交
+	ConfirmMinutes int      `json:"confirm_minutes"` // 提交后未确认时自动回滚的分钟数，默认5
+}
+
+type S3 struct {
+	Endpoint  string `json:"endpoint"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region"`
+	Secure    bool   `json:"secure"`
+}
+
 type Jira struct {
 	Jql        string `json:"jql"`
 	Server     string `json:"server"`
@@ -27,6 +27,10 @@ const (
 	TaskTypeFirewall = "firewall"
 	TaskTypeNlb      = "nlb"
 
+	// 设备类型，用于区分备份等记录所属的设备表
+	DeviceTypeFirewall = "firewall"
+	DeviceTypeNlb      = "nlb"
+
 	// 地址类型
 	AddressTypeAddress    = "address"
 	AddressTypeAddressSet = "address-set"
@@ -221,7 +221,89 @@ values ('查询任务信息', '/tasks', 'GET', 1),
        ('查看单个工单实施类型信息', '/admin/implement_type', 'GET', 1),
        ('添加工单实施类型', '/admin/implement_type', 'POST', 1),
        ('修改工单实施类型', '/admin/implement_type', 'PUT', 1),
-       ('删除工单实施类型', '/admin/implement_type', 'DELETE', 1);
+       ('删除工单实施类型', '/admin/implement_type', 'DELETE', 1),
+
+       ('离线解析防火墙配置', '/device/firewall/offline', 'POST', 1),
+       ('离线解析负载均衡配置', '/device/nlb/offline', 'POST', 1),
+
+       ('查询防火墙策略变更记录', '/policy/firewall_changes', 'GET', 1),
+       ('查看单个防火墙策略变更记录', '/policy/firewall_change', 'GET', 1),
+
+       ('查询防火墙策略快照', '/policy/firewall_snapshots', 'GET', 1),
+       ('对比防火墙策略快照', '/policy/firewall_snapshot/diff', 'GET', 1),
+       ('导出防火墙策略快照差异', '/policy/firewall_snapshot/diff_export', 'GET', 1),
+
+       ('对比设备备份', '/device/backup/diff', 'GET', 1),
+       ('对比设备最新备份与上一次备份', '/device/backup/diff_previous', 'GET', 1),
+
+       ('查询定时备份配置', '/device/backup_schedules', 'GET', 1),
+       ('查看单个定时备份配置', '/device/backup_schedule', 'GET', 1),
+       ('添加定时备份配置', '/device/backup_schedule', 'POST', 1),
+       ('修改定时备份配置', '/device/backup_schedule', 'PUT', 1),
+       ('删除定时备份配置', '/device/backup_schedule', 'DELETE', 1),
+       ('执行定时备份', '/device/backup_schedule/run', 'POST', 1),
+       ('查询定时备份执行记录', '/device/backup_runs', 'GET', 1),
+
+       ('负载均衡配置备份', '/device/nlb/backup', 'POST', 1),
+
+       ('防火墙策略分析', '/policy/firewall_analysis', 'GET', 1),
+       ('防火墙策略分析导出', '/policy/firewall_analysis/export', 'GET', 1),
+       ('防火墙策略清理命令', '/policy/firewall_analysis/commands', 'GET', 1),
+
+       ('风险规则列表', '/policy/risk_rules', 'GET', 1),
+       ('风险规则详情', '/policy/risk_rule', 'GET', 1),
+       ('新增风险规则', '/policy/risk_rule', 'POST', 1),
+       ('修改风险规则', '/policy/risk_rule', 'PUT', 1),
+       ('删除风险规则', '/policy/risk_rule', 'DELETE', 1),
+       ('风险结果列表', '/policy/risk_findings', 'GET', 1),
+       ('风险结果详情', '/policy/risk_finding', 'GET', 1),
+       ('确认风险', '/policy/risk_finding/ack', 'PUT', 1),
+       ('检查设备策略风险', '/policy/risk_finding/evaluate', 'POST', 1),
+       ('风险例外列表', '/policy/risk_exceptions', 'GET', 1),
+       ('风险例外详情', '/policy/risk_exception', 'GET', 1),
+       ('新增风险例外', '/policy/risk_exception', 'POST', 1),
+       ('修改风险例外', '/policy/risk_exception', 'PUT', 1),
+       ('删除风险例外', '/policy/risk_exception', 'DELETE', 1),
+
+       ('防火墙未使用对象', '/policy/firewall_unused', 'GET', 1),
+       ('防火墙未使用对象导出', '/policy/firewall_unused/export', 'GET', 1),
+       ('创建未使用对象清理工单', '/policy/firewall_unused/task', 'POST', 1),
+
+       ('查看策略命中数历史', '/tools/invalid_policy_task/policy_hit_count_histories', 'GET', 1),
+       ('查看长期未命中策略', '/tools/invalid_policy_task/zero_hit_policies', 'GET', 1),
+
+       ('查询策略下线记录', '/policy/firewall_decommissions', 'GET', 1),
+       ('查看策略下线记录', '/policy/firewall_decommission', 'GET', 1),
+       ('创建策略禁用工单', '/policy/firewall_decommission/disable', 'POST', 1),
+       ('创建策略删除工单', '/policy/firewall_decommission/delete', 'POST', 1),
+       ('创建策略重新启用工单', '/policy/firewall_decommission/reactivate', 'POST', 1),
+
+       ('访问流量说明', '/policy/firewall/explain', 'GET', 1),
+
+       ('查询设备区域', '/device/zones', 'GET', 1),
+       ('查看单个设备区域', '/device/zone', 'GET', 1),
+       ('添加设备区域', '/device/zone', 'POST', 1),
+       ('修改设备区域', '/device/zone', 'PUT', 1),
+       ('删除设备区域', '/device/zone', 'DELETE', 1),
+
+       ('查询设备凭据', '/device/credentials', 'GET', 1),
+       ('查看单个设备凭据', '/device/credential', 'GET', 1),
+       ('添加设备凭据', '/device/credential', 'POST', 1),
+       ('修改设备凭据', '/device/credential', 'PUT', 1),
+       ('删除设备凭据', '/device/credential', 'DELETE', 1),
+
+       ('检查设备健康状态', '/device/firewall/health', 'POST', 1),
+       ('查询设备健康检查记录', '/device/firewall/health_history', 'GET', 1),
+
+       ('查询设备资产信息', '/device/facts', 'GET', 1),
+       ('采集设备资产信息', '/device/facts/collect', 'POST', 1),
+
+       ('配置漂移列表', '/policy/drift_findings', 'GET', 1),
+       ('配置漂移详情', '/policy/drift_finding', 'GET', 1),
+       ('检查设备配置漂移', '/policy/drift_finding/detect', 'POST', 1),
+
+       ('检查负载设备健康状态', '/device/nlb/health', 'POST', 1),
+       ('查询负载设备健康检查记录', '/device/nlb/health_history', 'GET', 1);
 
 ALTER TABLE t_menu_api
     AUTO_INCREMENT = 1;
@@ -142,6 +142,8 @@ CREATE TABLE `t_task_info`
     `dst`                   varchar(2048)                NOT NULL COMMENT '目标IP地址',
     `dport`                 varchar(255)                 NOT NULL COMMENT '目标端口',
     `direction`             enum ('inside','outside','') NOT NULL DEFAULT '' COMMENT '策略类型，出向或者入向',
+    `src_zone`              varchar(64)                           DEFAULT NULL COMMENT '源区域',
+    `dst_zone`              varchar(64)                           DEFAULT NULL COMMENT '目标区域',
     `outbound_network_type` varchar(50)                           DEFAULT NULL COMMENT '出向网络类型',
     `created_at`            datetime                              DEFAULT CURRENT_TIMESTAMP,
     `updated_at`            datetime                              DEFAULT CURRENT_TIMESTAMP,
@@ -152,6 +154,7 @@ CREATE TABLE `t_task_info`
     `device_id`             int(11)                               DEFAULT NULL,
     `action`                varchar(50)                           DEFAULT 'deny' COMMENT '策略状态',
     `command`               text,
+    `command_only`          tinyint(1)                   NOT NULL DEFAULT 0 COMMENT '是否直接下发命令的任务项，如清理、下线',
     `result`                text,
     `status`                varchar(50)                           DEFAULT 'init',
     `node`                  varchar(255)                          DEFAULT NULL,
@@ -192,8 +195,13 @@ CREATE TABLE `t_device`
     `name`                   varchar(100) NOT NULL COMMENT '设备名',
     `host`                   varchar(100) NOT NULL COMMENT '设备IP',
     `port`                   int(11)      DEFAULT '22' COMMENT '设备端口',
-    `username`               varchar(255) NOT NULL COMMENT '用户名',
-    `password`               varchar(255) NOT NULL COMMENT '设备密码',
+    `username`               varchar(255) DEFAULT NULL COMMENT '用户名',
+    `password`               varchar(255) DEFAULT NULL COMMENT '按key_version加密的设备密码',
+    `key_version`            varchar(32)  NOT NULL DEFAULT '' COMMENT '密码加密密钥版本',
+    `read_credential_id`     int(11)      DEFAULT 0 COMMENT '只读凭据ID, 用于解析和备份',
+    `write_credential_id`    int(11)      DEFAULT 0 COMMENT '读写凭据ID, 用于下发配置',
+    `ha_peer_host`           varchar(100) DEFAULT NULL COMMENT 'HA对端设备IP, 与host组成主备',
+    `ha_vip`                 varchar(100) DEFAULT NULL COMMENT 'HA集群管理VIP, 配置后通过VIP登录',
     `device_type_id`         int(11)      NOT NULL COMMENT '设备类型ID',
     `in_policy`              varchar(50)  DEFAULT NULL COMMENT '入向策略名',
     `out_policy`             varchar(50)  DEFAULT NULL COMMENT '出向策略名',
@@ -207,6 +215,11 @@ CREATE TABLE `t_device`
     `blacklist_policy_name`  varchar(255) DEFAULT NULL,
     `in_permit_policy_name`  varchar(255) DEFAULT NULL,
     `out_permit_policy_name` varchar(255) DEFAULT NULL,
+    `health_status`          varchar(20)  DEFAULT NULL COMMENT '健康状态: up login_failed unreachable',
+    `health_failures`        int(11)      DEFAULT 0 COMMENT '健康检查连续失败次数',
+    `health_latency`         int(11)      DEFAULT NULL COMMENT '健康检查延迟, 毫秒',
+    `health_message`         varchar(1024) DEFAULT NULL COMMENT '健康检查错误信息',
+    `health_checked_at`      datetime     DEFAULT NULL COMMENT '最近一次健康检查时间',
     PRIMARY KEY (`id`),
     UNIQUE KEY `name` (`name`),
     UNIQUE KEY `host` (`host`)
@@ -223,10 +236,16 @@ CREATE TABLE `t_nlb_device`
     `host`           varchar(100) NOT NULL COMMENT '设备IP',
     `port`           int(11)                          DEFAULT '22' COMMENT '设备端口',
     `username`       varchar(255) NOT NULL COMMENT '用户名',
-    `password`       varchar(255) NOT NULL COMMENT '设备密码',
+    `password`       varchar(255) NOT NULL COMMENT '按key_version加密的设备密码',
+    `key_version`    varchar(32)  NOT NULL DEFAULT '' COMMENT '密码加密密钥版本',
     `device_type_id` int(11)      NOT NULL COMMENT '设备类型ID',
     `enabled`        tinyint(1)                       DEFAULT '1' COMMENT '设备状态',
     `parse_status`   enum ('init','failed','success') DEFAULT 'init' COMMENT '解析状态',
+    `health_status`     varchar(20)   DEFAULT NULL COMMENT '健康状态: up login_failed unreachable',
+    `health_failures`   int(11)       DEFAULT 0 COMMENT '健康检查连续失败次数',
+    `health_latency`    int(11)       DEFAULT NULL COMMENT '健康检查延迟, 毫秒',
+    `health_message`    varchar(1024) DEFAULT NULL COMMENT '健康检查错误信息',
+    `health_checked_at` datetime      DEFAULT NULL COMMENT '最近一次健康检查时间',
     `created_by`     varchar(50)                      DEFAULT NULL,
     `updated_by`     varchar(50)                      DEFAULT NULL,
     PRIMARY KEY (`id`),
@@ -238,12 +257,19 @@ CREATE TABLE `t_nlb_device`
 CREATE TABLE `t_device_backup`
 (
     `id`         int(11) NOT NULL AUTO_INCREMENT,
-    `device_id`  int(11) NOT NULL COMMENT '防火墙设备',
+    `device_id`  int(11) NOT NULL COMMENT '设备ID',
+    `device_type` varchar(20) DEFAULT 'firewall' COMMENT '设备类型: firewall nlb',
     `created_at` datetime     DEFAULT CURRENT_TIMESTAMP,
     `updated_at` datetime     DEFAULT CURRENT_TIMESTAMP,
     `filename`   varchar(255) DEFAULT NULL COMMENT '文件名',
     `md5`        varchar(64)  DEFAULT NULL COMMENT 'MD5值',
+    `md5_version` tinyint(1)  DEFAULT 0 COMMENT 'md5计算方式: 0旧版本未校验 1压缩文件的md5',
     `size`       int(11)      DEFAULT NULL COMMENT '文件大小',
+    `storage`    varchar(20)  DEFAULT 'minio' COMMENT '存储类型: minio local s3',
+    `encrypted`  tinyint(1)   DEFAULT 0 COMMENT '是否加密存储',
+    `verify_status`  varchar(20)   DEFAULT NULL COMMENT '最近一次md5校验结果: success failed legacy',
+    `verify_message` varchar(1024) DEFAULT NULL COMMENT '校验失败原因',
+    `verified_at`    datetime      DEFAULT NULL COMMENT '最近一次校验时间',
     `created_by` varchar(50)  DEFAULT NULL,
     `updated_by` varchar(50)  DEFAULT NULL,
     PRIMARY KEY (`id`)
@@ -256,6 +282,8 @@ CREATE TABLE `t_device_policy`
     `device_id`  int(11)       NOT NULL COMMENT '设备ID',
     `name`       varchar(128)  NOT NULL COMMENT '策略名称',
     `direction`  varchar(50)   NOT NULL COMMENT '策略方向',
+    `src_zone`   varchar(64)   DEFAULT NULL COMMENT '源区域',
+    `dst_zone`   varchar(64)   DEFAULT NULL COMMENT '目标区域',
     `src`        longtext      NOT NULL COMMENT '源地址',
     `src_group`  varchar(4096) NOT NULL COMMENT '源地址组',
     `dst`        longtext      NOT NULL COMMENT '目标地址',
@@ -406,10 +434,10 @@ CREATE TABLE `t_device_policy_hit_count` (
                                              `id` int(11) NOT NULL AUTO_INCREMENT,
                                              `device_id` int(11) NOT NULL COMMENT '防火墙设备',
                                              `name` varchar(255) DEFAULT NULL COMMENT '源目端协议唯一',
-                                             `source` varchar(64) DEFAULT NULL COMMENT '源地址',
-                                             `destination` varchar(64) DEFAULT NULL COMMENT '目标地址',
+                                             `source` varchar(2000) DEFAULT NULL COMMENT '源地址',
+                                             `destination` varchar(2000) DEFAULT NULL COMMENT '目标地址',
                                              `protocol` varchar(20) DEFAULT NULL COMMENT '协议',
-                                             `port` varchar(64) DEFAULT NULL COMMENT '端口',
+                                             `port` varchar(2000) DEFAULT NULL COMMENT '端口',
                                              `before_hit_count` bigint(50) DEFAULT NULL,
                                              `hit_count` bigint(50) DEFAULT NULL,
                                              `command` varchar(2000) DEFAULT NULL COMMENT '命令',
@@ -428,6 +456,7 @@ CREATE TABLE `t_invalid_policy_task` (
                                          `device_id` int(11) NOT NULL COMMENT '防火墙设备',
                                          `description` varchar(255) DEFAULT NULL COMMENT '描述',
                                          `status` enum('ready','running','failed','success') DEFAULT 'ready' COMMENT '状态',
+                                         `cron` varchar(64) DEFAULT NULL COMMENT '定时采集命中数cron表达式',
                                          `created_at` datetime DEFAULT CURRENT_TIMESTAMP,
                                          `created_by` varchar(64) DEFAULT NULL COMMENT '创建人',
                                          `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
@@ -599,4 +628,294 @@ CREATE TABLE `t_f5_snat_pool` (
                                   `updated_at` datetime DEFAULT CURRENT_TIMESTAMP,
                                   PRIMARY KEY (`id`),
                                   UNIQUE KEY `device_id` (`device_id`,`name`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'F5设备SnatPool表';
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'F5设备SnatPool表';
+CREATE TABLE `t_device_policy_change`
+(
+    `id`          int(11)      NOT NULL AUTO_INCREMENT,
+    `device_id`   int(11)      NOT NULL COMMENT '设备ID',
+    `object_type` varchar(20)  NOT NULL COMMENT '变更对象: policy group port nat',
+    `object_key`  varchar(512) NOT NULL COMMENT '对象唯一键',
+    `change_type` varchar(20)  NOT NULL COMMENT '变更类型: added removed modified',
+    `old_value`   longtext COMMENT '变更前内容',
+    `new_value`   longtext COMMENT '变更后内容',
+    `created_at`  datetime    DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`  datetime    DEFAULT CURRENT_TIMESTAMP,
+    `created_by`  varchar(50) DEFAULT NULL,
+    `updated_by`  varchar(50) DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `t_device_policy_change_device_id_index` (`device_id`, `created_at`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '设备策略变更记录表';
+
+CREATE TABLE `t_device_snapshot`
+(
+    `id`           int(11) NOT NULL AUTO_INCREMENT,
+    `device_id`    int(11) NOT NULL COMMENT '设备ID',
+    `policy_count` int(11)     DEFAULT 0 COMMENT '策略数',
+    `group_count`  int(11)     DEFAULT 0 COMMENT '地址组数',
+    `port_count`   int(11)     DEFAULT 0 COMMENT '端口数',
+    `nat_count`    int(11)     DEFAULT 0 COMMENT 'nat数',
+    `created_at`   datetime    DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`   datetime    DEFAULT CURRENT_TIMESTAMP,
+    `created_by`   varchar(50) DEFAULT NULL,
+    `updated_by`   varchar(50) DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `t_device_snapshot_device_id_index` (`device_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '设备策略快照表';
+
+CREATE TABLE `t_device_snapshot_item`
+(
+    `id`          int(11)      NOT NULL AUTO_INCREMENT,
+    `snapshot_id` int(11)      NOT NULL COMMENT '快照ID',
+    `object_type` varchar(20)  NOT NULL COMMENT '对象类型: policy group port nat',
+    `object_key`  varchar(512) NOT NULL COMMENT '对象唯一键',
+    `content`     longtext COMMENT '标准化后的内容',
+    PRIMARY KEY (`id`),
+    KEY `t_device_snapshot_item_snapshot_id_index` (`snapshot_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '设备策略快照内容表';
+
+CREATE TABLE `t_backup_schedule`
+(
+    `id`           int(11)     NOT NULL AUTO_INCREMENT,
+    `region_id`    int(11)     NOT NULL COMMENT '网络区域',
+    `cron`         varchar(64) NOT NULL COMMENT 'cron表达式',
+    `concurrency`  int(11)      DEFAULT 5 COMMENT '同时备份的设备数',
+    `keep_daily`   int(11)      DEFAULT 7 COMMENT '保留最近N天每天的最后一次备份',
+    `keep_weekly`  int(11)      DEFAULT 4 COMMENT '保留最近M周每周的最后一次备份',
+    `keep_monthly` int(11)      DEFAULT 12 COMMENT '保留最近K月每月的最后一次备份',
+    `enabled`      tinyint(1)   DEFAULT 1,
+    `description`  varchar(255) DEFAULT NULL,
+    `created_at`   datetime     DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`   datetime     DEFAULT CURRENT_TIMESTAMP,
+    `created_by`   varchar(50)  DEFAULT NULL,
+    `updated_by`   varchar(50)  DEFAULT NULL,
+    PRIMARY KEY (`id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '定时备份配置表';
+
+CREATE TABLE `t_device_zone`
+(
+    `id`          int(11)      NOT NULL AUTO_INCREMENT,
+    `device_id`   int(11)      NOT NULL COMMENT '设备ID',
+    `name`        varchar(64)  NOT NULL COMMENT '区域名称',
+    `interface`   varchar(255) DEFAULT NULL COMMENT '区域绑定的接口',
+    `subnet`      text COMMENT '区域内的网段，多个用逗号分隔',
+    `description` varchar(255) DEFAULT NULL,
+    `created_at`  datetime     DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`  datetime     DEFAULT CURRENT_TIMESTAMP,
+    `created_by`  varchar(50)  DEFAULT NULL,
+    `updated_by`  varchar(50)  DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `t_device_zone_device_id_name_uindex` (`device_id`, `name`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '设备安全区域表';
+
+CREATE TABLE `t_credential`
+(
+    `id`              int(11)      NOT NULL AUTO_INCREMENT,
+    `name`            varchar(64)  NOT NULL COMMENT '凭据名称',
+    `username`        varchar(64)  DEFAULT NULL,
+    `password`        varchar(255) DEFAULT NULL COMMENT '按key_version加密的密码',
+    `enable_password` varchar(255) DEFAULT NULL,
+    `key_version`     varchar(32)  NOT NULL DEFAULT '' COMMENT '加密密钥版本',
+    `backend`         varchar(32)  NOT NULL DEFAULT '' COMMENT '外部存储, 为空时使用本地加密存储',
+    `secret_path`     varchar(255) DEFAULT NULL COMMENT '外部存储中的路径',
+    `description`     varchar(255) DEFAULT NULL,
+    `created_at`      datetime     DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`      datetime     DEFAULT CURRENT_TIMESTAMP,
+    `created_by`      varchar(50)  DEFAULT NULL,
+    `updated_by`      varchar(50)  DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `t_credential_name_uindex` (`name`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '设备凭据表';
+
+CREATE TABLE `t_device_health`
+(
+    `id`            int(11)     NOT NULL AUTO_INCREMENT,
+    `device_id`     int(11)     NOT NULL COMMENT '设备ID',
+    `device_type`   varchar(20) DEFAULT 'firewall' COMMENT '设备类型: firewall nlb',
+    `status`        varchar(20) NOT NULL COMMENT '健康状态: up login_failed unreachable',
+    `login_success` tinyint(1)  DEFAULT 0 COMMENT '是否登录成功',
+    `latency`       int(11)     DEFAULT NULL COMMENT '延迟, 毫秒',
+    `failures`      int(11)     DEFAULT 0 COMMENT '本次检查后的连续失败次数',
+    `message`       text COMMENT '错误信息',
+    `checked_at`    datetime    NOT NULL COMMENT '检查时间',
+    PRIMARY KEY (`id`),
+    KEY `t_device_health_device_id_index` (`device_id`, `device_type`, `checked_at`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '设备健康检查记录表';
+
+CREATE TABLE `t_device_facts`
+(
+    `id`           int(11)      NOT NULL AUTO_INCREMENT,
+    `device_id`    int(11)      NOT NULL COMMENT '设备ID',
+    `vendor`       varchar(20)  DEFAULT NULL COMMENT '厂商: asa srx h3c huawei',
+    `model`        varchar(128) DEFAULT NULL COMMENT '型号',
+    `version`      varchar(128) DEFAULT NULL COMMENT '系统版本',
+    `serial`       varchar(128) DEFAULT NULL COMMENT '序列号',
+    `ha_role`      varchar(20)  DEFAULT NULL COMMENT 'HA角色: active standby standalone',
+    `uptime`       varchar(128) DEFAULT NULL COMMENT '运行时间',
+    `interfaces`   longtext COMMENT '接口列表, json',
+    `license`      text COMMENT 'license信息',
+    `message`      text COMMENT '采集失败原因',
+    `collected_at` datetime     DEFAULT NULL COMMENT '采集时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `t_device_facts_device_id_uindex` (`device_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '设备资产信息表';
+
+CREATE TABLE `t_backup_run`
+(
+    `id`          int(11) NOT NULL AUTO_INCREMENT,
+    `schedule_id` int(11) NOT NULL COMMENT '定时备份配置',
+    `region_id`   int(11) NOT NULL COMMENT '网络区域',
+    `status`      varchar(20) DEFAULT NULL COMMENT '执行状态: running success failed',
+    `total`       int(11)     DEFAULT 0 COMMENT '设备总数',
+    `success`     int(11)     DEFAULT 0 COMMENT '成功数',
+    `failed`      int(11)     DEFAULT 0 COMMENT '失败数',
+    `pruned`      int(11)     DEFAULT 0 COMMENT '清理的备份数',
+    `detail`      text COMMENT '失败设备及原因',
+    `finished_at` datetime    DEFAULT NULL,
+    `created_at`  datetime    DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`  datetime    DEFAULT CURRENT_TIMESTAMP,
+    `created_by`  varchar(50) DEFAULT NULL,
+    `updated_by`  varchar(50) DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `t_backup_run_schedule_id_index` (`schedule_id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '定时备份执行记录表';
+
+CREATE TABLE `t_risk_rule`
+(
+    `id`           int(11)      NOT NULL AUTO_INCREMENT,
+    `name`         varchar(100) NOT NULL COMMENT '规则名称',
+    `severity`     varchar(20)  NOT NULL COMMENT '风险等级: high medium low',
+    `direction`    varchar(20)  DEFAULT NULL COMMENT '策略方向, 为空不检查',
+    `action`       varchar(20)  DEFAULT 'permit' COMMENT '策略动作, 为空不检查',
+    `src_prefix`   int(11)      DEFAULT NULL COMMENT '源地址存在掩码不大于该值的网段时命中',
+    `dst_prefix`   int(11)      DEFAULT NULL COMMENT '目标地址存在掩码不大于该值的网段时命中',
+    `src_net_type` varchar(255) DEFAULT NULL COMMENT '源地址与该网络类型的网段有交集时命中',
+    `dst_net_type` varchar(255) DEFAULT NULL COMMENT '目标地址与该网络类型的网段有交集时命中',
+    `ports`        varchar(255) DEFAULT NULL COMMENT '端口与该端口集合有交集时命中',
+    `port_count`   int(11)      DEFAULT 0 COMMENT '端口数量不小于该值时命中',
+    `enabled`      tinyint(1)   DEFAULT 1,
+    `description`  varchar(255) DEFAULT NULL,
+    `created_at`   datetime     DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`   datetime     DEFAULT CURRENT_TIMESTAMP,
+    `created_by`   varchar(50)  DEFAULT NULL,
+    `updated_by`   varchar(50)  DEFAULT NULL,
+    PRIMARY KEY (`id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '策略风险规则表';
+
+CREATE TABLE `t_risk_finding`
+(
+    `id`           int(11)      NOT NULL AUTO_INCREMENT,
+    `device_id`    int(11)      NOT NULL COMMENT '防火墙设备',
+    `rule_id`      int(11)      NOT NULL COMMENT '风险规则',
+    `policy_id`    int(11)      DEFAULT NULL COMMENT '策略ID',
+    `policy_name`  varchar(255) DEFAULT NULL COMMENT '策略名称',
+    `direction`    varchar(20)  DEFAULT NULL COMMENT '策略方向',
+    `line`         int(11)      DEFAULT NULL COMMENT '策略行号',
+    `fingerprint`  varchar(64)  DEFAULT NULL COMMENT '策略内容hash',
+    `severity`     varchar(20)  DEFAULT NULL COMMENT '风险等级',
+    `detail`       varchar(1024) DEFAULT NULL COMMENT '命中的条件',
+    `status`       varchar(20)  DEFAULT 'open' COMMENT '状态: open acked excepted resolved',
+    `exception_id` int(11)      DEFAULT 0 COMMENT '匹配的例外',
+    `acked_by`     varchar(50)  DEFAULT NULL COMMENT '确认人',
+    `acked_at`     datetime     DEFAULT NULL COMMENT '确认时间',
+    `ack_comment`  varchar(255) DEFAULT NULL COMMENT '确认说明',
+    `resolved_at`  datetime     DEFAULT NULL COMMENT '解决时间',
+    `created_at`   datetime     DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`   datetime     DEFAULT CURRENT_TIMESTAMP,
+    `created_by`   varchar(50)  DEFAULT NULL,
+    `updated_by`   varchar(50)  DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `t_risk_finding_device_id_index` (`device_id`),
+    KEY `t_risk_finding_status_index` (`status`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '策略风险结果表';
+
+CREATE TABLE `t_risk_exception`
+(
+    `id`          int(11)      NOT NULL AUTO_INCREMENT,
+    `rule_id`     int(11)      DEFAULT 0 COMMENT '风险规则, 0为所有规则',
+    `device_id`   int(11)      DEFAULT 0 COMMENT '防火墙设备, 0为所有设备',
+    `policy_name` varchar(255) DEFAULT NULL COMMENT '策略名称, 为空匹配所有策略',
+    `reason`      varchar(255) NOT NULL COMMENT '例外原因',
+    `expired_at`  datetime     DEFAULT NULL COMMENT '过期时间, 为空不过期',
+    `created_at`  datetime     DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`  datetime     DEFAULT CURRENT_TIMESTAMP,
+    `created_by`  varchar(50)  DEFAULT NULL,
+    `updated_by`  varchar(50)  DEFAULT NULL,
+    PRIMARY KEY (`id`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '策略风险例外表';
+
+CREATE TABLE `t_device_policy_hit_count_history`
+(
+    `id`           int(11)      NOT NULL AUTO_INCREMENT,
+    `device_id`    int(11)      NOT NULL COMMENT '防火墙设备',
+    `name`         varchar(255) NOT NULL COMMENT '策略命中数名称',
+    `hit_count`    bigint(20)   DEFAULT 0 COMMENT '设备上的累计命中数',
+    `delta`        bigint(20)   DEFAULT 0 COMMENT '与上次采集相比新增的命中数',
+    `reset`        tinyint(1)   DEFAULT 0 COMMENT '计数器是否被重置',
+    `collected_at` datetime     NOT NULL COMMENT '采集时间',
+    `created_at`   datetime     DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`   datetime     DEFAULT CURRENT_TIMESTAMP,
+    `created_by`   varchar(50)  DEFAULT NULL,
+    `updated_by`   varchar(50)  DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `device_name_collected` (`device_id`, `name`, `collected_at`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '策略命中数历史';
+
+CREATE TABLE `t_policy_decommission`
+(
+    `id`                 int(11)       NOT NULL AUTO_INCREMENT,
+    `device_id`          int(11)       NOT NULL COMMENT '防火墙设备',
+    `policy_name`        varchar(255)  NOT NULL COMMENT '策略名',
+    `direction`          varchar(64)   DEFAULT NULL COMMENT '策略方向',
+    `command`            text COMMENT '下线时的策略配置',
+    `source`             varchar(32)   DEFAULT NULL COMMENT '来源: hit_count analysis',
+    `reason`             varchar(255)  DEFAULT NULL COMMENT '下线原因',
+    `grace_days`         int(11)       DEFAULT 14 COMMENT '禁用后多少天可以删除',
+    `status`             varchar(32)   NOT NULL COMMENT '状态: disabling disabled deleting deleted reactivating reactivated failed',
+    `disable_task_id`    int(11)       DEFAULT 0 COMMENT '禁用工单',
+    `delete_task_id`     int(11)       DEFAULT 0 COMMENT '删除工单',
+    `reactivate_task_id` int(11)       DEFAULT 0 COMMENT '重新启用工单',
+    `disabled_at`        datetime      DEFAULT NULL COMMENT '禁用时间',
+    `finished_at`        datetime      DEFAULT NULL COMMENT '删除或重新启用的时间',
+    `created_at`         datetime      DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`         datetime      DEFAULT CURRENT_TIMESTAMP,
+    `created_by`         varchar(50)   DEFAULT NULL,
+    `updated_by`         varchar(50)   DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `device_status` (`device_id`, `status`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '策略下线记录';
+
+CREATE TABLE `t_drift_finding`
+(
+    `id`          int(11)       NOT NULL AUTO_INCREMENT,
+    `device_id`   int(11)       NOT NULL COMMENT '防火墙设备',
+    `type`        varchar(20)   NOT NULL COMMENT '漂移类型: missing modified unmanaged',
+    `object_type` varchar(20)   NOT NULL COMMENT '对象类型: policy address_group',
+    `name`        varchar(255)  NOT NULL COMMENT '对象名',
+    `jira_key`    varchar(64)   DEFAULT NULL COMMENT '对象所属工单',
+    `task_id`     int(11)       DEFAULT 0 COMMENT '对象所属任务',
+    `info_id`     int(11)       DEFAULT 0 COMMENT '对象所属任务策略',
+    `detail`      varchar(1024) DEFAULT NULL COMMENT '漂移说明',
+    `status`      varchar(20)   DEFAULT 'open' COMMENT '状态: open resolved',
+    `resolved_at` datetime      DEFAULT NULL COMMENT '解决时间',
+    `created_at`  datetime      DEFAULT CURRENT_TIMESTAMP,
+    `updated_at`  datetime      DEFAULT CURRENT_TIMESTAMP,
+    `created_by`  varchar(50)   DEFAULT NULL,
+    `updated_by`  varchar(50)   DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY `device_status` (`device_id`, `status`)
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8 COMMENT = '配置漂移结果表';
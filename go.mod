@@ -11,6 +11,7 @@ require (
 	github.com/minio/minio-go v6.0.14+incompatible
 	github.com/natefinch/lumberjack v2.0.0+incompatible
 	github.com/pkg/errors v0.8.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/segmentio/kafka-go v0.4.43
 	github.com/tealeg/xlsx v1.0.5
 	go.uber.org/zap v1.27.0
@@ -26,6 +26,12 @@ type Client struct {
 	Err       error
 }
 
+// SetTimeout 设置单次调用的超时时间，默认15分钟
+func (c *Client) SetTimeout(timeout time.Duration) *Client {
+	c.timeout = timeout
+	return c
+}
+
 func (c *Client) Close() {
 	if c.conn != nil {
 		_ = c.conn.Close()
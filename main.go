@@ -9,10 +9,20 @@ import (
 	"netops/conf"
 	"netops/database"
 	"netops/libs"
+	"netops/pkg/credential"
+	"netops/pkg/device"
+	"netops/pkg/schedule"
 	"netops/routers"
 	"os"
 )
 
+var (
+	offlineDevice = flag.Int("offline-device", 0, "离线解析的设备ID，设置后解析完成即退出")
+	offlineType   = flag.String("offline-type", "firewall", "离线解析的设备类型: firewall|nlb")
+	offlinePath   = flag.String("offline-path", "", "离线配置路径，文件视为完整配置，目录下按<命令id>.log或F5接口json读取")
+	rotateKey     = flag.Bool("rotate-credential-key", false, "使用credential.active密钥版本重新加密所有凭据，完成即退出")
+)
+
 func main() {
 	flag.Parse()
 	r := gin.New()
@@ -25,6 +35,15 @@ func main() {
 		log.Fatalf("初始化日志异常: %s", e.Error())
 	}
 
+	if *offlineDevice > 0 {
+		parseOffline()
+		return
+	}
+	if *rotateKey {
+		rotateCredentialKey()
+		return
+	}
+
 	// 模板渲染
 	if f, err := os.Stat("dist/"); err == nil && f.IsDir() {
 		// 模板渲染
@@ -52,6 +71,9 @@ func main() {
 	database.InitDB()
 	database.InitRedis()
 
+	log.Println("启动定时任务--->")
+	schedule.Start()
+
 	log.Println("监听端口--->")
 	addr := fmt.Sprintf(":%s", conf.Config.Port)
 	log.Println(addr)
@@ -59,3 +81,40 @@ func main() {
 		log.Fatalf(err.Error())
 	}
 }
+
+// 离线解析设备配置
+func parseOffline() {
+	config, e := device.LoadOfflineConfig(*offlinePath)
+	if e != nil {
+		log.Fatalf(e.Error())
+	}
+	database.InitDB()
+	database.InitRedis()
+	switch *offlineType {
+	case "firewall":
+		parser, err := device.NewDeviceHandler(*offlineDevice)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		parser.SetOffline(config)
+		parser.ParseConfig()
+	case "nlb":
+		parser := device.NewF5Policy(*offlineDevice)
+		if err := parser.ParseOffline(config); err != nil {
+			log.Fatalf(err.Error())
+		}
+	default:
+		log.Fatalf("不支持的设备类型: %s", *offlineType)
+	}
+	log.Println("离线解析完成，详情查看策略解析日志")
+}
+
+// 凭据密钥轮换，逐条更新，不影响运行中的服务
+func rotateCredentialKey() {
+	database.InitDB()
+	count, e := credential.Rotate()
+	if e != nil {
+		log.Fatalf("凭据密钥轮换失败, 已完成%d个: %s", count, e.Error())
+	}
+	log.Printf("凭据密钥轮换完成, 重新加密%d个凭据和设备密码", count)
+}
@@ -7,6 +7,7 @@ import (
 	"netops/conf"
 	"netops/database"
 	"netops/utils"
+	"time"
 )
 
 type TFirewallDevice struct {
@@ -15,9 +16,14 @@ type TFirewallDevice struct {
 	Name                string `gorm:"column:name" json:"name" binding:"required"`
 	Host                string `gorm:"column:host" json:"host" binding:"required"`
 	Port                int    `gorm:"column:port" json:"port"`
-	Username            string `gorm:"column:username" json:"username" binding:"required"`
-	Password            string `gorm:"column:password" json:"password" binding:"required"`
+	Username            string `gorm:"column:username" json:"username"`
+	Password            string `gorm:"column:password" json:"password"`
 	EnablePassword      string `gorm:"column:enable_password" json:"enable_password"`
+	KeyVersion          string `gorm:"column:key_version" json:"key_version" binding:"-"`     // 密码加密的密钥版本
+	ReadCredentialId    int    `gorm:"column:read_credential_id" json:"read_credential_id"`   // 只读凭据，用于解析和备份，为空时使用设备账号
+	WriteCredentialId   int    `gorm:"column:write_credential_id" json:"write_credential_id"` // 读写凭据，用于下发配置，为空时使用设备账号
+	HaPeerHost          string `gorm:"column:ha_peer_host" json:"ha_peer_host"`               // HA对端设备IP，配置后只在主设备上解析、备份和下发
+	HaVip               string `gorm:"column:ha_vip" json:"ha_vip"`                           // HA集群管理VIP，配置后通过VIP登录并校验是否是主设备
 	DeviceTypeId        int    `gorm:"column:device_type_id" json:"device_type_id" binding:"required"`
 	InPolicy            string `gorm:"in_policy" json:"in_policy"`
 	OutPolicy           string `gorm:"out_policy" json:"out_policy"`
@@ -30,6 +36,12 @@ type TFirewallDevice struct {
 	OutPermitPolicyName string `gorm:"out_permit_policy_name" json:"out_permit_policy_name"`
 	ParseStatus         string `gorm:"parse_status" json:"parse_status"`
 	RegionApiServer     string `gorm:"-"`
+	// 健康状态由定时健康检查更新，接口修改设备时不写入
+	HealthStatus    string     `gorm:"column:health_status;<-:false" json:"health_status" binding:"-"`     // up login_failed unreachable
+	HealthFailures  int        `gorm:"column:health_failures;<-:false" json:"health_failures" binding:"-"` // 连续失败次数
+	HealthLatency   int        `gorm:"column:health_latency;<-:false" json:"health_latency" binding:"-"`   // 毫秒
+	HealthMessage   string     `gorm:"column:health_message;<-:false" json:"health_message" binding:"-"`
+	HealthCheckedAt *time.Time `gorm:"column:health_checked_at;<-:false" json:"health_checked_at" binding:"-"`
 }
 
 func (TFirewallDevice) TableName() string {
@@ -71,11 +83,12 @@ func (d *TFirewallDevice) Save(tx *gorm.DB) error {
 	return nil
 }
 
-// BeforeCreate 创建时，加密密码
+// BeforeCreate 创建时，校验账号并使用当前密钥版本加密密码
 func (d *TFirewallDevice) BeforeCreate(tx *gorm.DB) (err error) {
-	d.Password, err = utils.AesEncrypt(d.Password, conf.Config.AesKey)
-	d.EnablePassword, err = utils.AesEncrypt(d.EnablePassword, conf.Config.AesKey)
-	return
+	if err = checkDeviceAccount(d.Name, d.ReadCredentialId, d.WriteCredentialId, d.Username, d.Password); err != nil {
+		return
+	}
+	return d.encrypt(d.Password, d.EnablePassword)
 }
 func (d *TFirewallDevice) AfterUpdate(tx *gorm.DB) (err error) {
 	database.R.Del(d.redisKey())
@@ -86,12 +99,61 @@ func (d *TFirewallDevice) BeforeUpdate(tx *gorm.DB) (err error) {
 	if err = old.FirstById(d.Id); err != nil {
 		return
 	}
-	if old.Password != d.Password {
-		d.Password, err = utils.AesEncrypt(d.Password, conf.Config.AesKey)
+	// 更新时未传的字段保持原值，密码为空时不修改
+	readId, writeId, username := d.ReadCredentialId, d.WriteCredentialId, d.Username
+	if readId == 0 {
+		readId = old.ReadCredentialId
+	}
+	if writeId == 0 {
+		writeId = old.WriteCredentialId
+	}
+	if username == "" {
+		username = old.Username
+	}
+	if d.Password == "" {
+		d.Password = old.Password
+	}
+	if d.EnablePassword == "" {
+		d.EnablePassword = old.EnablePassword
+	}
+	if err = checkDeviceAccount(d.Name, readId, writeId, username, d.Password); err != nil {
+		return
+	}
+	if old.Password == d.Password && old.EnablePassword == d.EnablePassword {
+		d.KeyVersion = old.KeyVersion
+		return
+	}
+	// 两个密码使用同一个密钥版本，未修改的密码先用旧版本解密
+	password, enablePassword := d.Password, d.EnablePassword
+	if old.Password == d.Password {
+		if password, err = utils.DecryptCredential(old.Password, old.KeyVersion); err != nil {
+			return
+		}
+	}
+	if old.EnablePassword == d.EnablePassword {
+		if enablePassword, err = utils.DecryptCredential(old.EnablePassword, old.KeyVersion); err != nil {
+			return
+		}
+	}
+	return d.encrypt(password, enablePassword)
+}
+
+// 只读或读写凭据未关联时使用设备上的账号，必须配置用户名和密码
+func checkDeviceAccount(name string, readCredentialId, writeCredentialId int, username, password string) error {
+	if readCredentialId != 0 && writeCredentialId != 0 {
+		return nil
 	}
-	if old.EnablePassword != d.EnablePassword {
-		d.EnablePassword, err = utils.AesEncrypt(d.EnablePassword, conf.Config.AesKey)
+	if username == "" || password == "" {
+		return fmt.Errorf("设备<%s>未关联只读和读写凭据时必须配置用户名和密码", name)
 	}
+	return nil
+}
+
+func (d *TFirewallDevice) encrypt(password, enablePassword string) (err error) {
+	if d.Password, d.KeyVersion, err = utils.EncryptCredential(password); err != nil {
+		return
+	}
+	d.EnablePassword, _, err = utils.EncryptCredential(enablePassword)
 	return
 }
 func (d *TFirewallDevice) AfterFind(tx *gorm.DB) (err error) {
@@ -114,11 +176,18 @@ type TNLBDevice struct {
 	Port         int    `gorm:"column:port" json:"port"`
 	Username     string `gorm:"column:username" json:"username" binding:"required"`
 	Password     string `gorm:"column:password" json:"password" binding:"required"`
+	KeyVersion   string `gorm:"column:key_version" json:"key_version" binding:"-"` // 密码加密的密钥版本
 	DeviceTypeId int    `gorm:"column:device_type_id" json:"device_type_id" binding:"required"`
 	Enabled      int    `gorm:"column:enabled" json:"enabled"`
 	Region       string `gorm:"-" json:"region" binding:"-"`
 	DeviceType   string `gorm:"-" json:"device_type" binding:"-"`
 	ParseStatus  string `gorm:"parse_status" json:"parse_status"`
+
+	HealthStatus    string     `gorm:"column:health_status;<-:false" json:"health_status" binding:"-"` // up login_failed unreachable
+	HealthFailures  int        `gorm:"column:health_failures;<-:false" json:"health_failures" binding:"-"`
+	HealthLatency   int        `gorm:"column:health_latency;<-:false" json:"health_latency" binding:"-"`
+	HealthMessage   string     `gorm:"column:health_message;<-:false" json:"health_message" binding:"-"`
+	HealthCheckedAt *time.Time `gorm:"column:health_checked_at;<-:false" json:"health_checked_at" binding:"-"`
 }
 
 func (TNLBDevice) TableName() string {
@@ -154,9 +223,9 @@ func (d *TNLBDevice) UpdateParseStatus(status string) error {
 	return nil
 }
 
-// BeforeCreate 创建时，加密密码
+// BeforeCreate 创建时，使用当前密钥版本加密密码
 func (d *TNLBDevice) BeforeCreate(tx *gorm.DB) (err error) {
-	d.Password, err = utils.AesEncrypt(d.Password, conf.Config.AesKey)
+	d.Password, d.KeyVersion, err = utils.EncryptCredential(d.Password)
 	return
 }
 func (d *TNLBDevice) AfterUpdate(tx *gorm.DB) (err error) {
@@ -169,9 +238,11 @@ func (d *TNLBDevice) BeforeUpdate(tx *gorm.DB) (err error) {
 	if err = old.FirstById(d.Id); err != nil {
 		return
 	}
-	if old.Password != d.Password {
-		d.Password, err = utils.AesEncrypt(d.Password, conf.Config.AesKey)
+	if old.Password == d.Password {
+		d.KeyVersion = old.KeyVersion
+		return
 	}
+	d.Password, d.KeyVersion, err = utils.EncryptCredential(d.Password)
 	return
 }
 func (d *TNLBDevice) AfterFind(tx *gorm.DB) (err error) {
@@ -188,11 +259,18 @@ func (d *TNLBDevice) AfterFind(tx *gorm.DB) (err error) {
 
 type TDeviceBackup struct {
 	BaseModel
-	DeviceId int    `gorm:"column:device_id" json:"device_id"`
-	Device   string `gorm:"-" json:"device"`
-	Filename string `gorm:"column:filename" json:"filename"`
-	Md5      string `gorm:"column:md5" json:"md5"`
-	Size     int    `gorm:"column:size" json:"size"`
+	DeviceId      int        `gorm:"column:device_id" json:"device_id"`
+	DeviceType    string     `gorm:"column:device_type;default:firewall" json:"device_type"` // 设备类型: firewall nlb
+	Device        string     `gorm:"-" json:"device"`
+	Filename      string     `gorm:"column:filename" json:"filename"`
+	Md5           string     `gorm:"column:md5" json:"md5"`
+	Md5Version    int        `gorm:"column:md5_version" json:"md5_version"` // 0: 旧版本在压缩完成前计算的md5，无法用于校验; 1: 压缩文件的md5
+	Size          int        `gorm:"column:size" json:"size"`
+	Storage       string     `gorm:"column:storage" json:"storage"`             // 存储类型: minio local s3
+	Encrypted     bool       `gorm:"column:encrypted" json:"encrypted"`         // 是否加密存储
+	VerifyStatus  string     `gorm:"column:verify_status" json:"verify_status"` // 最近一次校验结果: success failed legacy
+	VerifyMessage string     `gorm:"column:verify_message" json:"verify_message"`
+	VerifiedAt    *time.Time `gorm:"column:verified_at" json:"verified_at"`
 }
 
 func (t *TDeviceBackup) FirstById(id int) error {
@@ -209,7 +287,258 @@ func (t *TDeviceBackup) Create() error {
 	return nil
 }
 
+func (t *TDeviceBackup) Delete() error {
+	if e := database.DB.Delete(t).Error; e != nil {
+		return fmt.Errorf("删除备份信息失败, id: %d, err: %w", t.Id, e)
+	}
+	return nil
+}
+
 func (t *TDeviceBackup) AfterFind(tx *gorm.DB) (err error) {
+	if t.DeviceType == conf.DeviceTypeNlb {
+		device := TNLBDevice{}
+		if err = device.QueryById(t.DeviceId); err == nil {
+			t.Device = device.Name
+		}
+		return
+	}
+	device := TFirewallDevice{}
+	if err = device.QueryById(t.DeviceId); err == nil {
+		t.Device = device.Name
+	}
+	return
+}
+
+// TBackupSchedule 按网络区域的定时备份及保留策略
+type TBackupSchedule struct {
+	BaseModel
+	RegionId    int    `gorm:"column:region_id" json:"region_id" binding:"required"`
+	Region      string `gorm:"-" json:"region" binding:"-"`
+	Cron        string `gorm:"column:cron" json:"cron" binding:"required"` // 如 0 2 * * *
+	Concurrency int    `gorm:"column:concurrency" json:"concurrency"`      // 同时备份的设备数
+	KeepDaily   int    `gorm:"column:keep_daily" json:"keep_daily"`        // 保留最近N天每天的最后一次备份
+	KeepWeekly  int    `gorm:"column:keep_weekly" json:"keep_weekly"`      // 保留最近M周每周的最后一次备份
+	KeepMonthly int    `gorm:"column:keep_monthly" json:"keep_monthly"`    // 保留最近K月每月的最后一次备份
+	Enabled     int    `gorm:"column:enabled" json:"enabled"`
+	Description string `gorm:"column:description" json:"description"`
+}
+
+func (TBackupSchedule) TableName() string {
+	return "t_backup_schedule"
+}
+func (t *TBackupSchedule) FirstById(id int) error {
+	return firstById(t, id)
+}
+func (t *TBackupSchedule) FindEnabled() (results []*TBackupSchedule, err error) {
+	if e := database.DB.Where("enabled = 1").Find(&results).Error; e != nil {
+		return nil, fmt.Errorf("获取定时备份配置失败, err: %w", e)
+	}
+	return
+}
+
+func (t *TBackupSchedule) AfterFind(tx *gorm.DB) (err error) {
+	region := TRegion{}
+	if err = region.QueryById(t.RegionId); err == nil {
+		t.Region = region.Name
+	}
+	return
+}
+
+// TBackupRun 定时备份的执行记录
+type TBackupRun struct {
+	BaseModel
+	ScheduleId int        `gorm:"column:schedule_id" json:"schedule_id"`
+	RegionId   int        `gorm:"column:region_id" json:"region_id"`
+	Region     string     `gorm:"-" json:"region"`
+	Status     string     `gorm:"column:status" json:"status"` // running success failed
+	Total      int        `gorm:"column:total" json:"total"`
+	Success    int        `gorm:"column:success" json:"success"`
+	Failed     int        `gorm:"column:failed" json:"failed"`
+	Pruned     int        `gorm:"column:pruned" json:"pruned"` // 按保留策略清理的备份数
+	Detail     string     `gorm:"column:detail" json:"detail"` // 失败设备及原因
+	FinishedAt *time.Time `gorm:"column:finished_at" json:"finished_at"`
+}
+
+func (TBackupRun) TableName() string {
+	return "t_backup_run"
+}
+
+func (t *TBackupRun) AfterFind(tx *gorm.DB) (err error) {
+	region := TRegion{}
+	if err = region.QueryById(t.RegionId); err == nil {
+		t.Region = region.Name
+	}
+	return
+}
+
+// TDeviceZone 设备的安全区域目录，记录区域绑定的接口和接口网段
+type TDeviceZone struct {
+	BaseModel
+	DeviceId    int    `gorm:"column:device_id" json:"device_id" binding:"required"`
+	Device      string `gorm:"-" json:"device" binding:"-"`
+	Name        string `gorm:"column:name" json:"name" binding:"required"`
+	Interface   string `gorm:"column:interface" json:"interface"`
+	Subnet      string `gorm:"column:subnet" json:"subnet"` // 区域内的网段，多个用逗号分隔
+	Description string `gorm:"column:description" json:"description"`
+}
+
+func (TDeviceZone) TableName() string {
+	return "t_device_zone"
+}
+func (t *TDeviceZone) FirstById(id int) error {
+	return firstById(t, id)
+}
+func (t *TDeviceZone) FindByDeviceId(deviceId int) (results []*TDeviceZone, err error) {
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&results).Error; e != nil {
+		return nil, fmt.Errorf("获取设备区域失败, device_id: %d, err: %w", deviceId, e)
+	}
+	return
+}
+
+func (t *TDeviceZone) AfterFind(tx *gorm.DB) (err error) {
+	device := TFirewallDevice{}
+	if err = device.QueryById(t.DeviceId); err == nil {
+		t.Device = device.Name
+	}
+	return
+}
+
+// TCredential 设备凭据，多个设备可以共用，密码按密钥版本加密，backend为vault时从外部读取
+type TCredential struct {
+	BaseModel
+	Name           string `gorm:"column:name" json:"name" binding:"required"`
+	Username       string `gorm:"column:username" json:"username"`
+	Password       string `gorm:"column:password" json:"password"`
+	EnablePassword string `gorm:"column:enable_password" json:"enable_password"`
+	KeyVersion     string `gorm:"column:key_version" json:"key_version" binding:"-"`
+	Backend        string `gorm:"column:backend" json:"backend"`         // 为空时使用本地加密存储，vault使用外部存储
+	SecretPath     string `gorm:"column:secret_path" json:"secret_path"` // 外部存储中的路径
+	Description    string `gorm:"column:description" json:"description"`
+}
+
+func (TCredential) TableName() string {
+	return "t_credential"
+}
+func (t *TCredential) FirstById(id int) error {
+	return firstById(t, id)
+}
+
+// BeforeCreate 创建时，使用当前密钥版本加密密码
+func (t *TCredential) BeforeCreate(tx *gorm.DB) (err error) {
+	return t.encrypt(t.Password, t.EnablePassword)
+}
+
+// BeforeUpdate 密码修改时，使用当前密钥版本重新加密
+func (t *TCredential) BeforeUpdate(tx *gorm.DB) (err error) {
+	old := TCredential{}
+	if err = old.FirstById(t.Id); err != nil {
+		return
+	}
+	if old.Password == t.Password && old.EnablePassword == t.EnablePassword {
+		t.KeyVersion = old.KeyVersion
+		return
+	}
+	// 两个密码使用同一个密钥版本，未修改的密码先用旧版本解密
+	password, enablePassword := t.Password, t.EnablePassword
+	if old.Password == t.Password {
+		if password, err = utils.DecryptCredential(old.Password, old.KeyVersion); err != nil {
+			return
+		}
+	}
+	if old.EnablePassword == t.EnablePassword {
+		if enablePassword, err = utils.DecryptCredential(old.EnablePassword, old.KeyVersion); err != nil {
+			return
+		}
+	}
+	return t.encrypt(password, enablePassword)
+}
+
+func (t *TCredential) BeforeDelete(tx *gorm.DB) (err error) {
+	var count int64
+	if err := database.DB.Model(&TFirewallDevice{}).Where("read_credential_id = ? or write_credential_id = ?", t.Id, t.Id).Count(&count).Error; err != nil {
+		return fmt.Errorf("获取设备信息异常")
+	}
+	if count > 0 {
+		return fmt.Errorf("当前数据已被使用")
+	}
+	return
+}
+
+func (t *TCredential) encrypt(password, enablePassword string) (err error) {
+	if t.Password, t.KeyVersion, err = utils.EncryptCredential(password); err != nil {
+		return
+	}
+	t.EnablePassword, _, err = utils.EncryptCredential(enablePassword)
+	return
+}
+
+const (
+	HealthStatusUp          = "up"
+	HealthStatusLoginFailed = "login_failed"
+	HealthStatusUnreachable = "unreachable"
+)
+
+// TDeviceHealth 设备健康检查历史
+type TDeviceHealth struct {
+	EmptyModel
+	DeviceId     int       `gorm:"column:device_id" json:"device_id"`
+	DeviceType   string    `gorm:"column:device_type;default:firewall" json:"device_type"` // 设备类型: firewall nlb
+	Device       string    `gorm:"-" json:"device"`
+	Status       string    `gorm:"column:status" json:"status"`
+	LoginSuccess bool      `gorm:"column:login_success" json:"login_success"`
+	Latency      int       `gorm:"column:latency" json:"latency"`   // 毫秒
+	Failures     int       `gorm:"column:failures" json:"failures"` // 本次检查后的连续失败次数
+	Message      string    `gorm:"column:message" json:"message"`
+	CheckedAt    time.Time `gorm:"column:checked_at" json:"checked_at"`
+}
+
+func (TDeviceHealth) TableName() string {
+	return "t_device_health"
+}
+
+func (t *TDeviceHealth) AfterFind(tx *gorm.DB) (err error) {
+	if t.DeviceType == conf.DeviceTypeNlb {
+		device := TNLBDevice{}
+		if err = device.QueryById(t.DeviceId); err == nil {
+			t.Device = device.Name
+		}
+		return
+	}
+	device := TFirewallDevice{}
+	if err = device.QueryById(t.DeviceId); err == nil {
+		t.Device = device.Name
+	}
+	return
+}
+
+// TDeviceFacts 设备资产信息，定时通过net_api执行show命令采集，每台设备一条
+type TDeviceFacts struct {
+	EmptyModel
+	DeviceId    int               `gorm:"column:device_id" json:"device_id"`
+	Device      string            `gorm:"-" json:"device"`
+	Vendor      string            `gorm:"column:vendor" json:"vendor"`
+	Model       string            `gorm:"column:model" json:"model"`
+	Version     string            `gorm:"column:version" json:"version"`
+	Serial      string            `gorm:"column:serial" json:"serial"`
+	HaRole      string            `gorm:"column:ha_role" json:"ha_role"` // active standby standalone
+	Uptime      string            `gorm:"column:uptime" json:"uptime"`
+	Interfaces  []*FactsInterface `gorm:"column:interfaces;serializer:json" json:"interfaces"`
+	License     string            `gorm:"column:license" json:"license"`
+	Message     string            `gorm:"column:message" json:"message"` // 采集失败的命令及原因
+	CollectedAt time.Time         `gorm:"column:collected_at" json:"collected_at"`
+}
+
+type FactsInterface struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+}
+
+func (TDeviceFacts) TableName() string {
+	return "t_device_facts"
+}
+
+func (t *TDeviceFacts) AfterFind(tx *gorm.DB) (err error) {
 	device := TFirewallDevice{}
 	if err = device.QueryById(t.DeviceId); err == nil {
 		t.Device = device.Name
@@ -14,6 +14,8 @@ type TDevicePolicy struct {
 	DeviceId  int    `gorm:"column:device_id" json:"device_id" binding:"required"`
 	Name      string `gorm:"column:name" json:"name" binding:"required"`
 	Direction string `gorm:"column:direction" json:"direction" binding:"required"`
+	SrcZone   string `gorm:"column:src_zone" json:"src_zone"`
+	DstZone   string `gorm:"column:dst_zone" json:"dst_zone"`
 	Src       string `gorm:"column:src" json:"src" binding:"required"`
 	SrcGroup  string `gorm:"column:src_group" json:"src_group"`
 	Dst       string `gorm:"column:dst" json:"dst" binding:"required"`
@@ -296,3 +298,249 @@ type TDevicePolicyHitCount struct {
 func (TDevicePolicyHitCount) TableName() string {
 	return "t_device_policy_hit_count"
 }
+
+// TDevicePolicyHitCountHistory 每次采集的策略命中数，用于统计一段时间内的命中情况
+type TDevicePolicyHitCountHistory struct {
+	BaseModel
+	DeviceId    int       `gorm:"column:device_id" json:"device_id"`
+	Name        string    `gorm:"column:name" json:"name"`
+	HitCount    int       `gorm:"column:hit_count" json:"hit_count"` // 设备上的累计命中数
+	Delta       int       `gorm:"column:delta" json:"delta"`         // 与上次采集相比新增的命中数
+	Reset       bool      `gorm:"column:reset" json:"reset"`         // 计数器是否被重置，如设备重启或clear
+	CollectedAt time.Time `gorm:"column:collected_at" json:"collected_at"`
+}
+
+func (TDevicePolicyHitCountHistory) TableName() string {
+	return "t_device_policy_hit_count_history"
+}
+
+// TDevicePolicyChange 策略解析时的变更记录
+type TDevicePolicyChange struct {
+	BaseModel
+	DeviceId   int    `gorm:"column:device_id" json:"device_id"`
+	Device     string `gorm:"-" json:"device"`
+	ObjectType string `gorm:"column:object_type" json:"object_type"` // 变更对象: policy group port nat
+	ObjectKey  string `gorm:"column:object_key" json:"object_key"`   // 对象唯一键
+	ChangeType string `gorm:"column:change_type" json:"change_type"` // 变更类型: added removed modified
+	OldValue   string `gorm:"column:old_value" json:"old_value"`
+	NewValue   string `gorm:"column:new_value" json:"new_value"`
+}
+
+func (TDevicePolicyChange) TableName() string {
+	return "t_device_policy_change"
+}
+
+func (t *TDevicePolicyChange) AfterFind(tx *gorm.DB) (err error) {
+	device := TFirewallDevice{}
+	if err = device.QueryById(t.DeviceId); err == nil {
+		t.Device = device.Name
+	}
+	return
+}
+
+// TDeviceSnapshot 每次策略解析成功后的快照
+type TDeviceSnapshot struct {
+	BaseModel
+	DeviceId    int    `gorm:"column:device_id" json:"device_id"`
+	Device      string `gorm:"-" json:"device"`
+	PolicyCount int    `gorm:"column:policy_count" json:"policy_count"`
+	GroupCount  int    `gorm:"column:group_count" json:"group_count"`
+	PortCount   int    `gorm:"column:port_count" json:"port_count"`
+	NatCount    int    `gorm:"column:nat_count" json:"nat_count"`
+}
+
+func (TDeviceSnapshot) TableName() string {
+	return "t_device_snapshot"
+}
+func (t *TDeviceSnapshot) FirstById(id int) error {
+	return firstById(t, id)
+}
+
+func (t *TDeviceSnapshot) AfterFind(tx *gorm.DB) (err error) {
+	device := TFirewallDevice{}
+	if err = device.QueryById(t.DeviceId); err == nil {
+		t.Device = device.Name
+	}
+	return
+}
+
+// TDeviceSnapshotItem 快照内容，每个策略、地址组、端口、nat一条，content为标准化后的内容
+type TDeviceSnapshotItem struct {
+	Id         int    `gorm:"primary_key" json:"id"`
+	SnapshotId int    `gorm:"column:snapshot_id" json:"snapshot_id"`
+	ObjectType string `gorm:"column:object_type" json:"object_type"`
+	ObjectKey  string `gorm:"column:object_key" json:"object_key"`
+	Content    string `gorm:"column:content" json:"content"`
+}
+
+func (TDeviceSnapshotItem) TableName() string {
+	return "t_device_snapshot_item"
+}
+
+func (t *TDeviceSnapshotItem) FindBySnapshotId(snapshotId int) (results []*TDeviceSnapshotItem, err error) {
+	if e := database.DB.Where("snapshot_id = ?", snapshotId).Order("id").Find(&results).Error; e != nil {
+		return nil, fmt.Errorf("获取快照内容失败, snapshot_id: %d, err: %w", snapshotId, e)
+	}
+	return
+}
+
+// TRiskRule 策略风险规则，为空或为nil的条件不检查，所有条件都满足时命中
+type TRiskRule struct {
+	BaseModel
+	Name        string `gorm:"column:name" json:"name" binding:"required"`
+	Severity    string `gorm:"column:severity" json:"severity" binding:"required"` // high medium low
+	Direction   string `gorm:"column:direction" json:"direction"`                  // inside outside
+	Action      string `gorm:"column:action" json:"action"`                        // permit deny
+	SrcPrefix   *int   `gorm:"column:src_prefix" json:"src_prefix"`                // 源地址中存在掩码不大于该值的网段时命中，0为any
+	DstPrefix   *int   `gorm:"column:dst_prefix" json:"dst_prefix"`                // 目标地址中存在掩码不大于该值的网段时命中
+	SrcNetType  string `gorm:"column:src_net_type" json:"src_net_type"`            // 源地址与该网络类型的网段有交集时命中，多个逗号分隔
+	DstNetType  string `gorm:"column:dst_net_type" json:"dst_net_type"`            // 目标地址与该网络类型的网段有交集时命中，多个逗号分隔
+	Ports       string `gorm:"column:ports" json:"ports"`                          // 端口与该端口集合有交集时命中，如22,3389,1433-1434
+	PortCount   int    `gorm:"column:port_count" json:"port_count"`                // 端口数量不小于该值时命中
+	Enabled     int    `gorm:"column:enabled" json:"enabled"`
+	Description string `gorm:"column:description" json:"description"`
+}
+
+func (TRiskRule) TableName() string {
+	return "t_risk_rule"
+}
+func (t *TRiskRule) FindEnabled() (results []*TRiskRule, err error) {
+	if e := database.DB.Where("enabled = 1").Find(&results).Error; e != nil {
+		return nil, fmt.Errorf("获取风险规则失败, err: %w", e)
+	}
+	return
+}
+
+// TRiskFinding 策略命中风险规则的结果，策略变更或删除后状态为resolved
+type TRiskFinding struct {
+	BaseModel
+	DeviceId    int        `gorm:"column:device_id" json:"device_id"`
+	Device      string     `gorm:"-" json:"device"`
+	RuleId      int        `gorm:"column:rule_id" json:"rule_id"`
+	Rule        string     `gorm:"-" json:"rule"`
+	PolicyId    int        `gorm:"column:policy_id" json:"policy_id"`
+	PolicyName  string     `gorm:"column:policy_name" json:"policy_name"`
+	Direction   string     `gorm:"column:direction" json:"direction"`
+	Line        int        `gorm:"column:line" json:"line"`
+	Fingerprint string     `gorm:"column:fingerprint" json:"fingerprint"` // 策略内容的hash，内容变化后视为新的结果
+	Severity    string     `gorm:"column:severity" json:"severity"`
+	Detail      string     `gorm:"column:detail" json:"detail"`
+	Status      string     `gorm:"column:status" json:"status"` // open acked excepted resolved
+	ExceptionId int        `gorm:"column:exception_id" json:"exception_id"`
+	AckedBy     string     `gorm:"column:acked_by" json:"acked_by"`
+	AckedAt     *time.Time `gorm:"column:acked_at" json:"acked_at"`
+	AckComment  string     `gorm:"column:ack_comment" json:"ack_comment"`
+	ResolvedAt  *time.Time `gorm:"column:resolved_at" json:"resolved_at"`
+}
+
+func (TRiskFinding) TableName() string {
+	return "t_risk_finding"
+}
+
+func (t *TRiskFinding) AfterFind(tx *gorm.DB) (err error) {
+	device := TFirewallDevice{}
+	if err = device.QueryById(t.DeviceId); err == nil {
+		t.Device = device.Name
+	}
+	rule := TRiskRule{}
+	if e := database.DB.Select("name").First(&rule, t.RuleId).Error; e == nil {
+		t.Rule = rule.Name
+	}
+	return
+}
+
+// TRiskException 风险例外，rule_id、device_id为0或policy_name为空时匹配所有，过期后失效
+type TRiskException struct {
+	BaseModel
+	RuleId     int        `gorm:"column:rule_id" json:"rule_id"`
+	DeviceId   int        `gorm:"column:device_id" json:"device_id"`
+	PolicyName string     `gorm:"column:policy_name" json:"policy_name"`
+	Reason     string     `gorm:"column:reason" json:"reason" binding:"required"`
+	ExpiredAt  *time.Time `gorm:"column:expired_at" json:"expired_at"`
+}
+
+func (TRiskException) TableName() string {
+	return "t_risk_exception"
+}
+func (t *TRiskException) FindActive() (results []*TRiskException, err error) {
+	if e := database.DB.Where("expired_at is null or expired_at > ?", time.Now()).Find(&results).Error; e != nil {
+		return nil, fmt.Errorf("获取风险例外失败, err: %w", e)
+	}
+	return
+}
+
+// Match 是否匹配风险结果
+func (t *TRiskException) Match(finding *TRiskFinding) bool {
+	return (t.RuleId == 0 || t.RuleId == finding.RuleId) &&
+		(t.DeviceId == 0 || t.DeviceId == finding.DeviceId) &&
+		(t.PolicyName == "" || t.PolicyName == finding.PolicyName)
+}
+
+// TPolicyDecommission 策略下线记录，先禁用策略，观察期后再删除，观察期内可重新启用
+type TPolicyDecommission struct {
+	BaseModel
+	DeviceId         int        `gorm:"column:device_id" json:"device_id"`
+	Device           string     `gorm:"-" json:"device"`
+	PolicyName       string     `gorm:"column:policy_name" json:"policy_name"`
+	Direction        string     `gorm:"column:direction" json:"direction"`
+	Command          string     `gorm:"column:command" json:"command"` // 下线时的策略配置
+	Source           string     `gorm:"column:source" json:"source"`   // hit_count analysis
+	Reason           string     `gorm:"column:reason" json:"reason"`
+	GraceDays        int        `gorm:"column:grace_days" json:"grace_days"` // 禁用后多少天可以删除
+	Status           string     `gorm:"column:status" json:"status"`         // disabling disabled deleting deleted reactivating reactivated failed
+	DisableTaskId    int        `gorm:"column:disable_task_id" json:"disable_task_id"`
+	DeleteTaskId     int        `gorm:"column:delete_task_id" json:"delete_task_id"`
+	ReactivateTaskId int        `gorm:"column:reactivate_task_id" json:"reactivate_task_id"`
+	DisabledAt       *time.Time `gorm:"column:disabled_at" json:"disabled_at"`
+	FinishedAt       *time.Time `gorm:"column:finished_at" json:"finished_at"` // 删除或重新启用的时间
+}
+
+func (TPolicyDecommission) TableName() string {
+	return "t_policy_decommission"
+}
+func (t *TPolicyDecommission) FirstById(id int) error {
+	return firstById(t, id)
+}
+func (t *TPolicyDecommission) AfterFind(tx *gorm.DB) (err error) {
+	device := TFirewallDevice{}
+	if err = device.QueryById(t.DeviceId); err == nil {
+		t.Device = device.Name
+	}
+	return
+}
+
+// DeleteAt 可以删除的时间
+func (t *TPolicyDecommission) DeleteAt() *time.Time {
+	if t.DisabledAt == nil {
+		return nil
+	}
+	result := t.DisabledAt.AddDate(0, 0, t.GraceDays)
+	return &result
+}
+
+// TDriftFinding 配置漂移结果，对比工单下发的受管对象与设备解析结果
+type TDriftFinding struct {
+	BaseModel
+	DeviceId   int        `gorm:"column:device_id" json:"device_id"`
+	Device     string     `gorm:"-" json:"device"`
+	Type       string     `gorm:"column:type" json:"type"`               // missing modified unmanaged
+	ObjectType string     `gorm:"column:object_type" json:"object_type"` // policy address_group
+	Name       string     `gorm:"column:name" json:"name"`
+	JiraKey    string     `gorm:"column:jira_key" json:"jira_key"`
+	TaskId     int        `gorm:"column:task_id" json:"task_id"`
+	InfoId     int        `gorm:"column:info_id" json:"info_id"`
+	Detail     string     `gorm:"column:detail" json:"detail"`
+	Status     string     `gorm:"column:status" json:"status"` // open resolved
+	ResolvedAt *time.Time `gorm:"column:resolved_at" json:"resolved_at"`
+}
+
+func (TDriftFinding) TableName() string {
+	return "t_drift_finding"
+}
+func (t *TDriftFinding) AfterFind(tx *gorm.DB) (err error) {
+	device := TFirewallDevice{}
+	if err = device.QueryById(t.DeviceId); err == nil {
+		t.Device = device.Name
+	}
+	return
+}
@@ -119,6 +119,8 @@ type TTaskInfo struct {
 	Dst                 string `gorm:"column:dst" json:"dst" binding:"required"`
 	DPort               string `gorm:"column:dport" json:"dport" binding:"required"`
 	Direction           string `gorm:"column:direction" json:"direction" binging:"required"`
+	SrcZone             string `gorm:"column:src_zone" json:"src_zone"` // 指定区域对时按区域生成策略，否则按方向使用设备的入向出向区域
+	DstZone             string `gorm:"column:dst_zone" json:"dst_zone"`
 	OutboundNetworkType string `gorm:"column:outbound_network_type" json:"outbound_network_type"`
 	PoolName            string `gorm:"column:pool_name" json:"pool_name"` // nat策略映射的名称
 	NatName             string `gorm:"column:nat_name" json:"nat_name"`   // srx nat的名称
@@ -130,6 +132,7 @@ type TTaskInfo struct {
 	DeviceId            int    `gorm:"column:device_id" json:"device_id"`
 	Device              string `gorm:"-" json:"device" binding:"-"`
 	Command             string `gorm:"column:command" json:"command"`
+	CommandOnly         bool   `gorm:"column:command_only" json:"command_only"` // 清理、下线等直接下发命令的任务项，没有源目地址，不参与策略生成、查询和漂移检测
 	ExistsConfig        string `gorm:"column:exists_config" json:"exists_config"`
 	Result              string `gorm:"column:result" json:"result"`
 	Status              string `gorm:"column:status" json:"status"`
@@ -80,17 +80,24 @@ type TInvalidPolicyTask struct {
 	DeviceId    int    `gorm:"column:device_id" json:"device_id" binding:"required"`
 	Device      string `gorm:"-" json:"device" binding:"-"`
 	Description string `gorm:"column:description" json:"description" binding:"-"`
+	Cron        string `gorm:"column:cron" json:"cron" binding:"-"` // 定时采集命中数，如 0 3 * * *，为空时不定时采集
 }
 
 func (TInvalidPolicyTask) TableName() string {
 	return "t_invalid_policy_task"
 }
 func (t *TInvalidPolicyTask) FirstById(id int) error {
-	if e := database.DB.Where("id = ?", id).First(t); e != nil {
+	if e := database.DB.Where("id = ?", id).First(t).Error; e != nil {
 		return fmt.Errorf("获取无效策略任务失败, id: %d, err: %w", id, e)
 	}
 	return nil
 }
+func (t *TInvalidPolicyTask) FindScheduled() (results []*TInvalidPolicyTask, err error) {
+	if e := database.DB.Where("cron != ''").Find(&results).Error; e != nil {
+		return nil, fmt.Errorf("获取定时无效策略任务失败, err: %w", e)
+	}
+	return
+}
 
 func (t *TInvalidPolicyTask) AfterFind(tx *gorm.DB) (err error) {
 	region := TRegion{}
@@ -0,0 +1,51 @@
+package credential
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/utils"
+	"strings"
+)
+
+// Backend 外部密钥存储，根据凭据的secret_path读取账号密码
+type Backend interface {
+	Get(path string) (*Secret, error)
+}
+
+var backends = map[string]Backend{
+	"vault": &vaultBackend{},
+}
+
+// Register 注册外部密钥存储，name与凭据的backend字段对应
+func Register(name string, backend Backend) {
+	backends[name] = backend
+}
+
+// HashiCorp Vault kv v2引擎，secret中保存username、password、enable_password
+type vaultBackend struct{}
+
+func (v *vaultBackend) Get(path string) (*Secret, error) {
+	c := conf.Config.Credential.Vault
+	if c.Addr == "" {
+		return nil, fmt.Errorf("未配置vault地址")
+	}
+	mount := c.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	result := struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}{}
+	h := utils.NewHttpHandler(strings.TrimRight(c.Addr, "/"))
+	h.SetHeaders(map[string]string{"X-Vault-Token": c.Token})
+	if e := h.Get(fmt.Sprintf("/v1/%s/data/%s", mount, strings.TrimLeft(path, "/")), nil, &result); e != nil {
+		return nil, e
+	}
+	data := result.Data.Data
+	if data["password"] == "" {
+		return nil, fmt.Errorf("vault路径<%s>中没有password", path)
+	}
+	return &Secret{Username: data["username"], Password: data["password"], EnablePassword: data["enable_password"]}, nil
+}
@@ -0,0 +1,106 @@
+package credential
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/model"
+	"netops/utils"
+)
+
+const (
+	PurposeRead  = "read"  // 解析、备份等只读操作
+	PurposeWrite = "write" // 下发配置
+)
+
+// Account 发送给net_api的账号，密码使用aes_key加密，与net_api约定的加密方式一致
+type Account struct {
+	Username       string
+	Password       string
+	EnablePassword string
+}
+
+// Resolve 根据用途获取设备的账号，设备未关联凭据时使用设备上配置的账号
+func Resolve(device *model.TFirewallDevice, purpose string) (*Account, error) {
+	credentialId := device.ReadCredentialId
+	if purpose == PurposeWrite {
+		credentialId = device.WriteCredentialId
+	}
+	if credentialId == 0 {
+		if device.Username == "" {
+			return nil, fmt.Errorf("设备<%s>未配置账号或%s凭据", device.Name, purpose)
+		}
+		password, e := utils.DecryptCredential(device.Password, device.KeyVersion)
+		if e != nil {
+			return nil, fmt.Errorf("设备<%s>密码解密失败, err: %w", device.Name, e)
+		}
+		enablePassword, e := utils.DecryptCredential(device.EnablePassword, device.KeyVersion)
+		if e != nil {
+			return nil, fmt.Errorf("设备<%s>密码解密失败, err: %w", device.Name, e)
+		}
+		return (&Secret{Username: device.Username, Password: password, EnablePassword: enablePassword}).account()
+	}
+	c := &model.TCredential{}
+	if e := c.FirstById(credentialId); e != nil {
+		return nil, fmt.Errorf("获取设备<%s>的%s凭据失败, err: %w", device.Name, purpose, e)
+	}
+	secret, e := load(c)
+	if e != nil {
+		return nil, e
+	}
+	return secret.account()
+}
+
+// ResolveNlb 获取负载均衡设备的账号
+func ResolveNlb(device *model.TNLBDevice) (*Account, error) {
+	password, e := utils.DecryptCredential(device.Password, device.KeyVersion)
+	if e != nil {
+		return nil, fmt.Errorf("设备<%s>密码解密失败, err: %w", device.Name, e)
+	}
+	return (&Secret{Username: device.Username, Password: password}).account()
+}
+
+// Secret 明文的账号密码，只在内存中使用
+type Secret struct {
+	Username       string
+	Password       string
+	EnablePassword string
+}
+
+func (s *Secret) account() (*Account, error) {
+	password, e := utils.AesEncrypt(s.Password, conf.Config.AesKey)
+	if e != nil {
+		return nil, fmt.Errorf("加密设备密码失败, err: %w", e)
+	}
+	enablePassword, e := utils.AesEncrypt(s.EnablePassword, conf.Config.AesKey)
+	if e != nil {
+		return nil, fmt.Errorf("加密设备密码失败, err: %w", e)
+	}
+	return &Account{Username: s.Username, Password: password, EnablePassword: enablePassword}, nil
+}
+
+// 读取凭据的明文，本地存储按密钥版本解密，外部存储从backend读取
+func load(c *model.TCredential) (*Secret, error) {
+	if c.Backend != "" {
+		backend, ok := backends[c.Backend]
+		if !ok {
+			return nil, fmt.Errorf("凭据<%s>的存储<%s>不存在", c.Name, c.Backend)
+		}
+		secret, e := backend.Get(c.SecretPath)
+		if e != nil {
+			return nil, fmt.Errorf("从%s读取凭据<%s>失败, err: %w", c.Backend, c.Name, e)
+		}
+		if secret.Username == "" {
+			secret.Username = c.Username
+		}
+		return secret, nil
+	}
+	password, e := utils.DecryptCredential(c.Password, c.KeyVersion)
+	if e != nil {
+		return nil, fmt.Errorf("凭据<%s>解密失败, err: %w", c.Name, e)
+	}
+	enablePassword, e := utils.DecryptCredential(c.EnablePassword, c.KeyVersion)
+	if e != nil {
+		return nil, fmt.Errorf("凭据<%s>解密失败, err: %w", c.Name, e)
+	}
+	return &Secret{Username: c.Username, Password: password, EnablePassword: enablePassword}, nil
+}
@@ -0,0 +1,140 @@
+package credential
+
+import (
+	"fmt"
+	"netops/database"
+	"netops/model"
+	"netops/utils"
+
+	"go.uber.org/zap"
+)
+
+// Rotate 把非当前密钥版本加密的凭据和设备密码重新加密，逐条更新，服务运行中也可以执行
+// 旧版本密钥需要保留在配置中直到轮换完成，返回重新加密的凭据和设备数
+func Rotate() (int, error) {
+	version := utils.ActiveKeyVersion()
+	if _, e := utils.CredentialKey(version); e != nil {
+		return 0, e
+	}
+	credentials := make([]*model.TCredential, 0)
+	if e := database.DB.Where("(backend = '' or backend is null) and (key_version <> ? or key_version is null)", version).
+		Find(&credentials).Error; e != nil {
+		return 0, fmt.Errorf("获取待轮换的凭据失败, err: %w", e)
+	}
+	count := 0
+	for _, c := range credentials {
+		ok, e := rotate(c, version)
+		if e != nil {
+			return count, e
+		}
+		if !ok {
+			zap.L().Warn("凭据在轮换期间已修改, 跳过", zap.String("name", c.Name))
+			continue
+		}
+		zap.L().Info("凭据密钥轮换完成", zap.String("name", c.Name), zap.String("key_version", version))
+		count++
+	}
+	n, e := rotateFirewallDevices(version)
+	count += n
+	if e != nil {
+		return count, e
+	}
+	n, e = rotateNlbDevices(version)
+	count += n
+	return count, e
+}
+
+// 使用旧版本解密后用新版本加密，按旧版本条件更新，避免覆盖轮换期间修改的密码
+func rotate(c *model.TCredential, version string) (bool, error) {
+	secret, e := load(c)
+	if e != nil {
+		return false, e
+	}
+	password, _, e := utils.EncryptCredential(secret.Password)
+	if e != nil {
+		return false, e
+	}
+	enablePassword, _, e := utils.EncryptCredential(secret.EnablePassword)
+	if e != nil {
+		return false, e
+	}
+	r := database.DB.Model(&model.TCredential{}).
+		Where("id = ? and password = ? and key_version = ?", c.Id, c.Password, c.KeyVersion).
+		UpdateColumns(map[string]any{"password": password, "enable_password": enablePassword, "key_version": version})
+	if r.Error != nil {
+		return false, fmt.Errorf("更新凭据<%s>失败, err: %w", c.Name, r.Error)
+	}
+	return r.RowsAffected > 0, nil
+}
+
+// 设备上配置的账号密码，按旧版本条件更新
+func rotateFirewallDevices(version string) (int, error) {
+	devices := make([]*model.TFirewallDevice, 0)
+	if e := database.DB.Where("key_version <> ? or key_version is null", version).Find(&devices).Error; e != nil {
+		return 0, fmt.Errorf("获取待轮换的设备失败, err: %w", e)
+	}
+	count := 0
+	for _, d := range devices {
+		password, e := reEncrypt(d.Password, d.KeyVersion)
+		if e != nil {
+			return count, fmt.Errorf("设备<%s>密码轮换失败, err: %w", d.Name, e)
+		}
+		enablePassword, e := reEncrypt(d.EnablePassword, d.KeyVersion)
+		if e != nil {
+			return count, fmt.Errorf("设备<%s>密码轮换失败, err: %w", d.Name, e)
+		}
+		r := database.DB.Model(&model.TFirewallDevice{}).
+			Where("id = ? and password = ? and key_version = ?", d.Id, d.Password, d.KeyVersion).
+			UpdateColumns(map[string]any{"password": password, "enable_password": enablePassword, "key_version": version})
+		if r.Error != nil {
+			return count, fmt.Errorf("更新设备<%s>失败, err: %w", d.Name, r.Error)
+		}
+		if r.RowsAffected == 0 {
+			zap.L().Warn("设备密码在轮换期间已修改, 跳过", zap.String("name", d.Name))
+			continue
+		}
+		zap.L().Info("设备密码密钥轮换完成", zap.String("name", d.Name), zap.String("key_version", version))
+		count++
+	}
+	return count, nil
+}
+
+func rotateNlbDevices(version string) (int, error) {
+	devices := make([]*model.TNLBDevice, 0)
+	if e := database.DB.Where("key_version <> ? or key_version is null", version).Find(&devices).Error; e != nil {
+		return 0, fmt.Errorf("获取待轮换的负载均衡设备失败, err: %w", e)
+	}
+	count := 0
+	for _, d := range devices {
+		password, e := reEncrypt(d.Password, d.KeyVersion)
+		if e != nil {
+			return count, fmt.Errorf("设备<%s>密码轮换失败, err: %w", d.Name, e)
+		}
+		r := database.DB.Model(&model.TNLBDevice{}).
+			Where("id = ? and password = ? and key_version = ?", d.Id, d.Password, d.KeyVersion).
+			UpdateColumns(map[string]any{"password": password, "key_version": version})
+		if r.Error != nil {
+			return count, fmt.Errorf("更新设备<%s>失败, err: %w", d.Name, r.Error)
+		}
+		if r.RowsAffected == 0 {
+			zap.L().Warn("设备密码在轮换期间已修改, 跳过", zap.String("name", d.Name))
+			continue
+		}
+		zap.L().Info("设备密码密钥轮换完成", zap.String("name", d.Name), zap.String("key_version", version))
+		count++
+	}
+	return count, nil
+}
+
+// 使用旧版本解密后用当前版本加密，未配置的密码保持为空
+func reEncrypt(text, version string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	plain, e := utils.DecryptCredential(text, version)
+	if e != nil {
+		return "", e
+	}
+	result, _, e := utils.EncryptCredential(plain)
+	return result, e
+}
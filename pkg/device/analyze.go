@@ -0,0 +1,519 @@
+package device
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"netops/database"
+	"netops/model"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FindingShadow    = "shadow"    // 被前面的策略完全覆盖，永远不会被匹配
+	FindingRedundant = "redundant" // 被后面相同动作的策略完全覆盖，且中间没有相反动作的策略，删除后不影响访问
+	FindingMerge     = "merge"     // 与另一条相同动作的策略只有一个维度不同，可以合并
+)
+
+// PolicyFinding 策略分析结果，Cover开头的字段为覆盖或可合并的策略
+type PolicyFinding struct {
+	Type        string `json:"type"`
+	PolicyId    int    `json:"policy_id"`
+	Name        string `json:"name"`
+	Line        int    `json:"line"`
+	Direction   string `json:"direction"`
+	Action      string `json:"action"`
+	CoverId     int    `json:"cover_id"`
+	CoverName   string `json:"cover_name"`
+	CoverLine   int    `json:"cover_line"`
+	CoverAction string `json:"cover_action"`
+	SameAction  bool   `json:"same_action"`
+	Field       string `json:"field"` // 可合并时不同的维度: src dst port
+	Description string `json:"description"`
+}
+
+// PolicyAnalysis 设备策略分析结果，Inactive为未生效的策略数，Skipped为地址或端口无法解析而未参与分析的策略数
+type PolicyAnalysis struct {
+	DeviceId int              `json:"device_id"`
+	Device   string           `json:"device"`
+	Total    int              `json:"total"`
+	Inactive int              `json:"inactive"`
+	Skipped  int              `json:"skipped"`
+	Findings []*PolicyFinding `json:"findings"`
+	Commands string           `json:"commands"`
+}
+
+// AnalyzePolicy 分析设备策略中被覆盖、冗余和可合并的策略，并生成清理命令
+func AnalyzePolicy(deviceId int) (*PolicyAnalysis, error) {
+	device := model.TFirewallDevice{}
+	if e := device.FirstById(deviceId); e != nil {
+		return nil, e
+	}
+	deviceType := model.TDeviceType{}
+	if e := deviceType.FirstById(device.DeviceTypeId); e != nil {
+		return nil, e
+	}
+	vendor := strings.ToLower(deviceType.Name)
+	policies := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Order("line, id").Find(&policies).Error; e != nil {
+		return nil, fmt.Errorf("获取设备策略失败, device_id: %d, err: %w", deviceId, e)
+	}
+	ports := make([]*model.TDevicePort, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&ports).Error; e != nil {
+		return nil, fmt.Errorf("获取设备端口失败, device_id: %d, err: %w", deviceId, e)
+	}
+	portM := devicePortMap(ports)
+	result := &PolicyAnalysis{DeviceId: deviceId, Device: device.Name, Total: len(policies), Findings: make([]*PolicyFinding, 0)}
+	// 按方向分组，不同方向的策略互不影响；ASA其他的access-list没有方向，按名称分组
+	groups, keys := make(map[string][]*analyzeRule), make([]string, 0)
+	for _, v := range policies {
+		// 未生效的策略不参与分析，既不会被清理，也不能作为覆盖其他策略的策略
+		if policyInactive(vendor, v) {
+			result.Inactive++
+			continue
+		}
+		r, ok := newAnalyzeRule(v, portM)
+		if !ok {
+			result.Skipped++
+			continue
+		}
+		k := v.Direction
+		if k == "" {
+			k = "acl:" + v.Name
+		}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], r)
+	}
+	for _, k := range keys {
+		result.Findings = append(result.Findings, analyzeRules(groups[k])...)
+	}
+	commands, e := geneCleanupCommands(vendor, policies, result.Findings)
+	if e != nil {
+		return nil, e
+	}
+	result.Commands = commands
+	return result, nil
+}
+
+// 参与分析的策略，地址和端口转换为合并后的区间
+type analyzeRule struct {
+	policy      *model.TDevicePolicy
+	anyProtocol bool
+	src         []span[[16]byte]
+	dst         []span[[16]byte]
+	ports       []span[int]
+}
+
+func newAnalyzeRule(p *model.TDevicePolicy, portM map[string]string) (*analyzeRule, bool) {
+	r := &analyzeRule{policy: p}
+	protocol := strings.ToLower(p.Protocol)
+	// srx的协议定义在应用中，策略上为空，视为任意协议
+	r.anyProtocol = protocol == "" || protocol == "ip" || isAny(protocol)
+	var ok bool
+	if r.src, ok = parseAddressSpans(p.Src); !ok {
+		return nil, false
+	}
+	if r.dst, ok = parseAddressSpans(p.Dst); !ok {
+		return nil, false
+	}
+	if protocol == "ip" {
+		r.ports = []span[int]{{0, 65535}}
+		return r, true
+	}
+	if r.ports = parseRulePorts(p.Port, portM); r.ports == nil {
+		return nil, false
+	}
+	return r, true
+}
+
+// 同一条策略拆分出的多行，如srx一条策略多个应用
+func (r *analyzeRule) samePolicy(o *analyzeRule) bool {
+	return r.policy.Name == o.policy.Name && r.policy.Line == o.policy.Line
+}
+func (r *analyzeRule) sameAction(o *analyzeRule) bool {
+	return r.policy.Action == o.policy.Action
+}
+func (r *analyzeRule) protocolCovers(o *analyzeRule) bool {
+	return r.anyProtocol || (!o.anyProtocol && strings.EqualFold(r.policy.Protocol, o.policy.Protocol))
+}
+func (r *analyzeRule) protocolEqual(o *analyzeRule) bool {
+	return r.anyProtocol == o.anyProtocol && (r.anyProtocol || strings.EqualFold(r.policy.Protocol, o.policy.Protocol))
+}
+
+// covers 当前策略是否完全包含o
+func (r *analyzeRule) covers(o *analyzeRule) bool {
+	return r.protocolCovers(o) && spansCover(r.src, o.src, compareIP) && spansCover(r.dst, o.dst, compareIP) && spansCover(r.ports, o.ports, compareInt)
+}
+
+// intersects 当前策略与o是否有交集
+func (r *analyzeRule) intersects(o *analyzeRule) bool {
+	if !r.protocolCovers(o) && !o.protocolCovers(r) {
+		return false
+	}
+	return spansIntersect(r.src, o.src, compareIP) && spansIntersect(r.dst, o.dst, compareIP) && spansIntersect(r.ports, o.ports, compareInt)
+}
+
+// 可以合并时返回不同的维度
+func (r *analyzeRule) mergeField(o *analyzeRule) (string, bool) {
+	if !r.protocolEqual(o) {
+		return "", false
+	}
+	src, dst, port := spansEqual(r.src, o.src), spansEqual(r.dst, o.dst), spansEqual(r.ports, o.ports)
+	switch {
+	case src && dst && !port:
+		return "port", true
+	case src && !dst && port:
+		return "dst", true
+	case !src && dst && port:
+		return "src", true
+	}
+	return "", false
+}
+
+// 分析同一分组内按顺序排列的策略
+func analyzeRules(rules []*analyzeRule) []*PolicyFinding {
+	results := make([]*PolicyFinding, 0)
+	flagged := make([]bool, len(rules))
+	// 1. 被前面策略完全覆盖的策略
+	for j := range rules {
+		for i := 0; i < j; i++ {
+			if rules[i].samePolicy(rules[j]) || !rules[i].covers(rules[j]) {
+				continue
+			}
+			flagged[j] = true
+			f := newPolicyFinding(FindingShadow, rules[j], rules[i])
+			if f.SameAction {
+				f.Description = fmt.Sprintf("被第%d行策略%s完全覆盖, 动作相同, 策略不会被匹配", f.CoverLine, f.CoverName)
+			} else {
+				f.Description = fmt.Sprintf("被第%d行策略%s完全覆盖, 动作相反, 策略不会生效", f.CoverLine, f.CoverName)
+			}
+			results = append(results, f)
+			break
+		}
+	}
+	// 2. 被后面相同动作的策略覆盖，且中间没有与其相交的相反动作策略
+	for i := range rules {
+		if flagged[i] {
+			continue
+		}
+		for j := i + 1; j < len(rules); j++ {
+			if rules[i].samePolicy(rules[j]) {
+				continue
+			}
+			if !rules[j].sameAction(rules[i]) {
+				if rules[j].intersects(rules[i]) {
+					break
+				}
+				continue
+			}
+			if !rules[j].covers(rules[i]) {
+				continue
+			}
+			flagged[i] = true
+			f := newPolicyFinding(FindingRedundant, rules[i], rules[j])
+			f.Description = fmt.Sprintf("被第%d行相同动作的策略%s完全覆盖, 删除后不影响访问", f.CoverLine, f.CoverName)
+			results = append(results, f)
+			break
+		}
+	}
+	// 3. 相同动作且只有一个维度不同的策略
+	for i := range rules {
+		if flagged[i] {
+			continue
+		}
+		for j := i + 1; j < len(rules); j++ {
+			if rules[i].samePolicy(rules[j]) {
+				continue
+			}
+			if !rules[j].sameAction(rules[i]) {
+				if rules[j].intersects(rules[i]) {
+					break
+				}
+				continue
+			}
+			if flagged[j] {
+				continue
+			}
+			field, ok := rules[i].mergeField(rules[j])
+			if !ok {
+				continue
+			}
+			flagged[j] = true
+			f := newPolicyFinding(FindingMerge, rules[j], rules[i])
+			f.Field = field
+			f.Description = fmt.Sprintf("与第%d行策略%s只有%s不同, 可以合并", f.CoverLine, f.CoverName, field)
+			results = append(results, f)
+			break
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Line < results[j].Line
+	})
+	return results
+}
+
+func newPolicyFinding(typ string, rule, cover *analyzeRule) *PolicyFinding {
+	return &PolicyFinding{
+		Type:        typ,
+		PolicyId:    rule.policy.Id,
+		Name:        rule.policy.Name,
+		Line:        rule.policy.Line,
+		Direction:   rule.policy.Direction,
+		Action:      rule.policy.Action,
+		CoverId:     cover.policy.Id,
+		CoverName:   cover.policy.Name,
+		CoverLine:   cover.policy.Line,
+		CoverAction: cover.policy.Action,
+		SameAction:  rule.sameAction(cover),
+	}
+}
+
+var srxPolicyCmdReg = regexp.MustCompile(`^set (security policies (?:from-zone \S+ to-zone \S+|global) policy \S+)`)
+
+/*
+生成清理命令，只清理被覆盖和冗余的策略，可合并的策略需要人工确认
+srx、h3c、huawei一条策略会按应用拆分为多行，所有行都可以删除时才删除该策略
+*/
+func geneCleanupCommands(vendor string, policies []*model.TDevicePolicy, findings []*PolicyFinding) (string, error) {
+	removable := make(map[int]bool)
+	for _, v := range findings {
+		if v.Type == FindingShadow || v.Type == FindingRedundant {
+			removable[v.PolicyId] = true
+		}
+	}
+	units, keys := make(map[string][]*model.TDevicePolicy), make([]string, 0)
+	for _, v := range policies {
+		k := fmt.Sprintf("%s|%d", v.Name, v.Line)
+		if _, ok := units[k]; !ok {
+			keys = append(keys, k)
+		}
+		units[k] = append(units[k], v)
+	}
+	targets, ipTypes := make([]*model.TDevicePolicy, 0), make(map[int]string)
+	for _, k := range keys {
+		all := true
+		for _, v := range units[k] {
+			if !removable[v.Id] {
+				all = false
+				break
+			}
+		}
+		if all {
+			targets = append(targets, units[k][0])
+			ipTypes[units[k][0].Id] = h3cPolicyIpType(units[k])
+		}
+	}
+	if len(targets) == 0 {
+		return "", nil
+	}
+	builder := strings.Builder{}
+	switch vendor {
+	case "asa":
+		for _, v := range targets {
+			builder.WriteString(fmt.Sprintf("no %s\n", strings.TrimSpace(strings.Split(v.Command, "\n")[0])))
+		}
+	case "srx":
+		for _, v := range targets {
+			if m := srxPolicyCmdReg.FindStringSubmatch(strings.TrimSpace(v.Command)); m != nil {
+				builder.WriteString(fmt.Sprintf("delete %s\n", m[1]))
+			}
+		}
+	case "h3c":
+		// ipv4和ipv6策略在不同的视图下
+		for _, ipType := range []string{"ip", "ipv6"} {
+			names := make([]string, 0)
+			for _, v := range targets {
+				if ipTypes[v.Id] == ipType {
+					names = append(names, v.Name)
+				}
+			}
+			if len(names) == 0 {
+				continue
+			}
+			builder.WriteString(fmt.Sprintf("security-policy %s\n", ipType))
+			for _, name := range names {
+				builder.WriteString(fmt.Sprintf(" undo rule name %s\n", name))
+			}
+			builder.WriteString("quit\n")
+		}
+	case "huawei":
+		builder.WriteString("security-policy\n")
+		for _, v := range targets {
+			builder.WriteString(fmt.Sprintf(" undo rule name %s\n", v.Name))
+		}
+		builder.WriteString("quit\n")
+	default:
+		return "", fmt.Errorf("暂不支持当前类型的设备生成清理命令, 设备类型: %s", vendor)
+	}
+	return builder.String(), nil
+}
+
+// 区间，start和end都包含在内
+type span[T any] struct {
+	start T
+	end   T
+}
+
+func compareIP(a, b [16]byte) int {
+	return bytes.Compare(a[:], b[:])
+}
+func compareInt(a, b int) int {
+	return a - b
+}
+
+// 解析逗号分隔的地址，支持any、单个地址、带掩码的网段和start-end地址段
+func parseAddressSpans(text string) ([]span[[16]byte], bool) {
+	results := make([]span[[16]byte], 0)
+	for _, v := range strings.Split(text, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if isAny(strings.ToLower(v)) {
+			results = append(results, span[[16]byte]{[16]byte{}, maxIP})
+			continue
+		}
+		s, ok := parseAddressSpan(v)
+		if !ok {
+			return nil, false
+		}
+		results = append(results, s)
+	}
+	if len(results) == 0 {
+		return nil, false
+	}
+	return mergeSpans(results, compareIP, nextIP), true
+}
+
+func parseAddressSpan(text string) (span[[16]byte], bool) {
+	result := span[[16]byte]{}
+	if strings.Contains(text, "/") {
+		_, n, e := net.ParseCIDR(text)
+		if e != nil {
+			return result, false
+		}
+		end := make(net.IP, len(n.IP))
+		for i := range n.IP {
+			end[i] = n.IP[i] | ^n.Mask[i]
+		}
+		copy(result.start[:], n.IP.To16())
+		copy(result.end[:], end.To16())
+		return result, true
+	}
+	items := strings.Split(text, "-")
+	start, end := net.ParseIP(strings.TrimSpace(items[0])), net.ParseIP(strings.TrimSpace(items[len(items)-1]))
+	if len(items) > 2 || start == nil || end == nil {
+		return result, false
+	}
+	copy(result.start[:], start.To16())
+	copy(result.end[:], end.To16())
+	return result, compareIP(result.start, result.end) <= 0
+}
+
+func nextIP(ip [16]byte) [16]byte {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+		if ip[i] != 0 {
+			break
+		}
+	}
+	return ip
+}
+
+// 解析逗号分隔的端口，支持any、单个端口、端口名和start-end端口段
+func parsePortSpans(text string) ([]span[int], bool) {
+	results := make([]span[int], 0)
+	for _, v := range strings.Split(text, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if p, ok := PortMaps[v]; ok {
+			v = p
+		}
+		if isAny(strings.ToLower(v)) {
+			results = append(results, span[int]{0, 65535})
+			continue
+		}
+		items := strings.Split(v, "-")
+		if len(items) > 2 {
+			return nil, false
+		}
+		start, e := strconv.Atoi(strings.TrimSpace(items[0]))
+		if e != nil {
+			return nil, false
+		}
+		end, e := strconv.Atoi(strings.TrimSpace(items[len(items)-1]))
+		if e != nil || start > end {
+			return nil, false
+		}
+		results = append(results, span[int]{start, end})
+	}
+	if len(results) == 0 {
+		return nil, false
+	}
+	return mergeSpans(results, compareInt, func(v int) int { return v + 1 }), true
+}
+
+// 排序并合并重叠或相邻的区间
+func mergeSpans[T any](items []span[T], cmp func(a, b T) int, next func(T) T) []span[T] {
+	sort.Slice(items, func(i, j int) bool {
+		return cmp(items[i].start, items[j].start) < 0
+	})
+	results := make([]span[T], 0, len(items))
+	for _, v := range items {
+		if n := len(results); n > 0 {
+			last := &results[n-1]
+			if cmp(v.start, last.end) <= 0 || cmp(v.start, next(last.end)) == 0 {
+				if cmp(v.end, last.end) > 0 {
+					last.end = v.end
+				}
+				continue
+			}
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+// a是否包含b中的所有区间，a和b均为合并后的区间
+func spansCover[T any](a, b []span[T], cmp func(a, b T) int) bool {
+	for _, v := range b {
+		i := sort.Search(len(a), func(i int) bool {
+			return cmp(a[i].end, v.start) >= 0
+		})
+		if i == len(a) || cmp(a[i].start, v.start) > 0 || cmp(a[i].end, v.end) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func spansIntersect[T any](a, b []span[T], cmp func(a, b T) int) bool {
+	for _, v := range b {
+		i := sort.Search(len(a), func(i int) bool {
+			return cmp(a[i].end, v.start) >= 0
+		})
+		if i < len(a) && cmp(a[i].start, v.end) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func spansEqual[T comparable](a, b []span[T]) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -10,7 +10,6 @@ import (
 	net_api2 "netops/grpc_client/protobuf/net_api"
 	"netops/model"
 	"netops/utils"
-	"os"
 	"strconv"
 	"strings"
 )
@@ -32,14 +31,22 @@ func (a *AsaHandler) init() {
 
 func (a *AsaHandler) ParseConfig() {
 	a.addLog("<-------开始解析设备策略------->")
+	if e := a.selectActive(); e != nil {
+		a.operateLog.Status = "failed"
+		a.addLog(e.Error())
+		_ = a.device.UpdateParseStatus(ParseStatusFailed)
+		return
+	}
+	if a.host != "" {
+		a.addLog("HA主设备: %s", a.host)
+	}
 	if e := a.parse(); e != nil {
 		a.operateLog.Status = "failed"
 		a.addLog(e.Error())
 		_ = a.device.UpdateParseStatus(ParseStatusFailed)
 		return
 	}
-	_ = a.device.UpdateParseStatus(ParseStatusSuccess)
-	a.addLog("<-------解析策略完成------->")
+	a.parseSuccess()
 }
 func (a *AsaHandler) Search(info *model.TTaskInfo) (*model.TDevicePolicy, error) {
 	if a.error != nil {
@@ -47,12 +54,6 @@ func (a *AsaHandler) Search(info *model.TTaskInfo) (*model.TDevicePolicy, error)
 	}
 	l := zap.L().With(zap.String("func", "Search"), zap.Int("info_id", info.Id))
 	l.Debug("策略查询--->", zap.Any("device", a.device), zap.Any("info", info))
-	var (
-		result    *model.TDevicePolicy
-		db        *gorm.DB
-		portNames []string
-		err       error
-	)
 	if info.StaticIp != "" {
 		l.Debug("若需要做nat，先校验nat是否存在--->")
 		if nat := a.SearchNat(info); nat == nil {
@@ -60,66 +61,7 @@ func (a *AsaHandler) Search(info *model.TTaskInfo) (*model.TDevicePolicy, error)
 			return nil, nil
 		}
 	}
-	l.Info("2. 根据源目地址模糊匹配符合条件的策略--->")
-	// 如果是办公网需求，则另加查询条件，办公网对比规则, 源地址组是办公网，目标地址包含，协议相同
-	db = database.DB.Where("device_id = ? and dst like ? and protocol in ? and direction = ? and action = ?",
-		a.DeviceId, "%"+info.Dst+"%", []string{info.Protocol, "ip"}, info.Direction, "permit")
-	if info.Direction == "inside" && (info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6) {
-		db = db.Where("src_group = ?", info.Src)
-	} else {
-		// 正常逻辑校验规则，源地址包含，目标地址包含，协议相同，方向相同，并且已开通的
-		db = db.Where("src like ?", "%"+info.Src+"%")
-	}
-	if info.Protocol != "ip" {
-		l.Debug("根据端口和协议获取端口所在的组--------->")
-		if portNames, err = a.getPortName(info.DPort); err != nil {
-			l.Error(err.Error())
-			return nil, err
-		}
-		l.Debug("根据port和port_names过滤", zap.String("port", info.DPort), zap.Any("port_names", portNames))
-		db = db.Where("port = ? or port = ? or port_group in ?", "any", info.DPort, portNames)
-	}
-	policies := make([]*model.TDevicePolicy, 0)
-	db = db.Find(&policies)
-	if db.Error != nil {
-		return nil, fmt.Errorf("查询策略表失败, err: %w", db.Error)
-	}
-	if len(policies) > 0 {
-		result = policies[0]
-		l.Debug("匹配到的策略--->", zap.Any("result", result))
-		return result, nil
-	} else {
-		l.Debug("3. 根据基本信息未匹配到相应的策略，开始进行网段的匹配------->")
-		// 如果没有匹配的策略，则获取所有地址组，根据地址组来查询
-		// 先获取源地址为网段的策略信息
-		l.Debug("先根据基本条件进行过滤------------>")
-		subnetPolicies := make([]*model.TDevicePolicy, 0)
-		db = database.DB.Where("action = ? and device_id = ? and direction = ? and protocol in ?",
-			"permit", a.DeviceId, info.Direction, []string{info.Protocol, "ip"})
-		if info.Protocol != "ip" {
-			db = db.Where("port = ? or port = ? or port_group in ?", "any", info.DPort, portNames)
-		}
-		if e1 := db.Find(&subnetPolicies).Error; e1 != nil {
-			return nil, fmt.Errorf("查询策略地址组失败, err: %w", e1)
-		}
-		// 根据源目地址找到符合条件的策略
-		l.Debug("4. 根据源目地址从策略表中匹配策略--------->")
-		policies = a.getSubnetPolicy(subnetPolicies, info.Src, info.Dst)
-		if len(policies) > 0 {
-			// 办公网直接取第一条
-			if info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6 {
-				result = policies[0]
-			} else {
-				// 匹配出最小的策略
-				l.Debug("根据匹配到的网段策略, 获取范围最小的策略信息-------->")
-				result = a.getPolicy(policies, info.Src, info.Dst)
-				l.Debug("匹配到的策略--->", zap.Any("result", result))
-			}
-			return result, nil
-		}
-	}
-	l.Info("<-------策略查询结束------->")
-	return nil, nil
+	return a.searchPolicy(info)
 }
 func (a *AsaHandler) GetCommand(dp *model.TDevicePolicy) string {
 	return dp.Command
@@ -338,25 +280,6 @@ func (a *AsaHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 	return strings.Join(commands, "\n"), nil
 }
 
-// 返回组名
-func (a *AsaHandler) getPortName(port string) (results []string, err error) {
-	p, err := utils.ParseRangePort(port)
-	if err != nil {
-		return
-	}
-	ports := make([]model.TDevicePort, 0)
-	db := database.DB.Where("device_id = ? and start <= ? and end >= ?", a.DeviceId, p.Start, p.End).Find(&ports)
-	if db.Error != nil {
-		return nil, fmt.Errorf("根据port<%s>获取端口组异常: <%s>", port, db.Error.Error())
-	}
-	results = make([]string, 0)
-	for _, p := range ports {
-		results = append(results, p.Name)
-	}
-	results = append(results, "any")
-	return results, nil
-}
-
 // CheckNat 校验NAT端口是否被占用
 func (a *AsaHandler) CheckNat(info *model.TTaskInfo) (err error) {
 	// 一个公网端口只能映射一个内网端口，但一个内网端口可以被多个公网端口所映射
@@ -430,43 +353,6 @@ func (a *AsaParse) parse() error {
 	return nil
 }
 
-func (a *AsaParse) getConfig1() {
-	fmt.Println("获取设备策略-------------->")
-	fb, err := os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-asa-access-list.log")
-	if err != nil {
-		a.error = err
-		return
-	}
-	a.accessListText = string(fb)
-
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-asa-object-group.log")
-	if err != nil {
-		a.error = err
-		return
-	}
-	a.objectGroupText = string(fb)
-
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-asa-object.log")
-	if err != nil {
-		a.error = err
-		return
-	}
-	a.objectText = string(fb)
-
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-asa-service.log")
-	if err != nil {
-		a.error = err
-		return
-	}
-	a.serviceText = string(fb)
-
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-asa-nat.log")
-	if err != nil {
-		a.error = err
-		return
-	}
-	a.natText = string(fb)
-}
 func (a *AsaParse) getConfig() error {
 	commands := []*net_api2.Command{
 		{Id: 1, Cmd: "show run access-list"},
@@ -534,35 +420,6 @@ func (a *AsaParse) ParseInvalidPolicy() {
 	log.Info("解析无效策略完成!")
 }
 
-// 处理当前存在的策略与新的策略，是否有新的命中次数（新的访问次数）
-func (a *AsaParse) parsePolicyHitCount(policies []*model.TDevicePolicyHitCount) error {
-	// 1. 取出旧的策略信息
-	oldPolices := make([]*model.TDevicePolicyHitCount, 0)
-	if e := database.DB.Model(&model.TDevicePolicyHitCount{}).Select("name", "hit_count", "id").Where("device_id = ?", a.DeviceId).Find(&oldPolices).Error; e != nil {
-		return fmt.Errorf("根据设备ID<%d>获取策略命中次数异常: <%s>", a.DeviceId, e.Error())
-	}
-	// 取出旧的策略和命中数
-	oldNameHits := make(map[string]int, 0)
-	for _, v := range oldPolices {
-		oldNameHits[v.Name] = v.HitCount
-	}
-	// 2. 对比旧策略，设置state和before hit count
-	for _, v := range policies {
-		beforeHit, ok := oldNameHits[v.Name]
-		if ok {
-			// 命中次数为0设置为无效策略
-			v.BeforeHitCount = beforeHit
-		}
-		// 存在则更新
-		if v.HitCount <= v.BeforeHitCount {
-			v.State = 0
-		} else {
-			v.State = 1
-		}
-	}
-	return nil
-}
-
 // 获取策略，获取出策略信息
 func (a *AsaParse) parseAccessListPolicy(text string) []*model.TDevicePolicyHitCount {
 	// access-list out_inside line 1 extended permit ip 172.17.116.0 255.255.252.0 192.168.0.0 255.255.252.0 (hitcnt=2709813) 0x168d041e
@@ -823,11 +680,6 @@ func (a *AsaParse) parseObjectText() []*asaObject {
 			}
 			object.addresses = append(object.addresses, addr)
 		case lines[0] == "range": // range start_address end_address - 地址的范围。可以指定 IPv4 或 IPv6 范围。请勿包含掩码或前缀。
-			// 此处只解析ipv4的范围
-			if utils.GetIpType(lines[1]) == conf.IpTypeV6 {
-				a.addLog(fmt.Sprintf("不支持object ipv6 range地址解析, text: %s, num: %d", line, i+1))
-				continue
-			}
 			addresses := a.getRangeAddress(lines[1], lines[2])
 			object.addresses = append(object.addresses, addresses...)
 		}
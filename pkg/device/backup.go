@@ -2,39 +2,78 @@ package device
 
 import (
 	"archive/zip"
+	"bytes"
 	"fmt"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io"
 	"netops/conf"
+	"netops/database"
 	netApi2 "netops/grpc_client/protobuf/net_api"
 	"netops/model"
 	"netops/utils"
-	"os"
 	"time"
 )
 
+// 压缩包内的配置文件名
+const backupContentName = "content.txt"
+
+// 当前的md5计算方式，之前的备份在压缩完成前计算md5，记录的值与文件不一致
+const backupMd5Version = 1
+
 // Backup 配置备份
 func (b *base) Backup() error {
 	l := zap.L().With(zap.String("func", "backup"), zap.Int("device_id", b.DeviceId))
-	l.Info("1. 获取设备配置------------>")
-	nt := time.Now().Format("200601021504")
+	if e := b.selectActive(); e != nil {
+		l.Error("获取HA主设备失败", zap.Error(e))
+		return e
+	}
+	l.Info("1. 获取设备配置------------>", zap.String("host", b.host))
 	text, e := b.getBackupConfig()
 	if e != nil {
 		l.Error("调用接口失败", zap.Error(e))
 		return e
 	}
-	back := model.TDeviceBackup{DeviceId: b.DeviceId, Size: len(text), Filename: fmt.Sprintf("netops/%s/%s.zip", b.device.Name, nt)}
+	return saveBackup(conf.DeviceTypeFirewall, b.DeviceId, b.device.Name, text)
+}
+
+// 压缩配置并保存到备份存储，记录备份信息
+func saveBackup(deviceType string, deviceId int, deviceName, text string) error {
+	l := zap.L().With(zap.String("func", "saveBackup"), zap.String("device_type", deviceType), zap.Int("device_id", deviceId))
+	nt := time.Now().Format("200601021504")
+	back := model.TDeviceBackup{
+		DeviceId:   deviceId,
+		DeviceType: deviceType,
+		Size:       len(text),
+		Filename:   fmt.Sprintf("netops/%s/%s.zip", deviceName, nt),
+		Storage:    DefaultBackupStorage(),
+	}
+	// 负载设备与防火墙可能重名，放到单独目录下
+	if deviceType == conf.DeviceTypeNlb {
+		back.Filename = fmt.Sprintf("netops/nlb/%s/%s.zip", deviceName, nt)
+	}
 
 	l.Info("2. 写入压缩文件-------------->")
-	zipFilename := fmt.Sprintf("data/%s-%s.zip", b.device.Name, nt)
-	md5, e := b.zipFile(zipFilename, []byte(text))
+	body, e := zipBytes([]byte(text))
 	if e != nil {
 		l.Error("压缩配置文件失败", zap.Error(e))
 		return e
 	}
-	back.Md5 = md5
-	l.Info("3. 上传到minio---------->")
-	if e := b.updateMinio(back.Filename, zipFilename); e != nil {
-		l.Error("上传minio失败", zap.Error(e))
+	back.Md5 = utils.GetMd5Bytes(body)
+	back.Md5Version = backupMd5Version
+	if conf.Config.Backup.Encrypt {
+		if body, e = encryptBackup(body); e != nil {
+			return e
+		}
+		back.Encrypted = true
+	}
+	l.Info("3. 上传到备份存储---------->", zap.String("storage", back.Storage))
+	store, e := NewBackupStore(back.Storage)
+	if e != nil {
+		return e
+	}
+	if e := store.Put(back.Filename, body); e != nil {
+		l.Error("上传备份文件失败", zap.Error(e))
 		return e
 	}
 	l.Info("4. 保存备份信息---------->")
@@ -45,34 +84,22 @@ func (b *base) Backup() error {
 	return nil
 }
 
-func (b *base) zipFile(filename string, body []byte) (string, error) {
-	zipFile, _ := os.Create(filename)
-	defer zipFile.Close()
-	w := zip.NewWriter(zipFile)
-	defer w.Close()
-	fw, e := w.Create(fmt.Sprintf("content.txt"))
+// 压缩配置文件，返回zip文件内容
+func zipBytes(body []byte) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	w := zip.NewWriter(buffer)
+	fw, e := w.Create(backupContentName)
 	if e != nil {
-		return "", fmt.Errorf("创建文件写入zip失败, err: %w", e)
-	}
-	_, err := fw.Write(body)
-	if err != nil {
-		return "", fmt.Errorf("写入文件数据失败, err: %w")
+		return nil, fmt.Errorf("创建文件写入zip失败, err: %w", e)
 	}
-	md5, e := utils.GetFileMd5(filename)
-	if e != nil {
-		return "", fmt.Errorf("读取文件md5值失败, err: %w", e)
+	if _, e := fw.Write(body); e != nil {
+		return nil, fmt.Errorf("写入文件数据失败, err: %w", e)
 	}
-	return md5, nil
-}
-
-// 上传文件到minio
-func (b *base) updateMinio(objectName, filepath string) error {
-	m := utils.NewMinioDefault()
-	// netops/device_name/filename.zip
-	if err := m.UploadFile(conf.Config.Minio.Bucket, objectName, filepath); err != nil {
-		return err
+	// 必须关闭后再计算md5，否则zip的目录信息还未写入
+	if e := w.Close(); e != nil {
+		return nil, fmt.Errorf("关闭压缩文件失败, err: %w", e)
 	}
-	return nil
+	return buffer.Bytes(), nil
 }
 
 func (b *base) getBackupConfig() (string, error) {
@@ -111,20 +138,200 @@ func (h *backupHandler) Download() ([]byte, error) {
 		return nil, h.Err
 	}
 	l := zap.L().With(zap.String("func", "BackupDownload"), zap.Int("backup_id", h.id))
-	l.Info("1. 从minio获取文件-------------------->")
-	m := utils.NewMinioDefault()
-	result, err := m.GetFile(conf.Config.Minio.Bucket, h.data.Filename)
+	l.Info("1. 从备份存储获取文件-------------------->")
+	store, err := NewBackupStore(h.data.Storage)
 	if err != nil {
 		return nil, err
 	}
+	result, err := store.Get(h.data.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if h.data.Encrypted {
+		if result, err = decryptBackup(result); err != nil {
+			return nil, err
+		}
+	}
+	if h.data.Md5Version < backupMd5Version {
+		l.Info("2. 旧版本备份md5无法校验, 检查压缩文件完整性---------------->")
+		if err = h.checkLegacy(result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
 	l.Info("2. 对比文件md5---------------->")
-	if h.verifyMd5(result, h.data.Md5) {
+	if !h.verifyMd5(result, h.data.Md5) {
 		return nil, fmt.Errorf("文件MD5值不一致")
 	}
 	return result, nil
 }
 
+// 旧版本备份记录的md5无法校验，保留原md5，只检查压缩文件的crc32
+func (h *backupHandler) checkLegacy(body []byte) error {
+	r, e := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if e != nil {
+		return fmt.Errorf("旧版本备份文件已损坏, err: %w", e)
+	}
+	found := false
+	for _, f := range r.File {
+		if f.Name != backupContentName {
+			continue
+		}
+		// 读取到结尾时会校验crc32
+		rc, e := f.Open()
+		if e != nil {
+			return fmt.Errorf("旧版本备份文件已损坏, err: %w", e)
+		}
+		_, e = io.Copy(io.Discard, rc)
+		_ = rc.Close()
+		if e != nil {
+			return fmt.Errorf("旧版本备份文件已损坏, err: %w", e)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("旧版本备份文件中不存在%s", backupContentName)
+	}
+	return nil
+}
+
 // 校对MD5值
 func (h *backupHandler) verifyMd5(body []byte, md5 string) bool {
 	return utils.GetMd5Bytes(body) == md5
 }
+
+// Text 下载备份并解压，返回配置文本
+func (h *backupHandler) Text() (string, error) {
+	body, e := h.Download()
+	if e != nil {
+		return "", e
+	}
+	r, e := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if e != nil {
+		return "", fmt.Errorf("解压备份文件失败, err: %w", e)
+	}
+	for _, f := range r.File {
+		if f.Name != backupContentName {
+			continue
+		}
+		rc, e := f.Open()
+		if e != nil {
+			return "", fmt.Errorf("读取备份文件失败, err: %w", e)
+		}
+		content, e := io.ReadAll(rc)
+		_ = rc.Close()
+		if e != nil {
+			return "", fmt.Errorf("读取备份文件失败, err: %w", e)
+		}
+		return string(content), nil
+	}
+	return "", fmt.Errorf("备份文件中不存在%s", backupContentName)
+}
+
+// BackupRetention 备份保留策略，保留最近Daily天、Weekly周、Monthly月中每个周期的最后一次备份
+type BackupRetention struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+func (r BackupRetention) Enabled() bool {
+	return r.Daily > 0 || r.Weekly > 0 || r.Monthly > 0
+}
+
+// 根据保留策略计算需要保留的备份，backups需按时间倒序
+func (r BackupRetention) keep(backups []*model.TDeviceBackup) map[int]bool {
+	result := make(map[int]bool)
+	if len(backups) == 0 {
+		return result
+	}
+	// 最新的一次备份始终保留
+	result[backups[0].Id] = true
+	periods := []struct {
+		count int
+		key   func(t time.Time) string
+	}{
+		{r.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{r.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}},
+		{r.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, p := range periods {
+		seen := make(map[string]bool)
+		for _, v := range backups {
+			if len(seen) >= p.count {
+				break
+			}
+			k := p.key(v.CreatedAt)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			result[v.Id] = true
+		}
+	}
+	return result
+}
+
+// PruneBackups 按保留策略清理设备的历史备份，同时删除存储中的文件，返回清理的数量
+func PruneBackups(deviceType string, deviceId int, retention BackupRetention) (int, error) {
+	if !retention.Enabled() {
+		return 0, nil
+	}
+	backups := make([]*model.TDeviceBackup, 0)
+	if e := backupQuery(deviceType, deviceId).Order("created_at desc, id desc").Find(&backups).Error; e != nil {
+		return 0, fmt.Errorf("获取设备备份失败, device_id: %d, err: %w", deviceId, e)
+	}
+	keep := retention.keep(backups)
+	count := 0
+	for _, v := range backups {
+		if keep[v.Id] {
+			continue
+		}
+		store, e := NewBackupStore(v.Storage)
+		if e != nil {
+			return count, e
+		}
+		if e := store.Remove(v.Filename); e != nil {
+			return count, e
+		}
+		if e := v.Delete(); e != nil {
+			return count, e
+		}
+		count++
+	}
+	return count, nil
+}
+
+// 查询设备的备份，device_type为空的是增加负载备份之前的防火墙备份
+func backupQuery(deviceType string, deviceId int) *gorm.DB {
+	if deviceType == "" || deviceType == conf.DeviceTypeFirewall {
+		return database.DB.Where("device_id = ? and (device_type = ? or device_type = '' or device_type is null)", deviceId, conf.DeviceTypeFirewall)
+	}
+	return database.DB.Where("device_id = ? and device_type = ?", deviceId, deviceType)
+}
+
+// Verify 校验存储中的备份文件与记录的md5是否一致，并保存校验结果
+func (h *backupHandler) Verify() error {
+	if h.Err != nil {
+		return h.Err
+	}
+	_, e := h.Download()
+	now := time.Now()
+	h.data.VerifiedAt = &now
+	h.data.VerifyStatus = "success"
+	h.data.VerifyMessage = ""
+	if e != nil {
+		h.data.VerifyStatus = "failed"
+		h.data.VerifyMessage = e.Error()
+	} else if h.data.Md5Version < backupMd5Version {
+		h.data.VerifyStatus = "legacy"
+		h.data.VerifyMessage = "旧版本备份md5无法校验, 仅确认压缩文件完整"
+	}
+	if err := database.DB.Model(h.data).Select("verify_status", "verify_message", "verified_at").Updates(h.data).Error; err != nil {
+		return fmt.Errorf("保存备份校验结果失败, id: %d, err: %w", h.id, err)
+	}
+	return e
+}
@@ -0,0 +1,157 @@
+package device
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/model"
+	"netops/utils"
+	"regexp"
+	"strings"
+)
+
+// 备份对比时默认忽略的行，如时间戳、运行时长等每次备份都会变化的内容
+var backupDiffIgnore = map[string][]string{
+	"all": {
+		`^\s*$`,
+		`(?i)uptime`,
+	},
+	"asa": {
+		`^: Written by`,
+		`^: Saved`,
+		`^Cryptochecksum:`,
+		`^ntp clock-period`,
+	},
+	"srx": {
+		`^## Last commit:`,
+		`^## Last changed:`,
+	},
+	"h3c": {
+		`^\s*#\s*$`,
+		`^\s*return\s*$`,
+	},
+	"huawei": {
+		`^!Software Version`,
+		`^!Last configuration was`,
+		`^\s*#\s*$`,
+		`^\s*return\s*$`,
+	},
+	// F5备份为iControl REST返回的json，generation等字段每次修改配置都会变化
+	"f5": {
+		`"generation":`,
+		`"lastModifiedTime":`,
+	},
+}
+
+// 备份对比时差异前后保留的行数
+const backupDiffContext = 3
+
+// BackupDiff 两次备份的差异
+type BackupDiff struct {
+	Old     *model.TDeviceBackup `json:"old"`
+	New     *model.TDeviceBackup `json:"new"`
+	Unified string               `json:"unified"`
+	Hunks   []*utils.DiffHunk    `json:"hunks"`
+}
+
+// DiffBackup 对比同一设备的两次备份
+func DiffBackup(oldId, newId int) (*BackupDiff, error) {
+	oldHandler, newHandler := NewBackupHandler(oldId), NewBackupHandler(newId)
+	if oldHandler.Err != nil {
+		return nil, oldHandler.Err
+	}
+	if newHandler.Err != nil {
+		return nil, newHandler.Err
+	}
+	if oldHandler.data.DeviceId != newHandler.data.DeviceId || backupDeviceType(oldHandler.data) != backupDeviceType(newHandler.data) {
+		return nil, fmt.Errorf("只能对比同一设备的备份, old: %s, new: %s", oldHandler.data.Device, newHandler.data.Device)
+	}
+	ignore, e := getBackupDiffIgnore(oldHandler.data)
+	if e != nil {
+		return nil, e
+	}
+	oldText, e := oldHandler.Text()
+	if e != nil {
+		return nil, e
+	}
+	newText, e := newHandler.Text()
+	if e != nil {
+		return nil, e
+	}
+	d := utils.NewTextDiff(ignore)
+	d.Diff(oldText, newText)
+	return &BackupDiff{
+		Old:     oldHandler.data,
+		New:     newHandler.data,
+		Unified: d.Unified(oldHandler.data.Filename, newHandler.data.Filename, backupDiffContext),
+		Hunks:   d.Hunks(backupDiffContext),
+	}, nil
+}
+
+// DiffBackupPrevious 对比设备最新的备份和上一次备份
+func DiffBackupPrevious(deviceType string, deviceId int) (*BackupDiff, error) {
+	backups := make([]*model.TDeviceBackup, 0)
+	if e := backupQuery(deviceType, deviceId).Order("id desc").Limit(2).Find(&backups).Error; e != nil {
+		return nil, fmt.Errorf("获取设备备份失败, device_id: %d, err: %w", deviceId, e)
+	}
+	if len(backups) < 2 {
+		return nil, fmt.Errorf("设备备份少于两次, 无法对比, device_id: %d", deviceId)
+	}
+	return DiffBackup(backups[1].Id, backups[0].Id)
+}
+
+func backupDeviceType(backup *model.TDeviceBackup) string {
+	if backup.DeviceType == "" {
+		return conf.DeviceTypeFirewall
+	}
+	return backup.DeviceType
+}
+
+// 根据设备类型获取忽略规则，配置文件中的规则追加到默认规则后
+func getBackupDiffIgnore(backup *model.TDeviceBackup) (func(line string) bool, error) {
+	var deviceTypeId int
+	if backupDeviceType(backup) == conf.DeviceTypeNlb {
+		device := model.TNLBDevice{}
+		if e := device.FirstById(backup.DeviceId); e != nil {
+			return nil, e
+		}
+		deviceTypeId = device.DeviceTypeId
+	} else {
+		device := model.TFirewallDevice{}
+		if e := device.FirstById(backup.DeviceId); e != nil {
+			return nil, e
+		}
+		deviceTypeId = device.DeviceTypeId
+	}
+	deviceType := model.TDeviceType{}
+	if e := deviceType.FirstById(deviceTypeId); e != nil {
+		return nil, e
+	}
+	return diffIgnore(strings.ToLower(deviceType.Name))
+}
+
+// 按设备类型名获取对比时忽略的行
+func diffIgnore(name string) (func(line string) bool, error) {
+	patterns := make([]string, 0)
+	patterns = append(patterns, backupDiffIgnore["all"]...)
+	patterns = append(patterns, backupDiffIgnore[name]...)
+	if conf.Config != nil {
+		patterns = append(patterns, conf.Config.Backup.DiffIgnore["all"]...)
+		patterns = append(patterns, conf.Config.Backup.DiffIgnore[name]...)
+	}
+	regs := make([]*regexp.Regexp, 0, len(patterns))
+	for _, v := range patterns {
+		reg, e := regexp.Compile(v)
+		if e != nil {
+			return nil, fmt.Errorf("备份对比忽略规则错误, pattern: %s, err: %w", v, e)
+		}
+		regs = append(regs, reg)
+	}
+	return func(line string) bool {
+		for _, reg := range regs {
+			if reg.MatchString(line) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
@@ -0,0 +1,141 @@
+package device
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	BackupStorageMinio = "minio"
+	BackupStorageLocal = "local"
+	BackupStorageS3    = "s3"
+)
+
+// BackupStore 备份文件存储
+type BackupStore interface {
+	Put(name string, body []byte) error
+	Get(name string) ([]byte, error)
+	Remove(name string) error
+}
+
+// NewBackupStore 根据存储类型获取备份存储，为空时是增加存储类型之前的备份，均在minio中
+func NewBackupStore(storage string) (BackupStore, error) {
+	if storage == "" {
+		storage = BackupStorageMinio
+	}
+	switch storage {
+	case BackupStorageMinio:
+		return &minioStore{client: utils.NewMinioDefault(), bucket: conf.Config.Minio.Bucket}, nil
+	case BackupStorageS3:
+		c := conf.Config.Backup.S3
+		return &minioStore{client: utils.NewMinioWithRegion(c.Endpoint, c.AccessKey, c.SecretKey, c.Region, c.Secure), bucket: c.Bucket}, nil
+	case BackupStorageLocal:
+		dir := conf.Config.Backup.LocalDir
+		if dir == "" {
+			dir = "data/backup"
+		}
+		return &localStore{dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("不支持的备份存储类型: %s", storage)
+	}
+}
+
+// DefaultBackupStorage 配置文件中的默认存储类型，未配置时使用minio
+func DefaultBackupStorage() string {
+	if conf.Config.Backup.Storage == "" {
+		return BackupStorageMinio
+	}
+	return conf.Config.Backup.Storage
+}
+
+// minio及兼容s3协议的存储
+type minioStore struct {
+	client *utils.Minio
+	bucket string
+}
+
+func (s *minioStore) Put(name string, body []byte) error {
+	return s.client.UploadBytes(s.bucket, name, body)
+}
+func (s *minioStore) Get(name string) ([]byte, error) {
+	return s.client.GetFile(s.bucket, name)
+}
+func (s *minioStore) Remove(name string) error {
+	return s.client.RemoveFile(s.bucket, name)
+}
+
+// 本地文件存储
+type localStore struct {
+	dir string
+}
+
+func (s *localStore) path(name string) (string, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(name))
+	// 防止文件名中带有../访问到存储目录之外
+	if !strings.HasPrefix(p, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("备份文件名不合法: %s", name)
+	}
+	return p, nil
+}
+
+func (s *localStore) Put(name string, body []byte) error {
+	p, e := s.path(name)
+	if e != nil {
+		return e
+	}
+	if e := os.MkdirAll(filepath.Dir(p), 0755); e != nil {
+		return fmt.Errorf("创建备份目录失败, err: %w", e)
+	}
+	if e := os.WriteFile(p, body, 0644); e != nil {
+		return fmt.Errorf("写入备份文件失败, file: %s, err: %w", p, e)
+	}
+	return nil
+}
+func (s *localStore) Get(name string) ([]byte, error) {
+	p, e := s.path(name)
+	if e != nil {
+		return nil, e
+	}
+	result, e := os.ReadFile(p)
+	if e != nil {
+		return nil, fmt.Errorf("读取备份文件失败, file: %s, err: %w", p, e)
+	}
+	return result, nil
+}
+func (s *localStore) Remove(name string) error {
+	p, e := s.path(name)
+	if e != nil {
+		return e
+	}
+	if e := os.Remove(p); e != nil && !os.IsNotExist(e) {
+		return fmt.Errorf("删除备份文件失败, file: %s, err: %w", p, e)
+	}
+	return nil
+}
+
+// 加密备份文件
+func encryptBackup(body []byte) ([]byte, error) {
+	result, e := utils.AesEncrypt(string(body), conf.Config.AesKey)
+	if e != nil {
+		return nil, fmt.Errorf("加密备份文件失败, err: %w", e)
+	}
+	return []byte(result), nil
+}
+
+// 解密备份文件，文件损坏时aes解密会panic，这里转换为错误返回
+func decryptBackup(body []byte) (result []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("解密备份文件失败, err: %v", r)
+		}
+	}()
+	text, e := utils.AesDecrypt(string(body), conf.Config.AesKey)
+	if e != nil {
+		return nil, fmt.Errorf("解密备份文件失败, err: %w", e)
+	}
+	return []byte(text), nil
+}
@@ -0,0 +1,237 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"netops/model"
+)
+
+const (
+	ChangeTypeAdded    = "added"
+	ChangeTypeRemoved  = "removed"
+	ChangeTypeModified = "modified"
+)
+
+// 新旧数据的对比结果，modified和unchanged中为[旧数据, 新数据]
+type changeSet[T any] struct {
+	added     []T
+	removed   []T
+	modified  [][2]T
+	unchanged [][2]T
+}
+
+func (c *changeSet[T]) String() string {
+	return fmt.Sprintf("新增%d, 删除%d, 修改%d, 未变更%d", len(c.added), len(c.removed), len(c.modified), len(c.unchanged))
+}
+
+// 对比选项
+type changeOption[T any] struct {
+	objectType  string
+	model       any              // 删除时使用的model
+	key         func(T) string   // 唯一键，如策略名+方向
+	fingerprint func(T) string   // 对比内容，相同则视为未变更
+	getId       func(T) int      // 获取主键
+	keep        func(old, new T) // 修改时把旧数据的主键等信息保留到新数据
+}
+
+/*
+对比新旧数据
+ 1. 先按唯一键分组，同一个键下内容一致的视为未变更(同名多条的ASA策略在此处匹配)
+ 2. 同一个键下剩余的新旧数据按顺序配对视为修改
+ 3. 多出来的新数据为新增，旧数据为删除
+*/
+func diffRecords[T any](olds, news []T, opt *changeOption[T]) *changeSet[T] {
+	result := &changeSet[T]{}
+	oldM := make(map[string][]T)
+	keys := make([]string, 0)
+	for _, v := range olds {
+		k := opt.key(v)
+		if _, ok := oldM[k]; !ok {
+			keys = append(keys, k)
+		}
+		oldM[k] = append(oldM[k], v)
+	}
+	newM := make(map[string][]T)
+	for _, v := range news {
+		k := opt.key(v)
+		if _, ok := newM[k]; !ok {
+			if _, ok := oldM[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		newM[k] = append(newM[k], v)
+	}
+	for _, k := range keys {
+		oldItems, newItems := oldM[k], newM[k]
+		used := make([]bool, len(oldItems))
+		remain := make([]T, 0)
+		for _, n := range newItems {
+			fp := opt.fingerprint(n)
+			matched := false
+			for i, o := range oldItems {
+				if !used[i] && opt.fingerprint(o) == fp {
+					used[i] = true
+					matched = true
+					result.unchanged = append(result.unchanged, [2]T{o, n})
+					break
+				}
+			}
+			if !matched {
+				remain = append(remain, n)
+			}
+		}
+		for i, o := range oldItems {
+			if used[i] {
+				continue
+			}
+			if len(remain) > 0 {
+				result.modified = append(result.modified, [2]T{o, remain[0]})
+				remain = remain[1:]
+				continue
+			}
+			result.removed = append(result.removed, o)
+		}
+		result.added = append(result.added, remain...)
+	}
+	return result
+}
+
+// 把对比结果写入数据库，并记录变更
+func applyChanges[T any](tx *gorm.DB, deviceId int, cs *changeSet[T], opt *changeOption[T]) error {
+	changes := make([]*model.TDevicePolicyChange, 0)
+	ids := make([]int, 0)
+	for _, v := range cs.removed {
+		ids = append(ids, opt.getId(v))
+		changes = append(changes, newChange(deviceId, opt.objectType, opt.key(v), ChangeTypeRemoved, v, nil))
+	}
+	for i := 0; i*100 < len(ids); i++ {
+		r := (i + 1) * 100
+		if r > len(ids) {
+			r = len(ids)
+		}
+		if e := tx.Where("id in ?", ids[i*100:r]).Delete(opt.model).Error; e != nil {
+			return fmt.Errorf("删除%s失败, err: %w", opt.objectType, e)
+		}
+	}
+	for _, v := range cs.modified {
+		old, n := v[0], v[1]
+		changes = append(changes, newChange(deviceId, opt.objectType, opt.key(n), ChangeTypeModified, old, n))
+		opt.keep(old, n)
+		if e := tx.Save(n).Error; e != nil {
+			return fmt.Errorf("修改%s失败, err: %w", opt.objectType, e)
+		}
+	}
+	for i := 0; i*100 < len(cs.added); i++ {
+		r := (i + 1) * 100
+		if r > len(cs.added) {
+			r = len(cs.added)
+		}
+		items := cs.added[i*100 : r]
+		if e := tx.Create(&items).Error; e != nil {
+			return fmt.Errorf("新增%s失败, err: %w", opt.objectType, e)
+		}
+		for _, v := range items {
+			changes = append(changes, newChange(deviceId, opt.objectType, opt.key(v), ChangeTypeAdded, nil, v))
+		}
+	}
+	for i := 0; i*100 < len(changes); i++ {
+		r := (i + 1) * 100
+		if r > len(changes) {
+			r = len(changes)
+		}
+		items := changes[i*100 : r]
+		if e := tx.Create(&items).Error; e != nil {
+			return fmt.Errorf("保存%s变更记录失败, err: %w", opt.objectType, e)
+		}
+	}
+	return nil
+}
+
+func newChange(deviceId int, objectType, key, changeType string, old, new any) *model.TDevicePolicyChange {
+	result := &model.TDevicePolicyChange{
+		DeviceId:   deviceId,
+		ObjectType: objectType,
+		ObjectKey:  key,
+		ChangeType: changeType,
+	}
+	if old != nil {
+		bs, _ := json.Marshal(old)
+		result.OldValue = string(bs)
+	}
+	if new != nil {
+		bs, _ := json.Marshal(new)
+		result.NewValue = string(bs)
+	}
+	return result
+}
+
+var policyChangeOption = &changeOption[*model.TDevicePolicy]{
+	objectType: "policy",
+	model:      &model.TDevicePolicy{},
+	key: func(v *model.TDevicePolicy) string {
+		return fmt.Sprintf("%s|%s", v.Name, v.Direction)
+	},
+	fingerprint: func(v *model.TDevicePolicy) string {
+		return fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s|%s|%s|%s", v.Src, v.SrcGroup, v.Dst, v.DstGroup, v.Port, v.PortGroup,
+			v.Protocol, v.Action, v.SrcZone, v.DstZone, v.Command)
+	},
+	getId: func(v *model.TDevicePolicy) int {
+		return v.Id
+	},
+	keep: func(old, new *model.TDevicePolicy) {
+		new.BaseModel = old.BaseModel
+	},
+}
+
+var groupChangeOption = &changeOption[*model.TDeviceAddressGroup]{
+	objectType: "group",
+	model:      &model.TDeviceAddressGroup{},
+	key: func(v *model.TDeviceAddressGroup) string {
+		return fmt.Sprintf("%s|%s|%s", v.Name, v.Zone, v.AddressType)
+	},
+	fingerprint: func(v *model.TDeviceAddressGroup) string {
+		return v.Address
+	},
+	getId: func(v *model.TDeviceAddressGroup) int {
+		return v.Id
+	},
+	keep: func(old, new *model.TDeviceAddressGroup) {
+		new.Id = old.Id
+	},
+}
+
+var portChangeOption = &changeOption[*model.TDevicePort]{
+	objectType: "port",
+	model:      &model.TDevicePort{},
+	key: func(v *model.TDevicePort) string {
+		return fmt.Sprintf("%s|%s", v.Name, v.Protocol)
+	},
+	fingerprint: func(v *model.TDevicePort) string {
+		return fmt.Sprintf("%d-%d", v.Start, v.End)
+	},
+	getId: func(v *model.TDevicePort) int {
+		return v.Id
+	},
+	keep: func(old, new *model.TDevicePort) {
+		new.Id = old.Id
+	},
+}
+
+var natChangeOption = &changeOption[*model.TDeviceNat]{
+	objectType: "nat",
+	model:      &model.TDeviceNat{},
+	key: func(v *model.TDeviceNat) string {
+		return fmt.Sprintf("%s|%s|%s", v.Direction, v.NetworkGroup, v.Network)
+	},
+	fingerprint: func(v *model.TDeviceNat) string {
+		return fmt.Sprintf("%s|%s|%s|%s|%s|%s|%s|%s", v.Static, v.StaticGroup, v.Protocol, v.NetworkPort, v.StaticPort, v.Destination, v.DestinationGroup, v.Command)
+	},
+	getId: func(v *model.TDeviceNat) int {
+		return v.Id
+	},
+	keep: func(old, new *model.TDeviceNat) {
+		new.BaseModel = old.BaseModel
+		new.Id = old.Id
+	},
+}
@@ -0,0 +1,166 @@
+package device
+
+import (
+	"fmt"
+	"netops/conf"
+	net_api2 "netops/grpc_client/protobuf/net_api"
+	"regexp"
+	"strings"
+)
+
+// 安全提交追加的命令id，工单策略的命令id为策略id，不会与之重复
+const (
+	commitCheckId   = -1
+	commitTrialId   = -2
+	commitConfirmId = -3
+	commitRevertId  = -4
+)
+
+const defaultConfirmMinutes = 5
+
+// 命令输出中表示失败的内容，srx为error:，h3c为%开头的提示，华为为Error:
+var commitFailedPattern = regexp.MustCompile(`(?mi)^\s*(?:error:|%\s+\S).*$|configuration check-out failed`)
+
+/*
+SafeCommit 各厂商的安全提交方式:
+  - srx: 配置后commit check，检查通过后再单独下发commit confirmed N，确认能登录后commit
+  - h3c: 配置前configuration commit delay N，确认能登录后configuration commit
+  - huawei: 二阶段提交模式下commit trial N秒，确认能登录后commit
+*/
+type SafeCommit struct {
+	vendor     string
+	minutes    int
+	check      string
+	trial      string
+	trialFirst bool // h3c需要在配置前开启延时提交
+	confirm    string
+	revert     string // 检查失败时清除未提交的配置
+}
+
+// NewSafeCommit 获取设备类型的安全提交方式，设备类型未启用时返回nil
+func NewSafeCommit(deviceType string) *SafeCommit {
+	vendor := strings.ToLower(deviceType)
+	vendors, minutes := []string{"srx"}, defaultConfirmMinutes
+	if conf.Config != nil {
+		if len(conf.Config.SafeCommit.Vendors) > 0 {
+			vendors = conf.Config.SafeCommit.Vendors
+		}
+		if conf.Config.SafeCommit.ConfirmMinutes > 0 {
+			minutes = conf.Config.SafeCommit.ConfirmMinutes
+		}
+	}
+	enabled := false
+	for _, v := range vendors {
+		if strings.ToLower(v) == vendor {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil
+	}
+	result := &SafeCommit{vendor: vendor, minutes: minutes}
+	switch vendor {
+	case "srx":
+		result.check = "commit check"
+		result.trial = fmt.Sprintf("commit confirmed %d", minutes)
+		result.confirm = "commit"
+		result.revert = "rollback 0"
+	case "h3c":
+		result.trial = fmt.Sprintf("configuration commit delay %d", minutes)
+		result.trialFirst = true
+		result.confirm = "configuration commit"
+	case "huawei":
+		result.trial = fmt.Sprintf("commit trial %d", minutes*60)
+		result.confirm = "commit"
+	default:
+		return nil
+	}
+	return result
+}
+
+// Minutes 未确认时自动回滚的分钟数
+func (s *SafeCommit) Minutes() int {
+	return s.minutes
+}
+
+// CheckCommands 第一次下发的命令: 配置命令和提交检查，h3c需要在配置前开启延时提交
+func (s *SafeCommit) CheckCommands(commands []*net_api2.Command) []*net_api2.Command {
+	results := make([]*net_api2.Command, 0, len(commands)+1)
+	if s.trialFirst {
+		results = append(results, &net_api2.Command{Id: commitTrialId, Cmd: s.trial})
+	}
+	results = append(results, commands...)
+	if s.check != "" {
+		results = append(results, &net_api2.Command{Id: commitCheckId, Cmd: s.check})
+	}
+	return results
+}
+
+// TrialCommands 检查通过后单独下发的带自动回滚的提交，h3c已在配置前开启时返回nil
+func (s *SafeCommit) TrialCommands() []*net_api2.Command {
+	if s.trialFirst {
+		return nil
+	}
+	return []*net_api2.Command{{Id: commitTrialId, Cmd: s.trial}}
+}
+
+// Candidate 配置命令是否只修改候选配置，h3c配置后立即生效
+func (s *SafeCommit) Candidate() bool {
+	return !s.trialFirst
+}
+
+// Trialed 结果中带自动回滚的提交是否已执行成功，成功后配置已生效，未最终提交时设备超时自动回滚
+func (s *SafeCommit) Trialed(results []*net_api2.Command) bool {
+	for _, v := range results {
+		if v.Id == commitTrialId {
+			return !commandFailed(v)
+		}
+	}
+	return false
+}
+
+// Split 拆分配置命令和提交命令的结果，有配置命令失败或提交失败时返回设备的错误输出
+func (s *SafeCommit) Split(results []*net_api2.Command) ([]*net_api2.Command, string) {
+	commands, failures := make([]*net_api2.Command, 0, len(results)), make([]string, 0)
+	for _, v := range results {
+		if v.Id >= 0 {
+			commands = append(commands, v)
+		}
+		switch {
+		case !commandFailed(v):
+		case v.Id >= 0:
+			failures = append(failures, strings.TrimSpace(v.Result))
+		default:
+			failures = append(failures, fmt.Sprintf("%s: %s", v.Cmd, strings.TrimSpace(v.Result)))
+		}
+	}
+	return commands, strings.Join(failures, "\n")
+}
+
+// RevertCommands 检查失败后清除未提交配置的命令，不需要清除时返回nil
+func (s *SafeCommit) RevertCommands() []*net_api2.Command {
+	if s.revert == "" {
+		return nil
+	}
+	return []*net_api2.Command{{Id: commitRevertId, Cmd: s.revert}}
+}
+
+// VerifyCommands 提交后确认设备仍可以登录的命令
+func (s *SafeCommit) VerifyCommands() []*net_api2.Command {
+	return []*net_api2.Command{{Id: 1, Cmd: healthCommands[s.vendor]}}
+}
+
+// ConfirmCommands 最终提交的命令
+func (s *SafeCommit) ConfirmCommands() []*net_api2.Command {
+	return []*net_api2.Command{{Id: commitConfirmId, Cmd: s.confirm}}
+}
+
+// Failure 返回提交命令的错误输出，成功时为空
+func (s *SafeCommit) Failure(results []*net_api2.Command) string {
+	_, failure := s.Split(results)
+	return failure
+}
+
+func commandFailed(cmd *net_api2.Command) bool {
+	return cmd.Status == conf.TaskStatusFailed || commitFailedPattern.MatchString(cmd.Result)
+}
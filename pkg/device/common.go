@@ -5,11 +5,11 @@ import (
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"net"
-	"netops/conf"
 	"netops/database"
 	"netops/grpc_client/net_api"
 	net_api2 "netops/grpc_client/protobuf/net_api"
 	"netops/model"
+	"netops/pkg/credential"
 	"netops/pkg/subnet"
 	"netops/utils"
 	"sort"
@@ -62,6 +62,8 @@ type base struct {
 	region        *model.TRegion
 	deviceType    *model.TDeviceType
 	backupCommand string
+	offline       *OfflineConfig
+	host          string // HA设备当前的主设备地址，为空时使用设备地址
 }
 
 func (b *base) GeneCreateGroupCmd(groupName string) (result string) {
@@ -74,14 +76,38 @@ func (b *base) ParseInvalidPolicy() {
 	return
 }
 
+// SetOffline 设置离线配置，设置后不再通过net_api获取设备配置
+func (b *base) SetOffline(config *OfflineConfig) {
+	b.offline = config
+}
+
 func (b *base) send(commands []*net_api2.Command) ([]*net_api2.Command, error) {
+	if b.host != "" {
+		return b.sendTo(b.host, commands)
+	}
+	return b.sendTo(b.device.Host, commands)
+}
+
+// 在指定地址上执行只读命令，HA设备查询各成员状态时使用
+func (b *base) sendTo(host string, commands []*net_api2.Command) ([]*net_api2.Command, error) {
+	if b.offline != nil {
+		result := make([]*net_api2.Command, 0, len(commands))
+		for _, v := range commands {
+			result = append(result, &net_api2.Command{Id: v.Id, Cmd: v.Cmd, Result: b.offline.result(v.Id)})
+		}
+		return result, nil
+	}
+	account, e := credential.Resolve(b.device, credential.PurposeRead)
+	if e != nil {
+		return nil, e
+	}
 	client := net_api.NewClient(b.region.ApiServer)
 	result, e := client.Show(&net_api2.ConfigRequest{
 		DeviceType:     b.deviceType.Name,
-		Host:           b.device.Host,
-		Username:       b.device.Username,
-		Password:       b.device.Password,
-		EnablePassword: b.device.EnablePassword,
+		Host:           host,
+		Username:       account.Username,
+		Password:       account.Password,
+		EnablePassword: account.EnablePassword,
 		Port:           int32(b.device.Port),
 		Commands:       commands})
 	if e != nil {
@@ -90,6 +116,28 @@ func (b *base) send(commands []*net_api2.Command) ([]*net_api2.Command, error) {
 	return result, nil
 }
 
+// 解析成功后更新状态，保存策略快照并检查策略风险
+func (b *base) parseSuccess() {
+	_ = b.device.UpdateParseStatus(ParseStatusSuccess)
+	if e := b.saveSnapshot(); e != nil {
+		b.addLog(e.Error())
+	}
+	if count, e := EvaluateRisk(b.DeviceId); e != nil {
+		b.addLog(e.Error())
+	} else {
+		b.addLog("策略风险检查完成, 未处理的风险%d个", count)
+	}
+	if count, e := b.detectDrift(); e != nil {
+		b.addLog(e.Error())
+	} else {
+		b.addLog("配置漂移检查完成, 未解决的漂移%d个", count)
+	}
+	if _, e := reloadPolicyMatcher(b.DeviceId); e != nil {
+		b.addLog("编译策略匹配器失败: %s", e)
+	}
+	b.addLog("<-------解析策略完成------->")
+}
+
 func (b *base) geneBlackAddrName(addr string) string {
 	return fmt.Sprintf("blacklist_%s", addr)
 }
@@ -131,28 +179,19 @@ func (b *base) groupName(jiraKey string, info *model.TTaskInfo) (result string)
 	return fmt.Sprintf("%s-%d", jiraKey, info.Id)
 }
 
-// 获取range地址，范围地址  172.1.1.1-172.1.1.3
+// 获取range地址，范围地址  172.1.1.1-172.1.1.3，拆分为最少的网段，支持ipv4和ipv6
 func (b *base) getRangeAddress(startIp, endIp string) []string {
-	// 如果存在掩码，就把地址分割出来
-	if strings.Contains(startIp, "/") {
-		startIp = strings.Split(startIp, "/")[0]
-		endIp = strings.Split(endIp, "/")[0]
-	}
-	startIpChars := strings.Split(startIp, ".")
-	endIpChars := strings.Split(endIp, ".")
-	if startIpChars[2] != endIpChars[2] {
-		b.addLog(fmt.Sprintf("范围地址<%s-%s>超出C段", startIp, endIp))
+	r, e := utils.NewIPRange(startIp, endIp)
+	if e != nil {
+		b.addLog(e.Error())
+		return nil
 	}
-	endIpEnd := endIpChars[3]
-	ipPre := strings.Join(startIpChars[0:3], ".")
-	start, _ := strconv.Atoi(startIpChars[3])
-	end, _ := strconv.Atoi(endIpEnd)
-	ipList := make([]string, 0)
-	for i := start; i <= end; i++ {
-		ip := fmt.Sprintf("%s.%d/32", ipPre, i)
-		ipList = append(ipList, ip)
+	cidrs, e := r.CIDRs()
+	if e != nil {
+		b.addLog(e.Error())
+		return nil
 	}
-	return ipList
+	return cidrs
 }
 
 // 将IP地址切分，并转换成int
@@ -186,125 +225,24 @@ func (b *base) genePortGroupName(groupName string) string {
 	return fmt.Sprintf("%s-SERVICE", groupName)
 }
 
-// 返回组名
-func (b *base) getPortNames(port, protocol string) (results []string, err error) {
-	p, err := utils.ParseRangePort(port)
-	if err != nil {
-		return
-	}
-	ports := make([]model.TDevicePort, 0)
-	db := database.DB.Where("device_id = ? and protocol like ? and start <= ? and end >= ?", b.DeviceId,
-		"%"+protocol+"%", p.Start, p.End).Find(&ports)
-	if db.Error != nil {
-		return nil, fmt.Errorf("根据port<%s>获取端口组异常: <%s>", port, db.Error.Error())
-	}
-	results = make([]string, 0)
-	for _, p := range ports {
-		results = append(results, p.Name)
-	}
-	results = append(results, "any")
-	return results, nil
-}
-
-// 查询策略
-func (b *base) search(info *model.TTaskInfo) *model.TDevicePolicy {
-	log := zap.L().With(zap.Int("infoId", info.Id))
-	log.Info("<-------单条策略查询------->")
-	log.Info(fmt.Sprintf("TaskInfo: <%+v>", info))
-	log.Info(fmt.Sprintf("Device: <%+v>", b.device))
-	log.Info("1. 根据源目地址模糊匹配符合条件的策略---------->")
-	var (
-		result    *model.TDevicePolicy
-		db        *gorm.DB
-		portNames = []string{"any"}
-	)
-	db = database.DB.Where("device_id = ? and dst like ? and protocol in ? and direction = ? and action = ?",
-		b.DeviceId, "%"+info.Dst+"%", []string{info.Protocol, "ip"}, info.Direction, "permit")
-	if info.Direction == "inside" && (info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6) {
-		db = db.Where("src_group = ?", info.Src)
-	} else {
-		db = db.Where("src like ?", "%"+info.Src+"%")
-	}
-
-	var err error
-	if info.Protocol != "ip" {
-		zap.L().Info("根据端口和协议获取端口所在的组--------->")
-		if portNames, err = b.getPortNames(info.DPort, info.Protocol); err != nil {
-			b.error = err
-			return nil
-		}
-		log.Info(fmt.Sprintf("port:<%s> -> portNames:<%+v>", info.DPort, portNames))
-		db = db.Where("port = ? or port = ? or port in ?", "any", info.DPort, portNames)
-	}
-	policies := make([]*model.TDevicePolicy, 0)
-	db = db.Find(&policies)
-	if db.Error != nil {
-		b.error = fmt.Errorf("查询策略表异常: <%s>", db.Error.Error())
-		return nil
-	}
-	if len(policies) > 0 {
-		log.Info("匹配到策略信息------------------>")
-		result = policies[0]
-		log.Info(fmt.Sprintf("匹配到的策略: <%+v>", *result))
-	} else {
-		log.Info("2. 根据基本信息未匹配到相应的策略，开始进行网段的匹配------->")
-		// 如果没有匹配的策略，则获取所有地址组，根据地址组来查询
-		// 先获取源地址为网段的策略信息
-		log.Info("先根据基本条件进行过滤------------>")
-		subnetPolicies := make([]*model.TDevicePolicy, 0)
-		db = database.DB.Where("action = ? and device_id = ? and direction = ?",
-			"permit", b.DeviceId, info.Direction)
-		if info.Protocol != "ip" {
-			db = db.Where("port = ? or port = ? or port in ?", "any", info.DPort, portNames)
-		}
-		db = db.Find(&subnetPolicies)
-		if db.Error != nil {
-			b.error = fmt.Errorf("查询策略地址组异常: <%s>", db.Error.Error())
-		}
-		// 根据源目地址找到符合条件的策略
-		log.Info("3. 根据源目地址从策略表中匹配策略--------->")
-		policies = b.getSubnetPolicy(subnetPolicies, info.Src, info.Dst)
-		if len(policies) > 0 {
-			// 匹配出最小的策略
-			log.Info("根据匹配到的网段策略, 获取范围最小的策略信息-------->")
-			policy := b.getPolicy(policies, info.Src, info.Dst)
-			log.Info(fmt.Sprintf("匹配到的策略: <%+v>", policy))
-			result = policy
-		}
-	}
-	log.Info("<-------策略查询结束------->")
-	return nil
-}
-
+// SearchAll 按行号顺序查询包含源目地址和端口的所有策略，条件为空时不限制
 func (b *base) SearchAll(src, dst, port string) ([]*model.TDevicePolicy, error) {
 	if b.error != nil {
 		return nil, b.error
 	}
 	l := zap.L().With(zap.String("func", "SearchAll"))
 	l.Debug("策略查询--->", zap.String("src", src), zap.String("dst", dst), zap.String("port", port))
-	policies := make([]*model.TDevicePolicy, 0)
-	l.Debug("2. 根据设备和方向获取所有策略--->")
-	// 先获取源地址为网段的策略信息
-	subnetPolicies := make([]*model.TDevicePolicy, 0)
-	db := database.DB.Where("device_id = ?", b.DeviceId)
-	if port != "" {
-		l.Debug("根据端口和协议获取端口所在的组--->")
-		var portNames []string
-		var err error
-		if portNames, err = b.getPortNames(port, ""); err != nil {
-			return nil, err
-		}
-		l.Debug("根据port和port_names过滤", zap.String("port", port), zap.Any("port_names", portNames))
-		db = db.Where("port = ? or port = ? or port_group in ?", "any", port, portNames)
+	m, e := getPolicyMatcher(b.DeviceId)
+	if e != nil {
+		return nil, e
 	}
-	if e1 := db.Order("line").Find(&subnetPolicies).Error; e1 != nil {
-		return nil, fmt.Errorf("查询策略表异常, err: %w", e1)
+	q, e := newPolicyQuery("", src, dst, "", port)
+	if e != nil {
+		return nil, e
 	}
-	l.Debug("3. 根据源目地址获取符合条件的策略------------->")
-	policies = b.getSubnetPolicy(subnetPolicies, src, dst)
+	policies := m.all(q)
 	l.Debug(fmt.Sprintf("匹配到的策略条数: <%d>", len(policies)))
-	l.Debug("<-------查询结束------->")
-	return nil, nil
+	return policies, nil
 }
 
 // 获取IP地址所在的组，获取条件，组包含的地址必须与传入的多个地址完全一致
@@ -392,21 +330,25 @@ func (b *base) saveGroup(data []*model.TDeviceAddressGroup) error {
 	if data == nil || len(data) == 0 {
 		return nil
 	}
+	// 同一设备可能分多次保存不同类型的地址组，如asa的object和object-group，只对比本次的类型
+	addressTypeM := make(map[string]bool)
+	addressTypes := make([]string, 0)
+	for _, v := range data {
+		if !addressTypeM[v.AddressType] {
+			addressTypeM[v.AddressType] = true
+			addressTypes = append(addressTypes, v.AddressType)
+		}
+	}
+	olds := make([]*model.TDeviceAddressGroup, 0)
+	if e := database.DB.Where("device_id = ? and address_type in ?", b.device.Id, addressTypes).Find(&olds).Error; e != nil {
+		return fmt.Errorf("获取历史地址组配置失败, err: %w", e)
+	}
+	cs := diffRecords(olds, data, groupChangeOption)
+	b.addLog("地址组变更: %s", cs)
 	tx := database.DB.Begin()
-	if e := tx.Delete(&model.TDeviceAddressGroup{}, "device_id = ?", b.device.Id).Error; e != nil {
+	if e := applyChanges(tx, b.device.Id, cs, groupChangeOption); e != nil {
 		tx.Rollback()
-		return fmt.Errorf("清除历史地址组配置失败, err: %w", e)
-	}
-	for i := 0; i*100 < len(data); i++ {
-		r := (i + 1) * 100
-		if (i+1)*100 > len(data) {
-			r = len(data)
-		}
-		groups := data[i*100 : r]
-		if e := tx.Create(&groups).Error; e != nil {
-			tx.Rollback()
-			return fmt.Errorf("保存设备地址组失败, err: %w", e)
-		}
+		return fmt.Errorf("保存设备地址组失败, err: %w", e)
 	}
 	if e := tx.Commit().Error; e != nil {
 		return fmt.Errorf("保存地址组commit失败: %w", e)
@@ -438,22 +380,18 @@ func (b *base) savePort(data []*model.TDevicePort) error {
 	if data == nil {
 		return nil
 	}
+	olds := make([]*model.TDevicePort, 0)
+	if e := database.DB.Where("device_id = ?", b.DeviceId).Find(&olds).Error; e != nil {
+		zap.L().Error("获取设备端口失败", zap.Error(e))
+		return fmt.Errorf("获取设备端口失败, err: %w", e)
+	}
+	cs := diffRecords(olds, data, portChangeOption)
+	b.addLog("端口变更: %s", cs)
 	tx := database.DB.Begin()
-	if e := new(model.TDevicePort).DeleteByDeviceId(b.DeviceId, tx); e != nil {
+	if e := applyChanges(tx, b.DeviceId, cs, portChangeOption); e != nil {
 		tx.Rollback()
-		return e
-	}
-	for i := 0; i*100 < len(data); i++ {
-		r := (i + 1) * 100
-		if (i+1)*100 > len(data) {
-			r = len(data)
-		}
-		ports := data[i*100 : r]
-		if e := tx.Create(&ports).Error; e != nil {
-			tx.Rollback()
-			zap.L().Error("保存调和端口失败", zap.Error(e))
-			return fmt.Errorf("保存设备端口失败, err: %w", e)
-		}
+		zap.L().Error("保存设备端口失败", zap.Error(e))
+		return fmt.Errorf("保存设备端口失败, err: %w", e)
 	}
 	if e := tx.Commit().Error; e != nil {
 		zap.L().Error("保存端口commit失败", zap.Error(e))
@@ -467,27 +405,34 @@ func (b *base) savePolicy(data []*model.TDevicePolicy) error {
 	if data == nil || len(data) == 0 {
 		return nil
 	}
+	olds := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", b.DeviceId).Find(&olds).Error; e != nil {
+		zap.L().Error("获取历史策略失败", zap.Error(e))
+		return fmt.Errorf("获取历史策略失败, err: %w", e)
+	}
+	cs := diffRecords(olds, data, policyChangeOption)
+	b.addLog("策略变更: %s", cs)
 	tx := database.DB.Begin()
-	if e := new(model.TDevicePolicy).DeleteByDeviceId(b.DeviceId, tx); e != nil {
+	if e := applyChanges(tx, b.DeviceId, cs, policyChangeOption); e != nil {
 		tx.Rollback()
-		return e
+		zap.L().Error("保存策略信息失败", zap.Error(e))
+		return fmt.Errorf("保存策略信息失败, err: %w", e)
 	}
-	for i := 0; i*100 < len(data); i++ {
-		r := (i + 1) * 100
-		if (i+1)*100 > len(data) {
-			r = len(data)
+	// 内容未变更的策略只更新所在行号
+	for _, v := range cs.unchanged {
+		if v[0].Line == v[1].Line {
+			continue
 		}
-		policies := data[i*100 : r]
-		if err := tx.Create(&policies).Error; err != nil {
+		if e := tx.Model(v[0]).Update("line", v[1].Line).Error; e != nil {
 			tx.Rollback()
-			zap.L().Error("保存策略信息失败", zap.Error(err))
-			return fmt.Errorf("保存策略信息失败, err: %w", err)
+			return fmt.Errorf("更新策略行号失败, err: %w", e)
 		}
 	}
 	if e := tx.Commit().Error; e != nil {
 		zap.L().Error("保存策略信息commit失败", zap.Error(e))
 		return fmt.Errorf("保存策略信息失败, err: %w", e)
 	}
+	invalidatePolicyMatcher(b.DeviceId)
 	return nil
 }
 
@@ -496,6 +441,10 @@ func (b *base) savePolicyHitCount(data []*model.TDevicePolicyHitCount) error {
 	if data == nil || len(data) == 0 {
 		return nil
 	}
+	histories, e := b.makePolicyHitCountHistories(data)
+	if e != nil {
+		return e
+	}
 	tx := database.DB.Begin()
 	if e := tx.Delete(&model.TDevicePolicyHitCount{}, "device_id = ?", b.device.Id).Error; e != nil {
 		tx.Rollback()
@@ -509,131 +458,83 @@ func (b *base) savePolicyHitCount(data []*model.TDevicePolicyHitCount) error {
 		}
 		policies := data[i*100 : r]
 		if err := tx.Create(&policies).Error; err != nil {
+			tx.Rollback()
 			zap.L().Error("保存策略命中数失败", zap.Error(err))
 			return fmt.Errorf("保存策略命中数失败, err: %w", err)
 		}
 	}
+	for i := 0; i*100 < len(histories); i++ {
+		r := (i + 1) * 100
+		if r > len(histories) {
+			r = len(histories)
+		}
+		items := histories[i*100 : r]
+		if e := tx.Create(&items).Error; e != nil {
+			tx.Rollback()
+			return fmt.Errorf("保存策略命中数历史失败, err: %w", e)
+		}
+	}
+	if e := tx.Delete(&model.TDevicePolicyHitCountHistory{}, "device_id = ? and collected_at < ?", b.device.Id,
+		time.Now().AddDate(0, 0, -hitCountHistoryDays)).Error; e != nil {
+		tx.Rollback()
+		return fmt.Errorf("清理过期策略命中数历史失败, err: %w", e)
+	}
+	if e := tx.Commit().Error; e != nil {
+		return fmt.Errorf("保存策略命中数commit失败, err: %w", e)
+	}
 	return nil
 }
 
-func (b *base) SearchNat(info *model.TTaskInfo) *model.TDeviceNat {
+// 保存nat
+func (b *base) saveNat(data []*model.TDeviceNat) error {
+	if data == nil || len(data) == 0 {
+		return nil
+	}
+	olds := make([]*model.TDeviceNat, 0)
+	if e := database.DB.Where("device_id = ?", b.DeviceId).Find(&olds).Error; e != nil {
+		zap.L().Error("获取历史nat数据失败", zap.Error(e))
+		return fmt.Errorf("获取历史nat信息失败, err: %w", e)
+	}
+	cs := diffRecords(olds, data, natChangeOption)
+	b.addLog("保存nat, 变更: %s------------->", cs)
+	tx := database.DB.Begin()
+	if e := applyChanges(tx, b.DeviceId, cs, natChangeOption); e != nil {
+		tx.Rollback()
+		return fmt.Errorf("保存Nat信息异常: <%w>", e)
+	}
+	if e := tx.Commit().Error; e != nil {
+		return fmt.Errorf("保存nat信息异常")
+	}
 	return nil
 }
 
-// 保存nat
-func (b *base) saveNat(data []*model.TDeviceNat) error {
+// 保存解析好的nat pool信息
+func (b *base) saveNatPool(data []*model.TDeviceNatPool) error {
 	if data == nil || len(data) == 0 {
 		return nil
 	}
 	tx := database.DB.Begin()
-	if e := tx.Delete(&model.TDeviceNat{}, "device_id = ?", b.DeviceId).Error; e != nil {
+	if e := tx.Delete(&model.TDeviceNatPool{}, "device_id = ?", b.device.Id).Error; e != nil {
 		tx.Rollback()
-		zap.L().Error("清除历史nat数据失败", zap.Error(e))
-		return fmt.Errorf("清除历史nat信息失败, err: %w", e)
+		return fmt.Errorf("清除nat pool信息失败, err: %w", e)
 	}
-	b.addLog("保存nat------------->")
 	for i := 0; i*100 < len(data); i++ {
 		r := (i + 1) * 100
 		if (i+1)*100 > len(data) {
 			r = len(data)
 		}
-		nats := data[i*100 : r]
-		if e := tx.Create(&nats).Error; e != nil {
+		groups := data[i*100 : r]
+		if err := tx.Create(&groups).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("保存Nat信息异常: <%w>", e)
+			return fmt.Errorf("保存设备nat pool信息异常: <%s>", err.Error())
 		}
 	}
 	if e := tx.Commit().Error; e != nil {
-		return fmt.Errorf("保存nat信息异常")
+		return fmt.Errorf("保存nat pool信息异常: <%w>", e)
 	}
 	return nil
 }
 
-// 根据传入的设备策略，获取包含源目地址的策略
-func (b *base) getSubnetPolicy(policies []*model.TDevicePolicy, src, dst string) (result []*model.TDevicePolicy) {
-	srcPolicies := make([]*model.TDevicePolicy, 0)
-	result = make([]*model.TDevicePolicy, 0)
-	for _, sp := range policies {
-		// 如果源地址是办公网，则判断src_group是办公网的即可
-		if (src == conf.BanGongWang && sp.SrcGroup == conf.BanGongWang) || (src == conf.BanGongWangV6 && sp.SrcGroup == conf.BanGongWangV6) {
-			srcPolicies = append(srcPolicies, sp)
-			continue
-		}
-		// 如果源IP等于空，或者匹配到网段则加入源IP策略列表中
-		if src == "" {
-			srcPolicies = append(srcPolicies, sp)
-			continue
-		}
-		for _, s := range strings.Split(sp.Src, ",") {
-			if strings.Contains(s, "/32") && s != src { // 如果是32位地址，则直接判断相等
-				continue
-			}
-			if ok, _ := subnet.IsNet(s, src); !ok { // 不是32位地址，则判断是否在此网段中
-				continue
-			}
-			srcPolicies = append(srcPolicies, sp)
-			break // 当前条策略，匹配到一个就可以
-		}
-	}
-	// 通过源IP策略列表继续过滤目标IP地址
-	for _, sp := range srcPolicies {
-		// 如果目标IP等于空，或者匹配到网段则加入源IP策略列表中
-		if dst == "" {
-			result = append(result, sp)
-			continue
-		}
-		for _, d := range strings.Split(sp.Dst, ",") {
-			// 完全匹配地址
-			if strings.Contains(d, "/32") && d != dst { // 如果是32位地址，则直接判断相等
-				continue
-			}
-			// 匹配网段
-			if ok, _ := subnet.IsNet(d, dst); !ok { // 不是32位地址，则判断是否在此网段中
-				continue
-			}
-			result = append(result, sp)
-			break
-		}
-	}
-	return
-}
-
-// 根据符合条件的策略信息获取范围最小的策略信息
-func (b *base) getPolicy(policies []*model.TDevicePolicy, src, dst string) (result *model.TDevicePolicy) {
-	result = &model.TDevicePolicy{}
-	for _, v := range policies {
-		// 循环源地址，取出当前行最小的源地址
-		minSrc := b.getMinSubnet(src, v.Src)
-		// 循环目标地址，取出当前行最小的目标地址
-		minDst := b.getMinSubnet(dst, v.Dst)
-		if result.Src == "" {
-			result = v
-			result.Src = minSrc
-			result.Dst = minDst
-			continue
-		}
-
-		// 和上一条策略对比范围，如果比比上一条符合的策略网段大，则跳过
-		if ok, _ := subnet.IsNet(result.Src, minSrc); !ok {
-			continue
-		}
-		// 如果最小的地址和源地址不相等（说明比上条更小），则取当前策略
-		if minSrc != result.Src {
-			result = v
-			result.Src = minSrc
-			result.Dst = minDst
-		} else {
-			// 否则对比目标网段，取目标网段最小的策略
-			if ok, _ := subnet.IsNet(result.Dst, minDst); ok {
-				result = v
-				result.Src = minSrc
-				result.Direction = minDst
-			}
-		}
-	}
-	return
-}
-
 // 根据传入的设备策略，获取包含源目地址的策略
 func (b *base) getSubnetNat(nats []*model.TDeviceNat, src, dst string) (result []*model.TDeviceNat) {
 	srcNats := make([]*model.TDeviceNat, 0) // 源地址匹配的nat策略信息
@@ -0,0 +1,195 @@
+package device
+
+import (
+	"fmt"
+	"netops/database"
+	"netops/model"
+	"regexp"
+	"strings"
+)
+
+const (
+	DecommissionStageDisable    = "disable"
+	DecommissionStageDelete     = "delete"
+	DecommissionStageReactivate = "reactivate"
+)
+
+// FindDecommissionPolicies 根据策略ID和策略命中数ID获取待下线的策略，
+// asa每条access-list单独下线，其他设备同名策略的多行合并为一条
+func FindDecommissionPolicies(deviceId int, policyIds, hitCountIds []int) ([]*model.TPolicyDecommission, error) {
+	vendor, e := getDeviceVendor(deviceId)
+	if e != nil {
+		return nil, e
+	}
+	if _, ok := decommissionCommands[vendor]; !ok {
+		return nil, fmt.Errorf("暂不支持当前类型的设备下线策略, 设备类型: %s", vendor)
+	}
+	policies := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Order("line, id").Find(&policies).Error; e != nil {
+		return nil, fmt.Errorf("获取设备策略失败, device_id: %d, err: %w", deviceId, e)
+	}
+	policyKey := func(p *model.TDevicePolicy) string {
+		if vendor == "asa" {
+			return strings.Join(splitLineBySpace(p.Command), " ")
+		}
+		return fmt.Sprintf("%d-%s-%s", deviceId, p.Direction, p.Name)
+	}
+	ids := make(map[int]bool)
+	for _, v := range policyIds {
+		ids[v] = true
+	}
+	keys := make(map[string]bool)
+	if len(hitCountIds) > 0 {
+		hits := make([]*model.TDevicePolicyHitCount, 0)
+		if e := database.DB.Where("device_id = ? and id in ?", deviceId, hitCountIds).Find(&hits).Error; e != nil {
+			return nil, fmt.Errorf("获取策略命中数失败, device_id: %d, err: %w", deviceId, e)
+		}
+		for _, v := range hits {
+			if vendor == "asa" {
+				keys[asaHitCountCommand(v.Command)] = true
+			} else {
+				keys[v.Name] = true
+			}
+		}
+	}
+	results := make([]*model.TPolicyDecommission, 0)
+	exists := make(map[string]bool)
+	for _, p := range policies {
+		k := policyKey(p)
+		if !ids[p.Id] && !keys[k] {
+			continue
+		}
+		if exists[k] {
+			continue
+		}
+		exists[k] = true
+		results = append(results, &model.TPolicyDecommission{
+			DeviceId:   deviceId,
+			PolicyName: p.Name,
+			Direction:  p.Direction,
+			Command:    p.Command,
+		})
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("未获取到需要下线的策略, 请确认策略是否已被删除")
+	}
+	return results, nil
+}
+
+// show access-list的输出转换为配置中的命令
+// access-list sec line 182 extended permit tcp object-group A object-group B eq www (hitcnt=1) 0xef21f9bf
+// access-list sec extended permit tcp object-group A object-group B eq www
+func asaHitCountCommand(text string) string {
+	lines := splitLineBySpace(text)
+	if len(lines) < 6 || lines[2] != "line" {
+		return text
+	}
+	results := append([]string{}, lines[:2]...)
+	results = append(results, lines[4:len(lines)-2]...)
+	return strings.Join(results, " ")
+}
+
+// DecommissionCommands 生成策略下线各阶段的命令，stage为disable delete reactivate
+func DecommissionCommands(deviceId int, stage string, policies []*model.TPolicyDecommission) (string, error) {
+	vendor, e := getDeviceVendor(deviceId)
+	if e != nil {
+		return "", e
+	}
+	gene, ok := decommissionCommands[vendor]
+	if !ok {
+		return "", fmt.Errorf("暂不支持当前类型的设备下线策略, 设备类型: %s", vendor)
+	}
+	builder := strings.Builder{}
+	for _, v := range policies {
+		cmd, e := gene(stage, v)
+		if e != nil {
+			return "", e
+		}
+		builder.WriteString(cmd)
+	}
+	return builder.String(), nil
+}
+
+func getDeviceVendor(deviceId int) (string, error) {
+	device := model.TFirewallDevice{}
+	if e := device.FirstById(deviceId); e != nil {
+		return "", e
+	}
+	deviceType := model.TDeviceType{}
+	if e := deviceType.FirstById(device.DeviceTypeId); e != nil {
+		return "", e
+	}
+	return strings.ToLower(deviceType.Name), nil
+}
+
+var srxZoneRegexp = regexp.MustCompile(`from-zone (\S+) to-zone (\S+)`)
+
+// h3c的ipv4和ipv6策略在不同的security-policy视图下，策略的任一行包含ipv6地址时为ipv6
+func h3cPolicyIpType(policies []*model.TDevicePolicy) string {
+	for _, v := range policies {
+		if strings.Contains(v.Src, ":") || strings.Contains(v.Dst, ":") {
+			return "ipv6"
+		}
+	}
+	return "ip"
+}
+
+// 各厂商禁用、删除和重新启用策略的命令
+var decommissionCommands = map[string]func(stage string, p *model.TPolicyDecommission) (string, error){
+	"asa": func(stage string, p *model.TPolicyDecommission) (string, error) {
+		// 禁用后配置中会带上inactive，重新输入不带inactive的命令即可重新启用
+		cmd := strings.TrimSuffix(strings.Join(splitLineBySpace(p.Command), " "), " inactive")
+		switch stage {
+		case DecommissionStageDisable:
+			return fmt.Sprintf("%s inactive\n", cmd), nil
+		case DecommissionStageDelete:
+			return fmt.Sprintf("no %s\n", cmd), nil
+		case DecommissionStageReactivate:
+			return fmt.Sprintf("%s\n", cmd), nil
+		}
+		return "", fmt.Errorf("未知的下线阶段: %s", stage)
+	},
+	"srx": func(stage string, p *model.TPolicyDecommission) (string, error) {
+		r := srxZoneRegexp.FindStringSubmatch(p.Command)
+		if r == nil {
+			return "", fmt.Errorf("策略<%s>未解析到from-zone和to-zone", p.PolicyName)
+		}
+		operates := map[string]string{
+			DecommissionStageDisable:    "deactivate",
+			DecommissionStageDelete:     "delete",
+			DecommissionStageReactivate: "activate",
+		}
+		operate, ok := operates[stage]
+		if !ok {
+			return "", fmt.Errorf("未知的下线阶段: %s", stage)
+		}
+		return fmt.Sprintf("%s security policies from-zone %s to-zone %s policy %s\n", operate, r[1], r[2], p.PolicyName), nil
+	},
+	"h3c": func(stage string, p *model.TPolicyDecommission) (string, error) {
+		policies := make([]*model.TDevicePolicy, 0)
+		if e := database.DB.Where("device_id = ? and name = ?", p.DeviceId, p.PolicyName).Find(&policies).Error; e != nil {
+			return "", fmt.Errorf("获取策略地址类型失败, err: %w", e)
+		}
+		ipType := h3cPolicyIpType(policies)
+		switch stage {
+		case DecommissionStageDisable:
+			return fmt.Sprintf("security-policy %s\n rule name %s\n  disable\n", ipType, p.PolicyName), nil
+		case DecommissionStageDelete:
+			return fmt.Sprintf("security-policy %s\n undo rule name %s\n", ipType, p.PolicyName), nil
+		case DecommissionStageReactivate:
+			return fmt.Sprintf("security-policy %s\n rule name %s\n  undo disable\n", ipType, p.PolicyName), nil
+		}
+		return "", fmt.Errorf("未知的下线阶段: %s", stage)
+	},
+	"huawei": func(stage string, p *model.TPolicyDecommission) (string, error) {
+		switch stage {
+		case DecommissionStageDisable:
+			return fmt.Sprintf("security-policy\n rule name %s\n  disable\n", p.PolicyName), nil
+		case DecommissionStageDelete:
+			return fmt.Sprintf("security-policy\n undo rule name %s\n", p.PolicyName), nil
+		case DecommissionStageReactivate:
+			return fmt.Sprintf("security-policy\n rule name %s\n  enable\n", p.PolicyName), nil
+		}
+		return "", fmt.Errorf("未知的下线阶段: %s", stage)
+	},
+}
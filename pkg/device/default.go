@@ -18,6 +18,9 @@ type Handler interface {
 	CheckNat(info *model.TTaskInfo) error
 	SearchNat(info *model.TTaskInfo) *model.TDeviceNat
 	init()
+	SetOffline(config *OfflineConfig)                        // 设置离线配置，用于离线解析
+	CheckHaSync() (string, error)                            // 对比HA两台设备的配置，返回差异
+	ValidateCommand(command string) error                    // 下发前按厂商语法校验生成的命令
 	GeneShowCmd(groupName, subnet string) string             // 生成黑名单任务命令，subnet必须是带掩码的IP地址
 	GeneDenyCmd(groupName, subnet string) string             // 生成黑名单任务命令，subnet必须是带掩码的IP地址
 	GenePermitCmd(groupNames []string, subnet string) string // 生成黑名单任务命令，subnet必须是带掩码的IP地址
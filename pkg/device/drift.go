@@ -0,0 +1,403 @@
+package device
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DriftTypeMissing   = "missing"   // 工单下发的对象在设备上不存在
+	DriftTypeModified  = "modified"  // 对象内容与工单不一致
+	DriftTypeUnmanaged = "unmanaged" // 使用了工单命名但没有对应的已执行工单
+
+	DriftStatusOpen     = "open"
+	DriftStatusResolved = "resolved"
+
+	driftObjectPolicy       = "policy"
+	driftObjectAddressGroup = "address_group"
+)
+
+// 工单生成的对象名为<JiraKey>-<infoId>，地址组和端口组带-SRC、-DST、-SERVICE后缀，见base.groupName
+var managedNamePattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_]*-\d+)-(\d+)(?:-SRC|-DST|-SERVICE)?$`)
+
+// asa策略命令中的行号只用于插入位置，解析出的配置中没有
+var asaLinePattern = regexp.MustCompile(` line \d+ `)
+
+// 已执行成功的工单策略，names为命令中本工单策略创建的对象名
+type managedInfo struct {
+	info      *model.TTaskInfo
+	jiraKey   string
+	groupName string
+	names     map[string]bool
+}
+
+// DetectDrift 对比设备上工单下发的策略和地址组与解析结果，返回未解决的漂移数
+func DetectDrift(deviceId int) (int, error) {
+	b := &base{DeviceId: deviceId}
+	b.init()
+	if b.error != nil {
+		return 0, b.error
+	}
+	return b.detectDrift()
+}
+
+func (b *base) detectDrift() (int, error) {
+	infos, e := b.managedInfos()
+	if e != nil {
+		return 0, e
+	}
+	policies := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", b.DeviceId).Order("line, id").Find(&policies).Error; e != nil {
+		return 0, fmt.Errorf("获取设备策略失败, device_id: %d, err: %w", b.DeviceId, e)
+	}
+	groups := make([]*model.TDeviceAddressGroup, 0)
+	if e := database.DB.Where("device_id = ?", b.DeviceId).Find(&groups).Error; e != nil {
+		return 0, fmt.Errorf("获取设备地址组失败, device_id: %d, err: %w", b.DeviceId, e)
+	}
+	decommissions := make([]*model.TPolicyDecommission, 0)
+	if e := database.DB.Where("device_id = ? and status in ?", b.DeviceId, []string{"disabling", "disabled", "deleting", "deleted"}).
+		Find(&decommissions).Error; e != nil {
+		return 0, fmt.Errorf("获取设备策略下线记录失败, device_id: %d, err: %w", b.DeviceId, e)
+	}
+	groupM := make(map[string][]string)
+	for _, v := range groups {
+		groupM[v.Name] = append(groupM[v.Name], v.Address)
+	}
+	vendor := strings.ToLower(b.deviceType.Name)
+	currents, keys := make(map[string]*model.TDriftFinding), make([]string, 0)
+	add := func(f *model.TDriftFinding) {
+		f.DeviceId = b.DeviceId
+		k := driftFindingKey(f)
+		if _, ok := currents[k]; ok {
+			return
+		}
+		currents[k] = f
+		keys = append(keys, k)
+	}
+	for _, m := range infos {
+		// 已通过策略下线流程禁用或删除的策略不算漂移
+		if m.decommissioned(decommissions) {
+			continue
+		}
+		for _, f := range b.checkManagedInfo(vendor, m, policies, groupM) {
+			add(f)
+		}
+	}
+	unmanaged, e := unmanagedObjects(infos, policies, groups)
+	if e != nil {
+		return 0, e
+	}
+	for _, f := range unmanaged {
+		add(f)
+	}
+	return saveDriftFindings(b.DeviceId, currents, keys)
+}
+
+// 获取设备上已执行成功的工单策略，清理、下线等直接下发命令的任务项不是开通的策略，不检查
+func (b *base) managedInfos() (map[int]*managedInfo, error) {
+	infos := make([]*model.TTaskInfo, 0)
+	if e := database.DB.Where("device_id = ? and status = ? and command != '' and command_only = 0", b.DeviceId, conf.TaskStatusSuccess).
+		Find(&infos).Error; e != nil {
+		return nil, fmt.Errorf("获取设备已执行的工单策略失败, device_id: %d, err: %w", b.DeviceId, e)
+	}
+	jiraKeys, e := taskJiraKeys(infos)
+	if e != nil {
+		return nil, e
+	}
+	results := make(map[int]*managedInfo)
+	for _, v := range infos {
+		jiraKey, ok := jiraKeys[v.TaskId]
+		if !ok {
+			continue
+		}
+		groupName := b.groupName(jiraKey, v)
+		own := map[string]bool{
+			groupName:                      true,
+			b.geneSrcGroupName(groupName):  true,
+			b.geneDstGroupName(groupName):  true,
+			b.genePortGroupName(groupName): true,
+		}
+		m := &managedInfo{info: v, jiraKey: jiraKey, groupName: groupName, names: make(map[string]bool)}
+		for _, token := range strings.Fields(v.Command) {
+			if token = strings.Trim(token, `"`); own[token] {
+				m.names[token] = true
+			}
+		}
+		// 策略全部复用已有对象且不是按工单命名的策略，无法识别归属
+		if len(m.names) == 0 && len(asaPolicyLines(v.Command)) == 0 {
+			continue
+		}
+		results[v.Id] = m
+	}
+	return results, nil
+}
+
+// 任务id对应的工单号
+func taskJiraKeys(infos []*model.TTaskInfo) (map[int]string, error) {
+	results := make(map[int]string)
+	taskIds := make([]int, 0)
+	for _, v := range infos {
+		taskIds = append(taskIds, v.TaskId)
+	}
+	if len(taskIds) == 0 {
+		return results, nil
+	}
+	tasks := make([]*model.TTask, 0)
+	if e := database.DB.Select("id", "jira_key").Where("id in ?", taskIds).Find(&tasks).Error; e != nil {
+		return nil, fmt.Errorf("获取工单信息失败, err: %w", e)
+	}
+	for _, v := range tasks {
+		results[v.Id] = v.JiraKey
+	}
+	return results, nil
+}
+
+func (m *managedInfo) decommissioned(decommissions []*model.TPolicyDecommission) bool {
+	for _, d := range decommissions {
+		if d.PolicyName == m.groupName {
+			return true
+		}
+		for n := range m.names {
+			if strings.Contains(d.Command, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *managedInfo) finding(typ, objectType, name, detail string, args ...any) *model.TDriftFinding {
+	return &model.TDriftFinding{
+		Type:       typ,
+		ObjectType: objectType,
+		Name:       name,
+		JiraKey:    m.jiraKey,
+		TaskId:     m.info.TaskId,
+		InfoId:     m.info.Id,
+		Detail:     fmt.Sprintf(detail, args...),
+	}
+}
+
+// asa的策略名为acl名称，通过工单命令中的access-list行识别
+func asaPolicyLines(command string) map[string]bool {
+	results := make(map[string]bool)
+	for _, line := range strings.Split(command, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "access-list ") {
+			results[asaLinePattern.ReplaceAllString(line, " ")] = true
+		}
+	}
+	return results
+}
+
+// 检查工单策略对应的策略和地址组是否缺失或被修改
+func (b *base) checkManagedInfo(vendor string, m *managedInfo, policies []*model.TDevicePolicy, groupM map[string][]string) []*model.TDriftFinding {
+	results := make([]*model.TDriftFinding, 0)
+	owned := make([]*model.TDevicePolicy, 0)
+	expected := m.names[m.groupName]
+	if vendor == "asa" {
+		lines := asaPolicyLines(m.info.Command)
+		expected = len(lines) > 0
+		for _, p := range policies {
+			if lines[strings.TrimSpace(p.Command)] {
+				owned = append(owned, p)
+			}
+		}
+	} else {
+		for _, p := range policies {
+			if p.Name == m.groupName {
+				owned = append(owned, p)
+			}
+		}
+	}
+	switch {
+	case expected && len(owned) == 0:
+		results = append(results, m.finding(DriftTypeMissing, driftObjectPolicy, m.groupName, "工单下发的策略在设备上不存在"))
+	case len(owned) > 0:
+		if details := policyDrift(vendor, m.info, owned); len(details) > 0 {
+			results = append(results, m.finding(DriftTypeModified, driftObjectPolicy, owned[0].Name, strings.Join(details, "; ")))
+		}
+	}
+	for name, address := range map[string]string{
+		b.geneSrcGroupName(m.groupName): m.info.Src,
+		b.geneDstGroupName(m.groupName): m.info.Dst,
+	} {
+		if !m.names[name] {
+			continue
+		}
+		addresses, ok := groupM[name]
+		if !ok {
+			results = append(results, m.finding(DriftTypeMissing, driftObjectAddressGroup, name, "工单下发的地址组在设备上不存在"))
+			continue
+		}
+		if !addressEqual(strings.Join(addresses, ","), address) {
+			results = append(results, m.finding(DriftTypeModified, driftObjectAddressGroup, name,
+				"地址组内容<%s>与工单<%s>不一致", strings.Join(addresses, ","), address))
+		}
+	}
+	return results
+}
+
+// 对比策略与工单的动作、状态、地址和端口，srx一条策略的多个应用会解析成多行，合并后对比
+func policyDrift(vendor string, info *model.TTaskInfo, owned []*model.TDevicePolicy) []string {
+	results := make([]string, 0)
+	srcs, srcGroups, dsts, ports := make([]string, 0), make([]string, 0), make([]string, 0), make([]string, 0)
+	for _, p := range owned {
+		if p.Action != "permit" {
+			results = append(results, fmt.Sprintf("策略动作为%s", p.Action))
+		}
+		if policyInactive(vendor, p) {
+			results = append(results, "策略未生效")
+		}
+		srcs, srcGroups, dsts, ports = append(srcs, p.Src), append(srcGroups, p.SrcGroup), append(dsts, p.Dst), append(ports, p.Port)
+	}
+	if info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6 {
+		if !strings.Contains(strings.Join(srcGroups, ","), info.Src) {
+			results = append(results, fmt.Sprintf("源地址组<%s>不包含%s", strings.Join(srcGroups, ","), info.Src))
+		}
+	} else if src := strings.Join(srcs, ","); !addressEqual(src, info.Src) {
+		results = append(results, fmt.Sprintf("源地址<%s>与工单<%s>不一致", src, info.Src))
+	}
+	if dst := strings.Join(dsts, ","); !addressEqual(dst, info.Dst) {
+		results = append(results, fmt.Sprintf("目标地址<%s>与工单<%s>不一致", dst, info.Dst))
+	}
+	// 端口为服务名等无法解析时不对比
+	if strings.ToLower(info.Protocol) != "ip" {
+		port := strings.Join(ports, ",")
+		a, ok1 := parsePortSpans(port)
+		b, ok2 := parsePortSpans(info.DPort)
+		if ok1 && ok2 && !spansEqual(a, b) {
+			results = append(results, fmt.Sprintf("端口<%s>与工单<%s>不一致", port, info.DPort))
+		}
+	}
+	return results
+}
+
+// 地址范围是否一致，无法解析时按文本对比
+func addressEqual(a, b string) bool {
+	x, ok1 := parseAddressSpans(a)
+	y, ok2 := parseAddressSpans(b)
+	if !ok1 || !ok2 {
+		return a == b
+	}
+	return spansEqual(x, y)
+}
+
+// 设备上使用工单命名，但没有对应的已执行工单策略的对象
+func unmanagedObjects(infos map[int]*managedInfo, policies []*model.TDevicePolicy, groups []*model.TDeviceAddressGroup) ([]*model.TDriftFinding, error) {
+	type object struct {
+		objectType string
+		name       string
+		jiraKey    string
+		infoId     int
+	}
+	objects, infoIds, seen := make([]*object, 0), make([]int, 0), make(map[string]bool)
+	check := func(objectType, name string) {
+		r := managedNamePattern.FindStringSubmatch(name)
+		if r == nil || seen[objectType+name] {
+			return
+		}
+		seen[objectType+name] = true
+		infoId, _ := strconv.Atoi(r[2])
+		if m, ok := infos[infoId]; ok && m.jiraKey == r[1] {
+			return
+		}
+		objects = append(objects, &object{objectType: objectType, name: name, jiraKey: r[1], infoId: infoId})
+		infoIds = append(infoIds, infoId)
+	}
+	for _, p := range policies {
+		check(driftObjectPolicy, p.Name)
+	}
+	for _, g := range groups {
+		check(driftObjectAddressGroup, g.Name)
+	}
+	results := make([]*model.TDriftFinding, 0, len(objects))
+	if len(objects) == 0 {
+		return results, nil
+	}
+	// 关联名称中的工单策略，便于确认对象来源
+	infoM := make(map[int]*model.TTaskInfo)
+	taskInfos := make([]*model.TTaskInfo, 0)
+	if e := database.DB.Where("id in ?", infoIds).Find(&taskInfos).Error; e != nil {
+		return nil, fmt.Errorf("获取工单策略失败, err: %w", e)
+	}
+	jiraKeys, e := taskJiraKeys(taskInfos)
+	if e != nil {
+		return nil, e
+	}
+	for _, v := range taskInfos {
+		infoM[v.Id] = v
+	}
+	for _, v := range objects {
+		f := &model.TDriftFinding{Type: DriftTypeUnmanaged, ObjectType: v.objectType, Name: v.name, JiraKey: v.jiraKey}
+		info, ok := infoM[v.infoId]
+		switch {
+		case !ok:
+			f.Detail = "未找到名称对应的工单策略"
+		case jiraKeys[info.TaskId] != v.jiraKey:
+			f.Detail = fmt.Sprintf("名称对应的工单策略属于工单%s", jiraKeys[info.TaskId])
+		case info.Status != conf.TaskStatusSuccess:
+			f.TaskId, f.InfoId = info.TaskId, info.Id
+			f.Detail = fmt.Sprintf("工单策略未执行成功, 状态: %s", info.Status)
+		default:
+			f.TaskId, f.InfoId = info.TaskId, info.Id
+			f.Detail = "工单策略不是下发到当前设备"
+		}
+		results = append(results, f)
+	}
+	return results, nil
+}
+
+func driftFindingKey(f *model.TDriftFinding) string {
+	return fmt.Sprintf("%s|%s|%s", f.Type, f.ObjectType, f.Name)
+}
+
+// 保存本次检查结果，已不存在的漂移标记为已解决
+func saveDriftFindings(deviceId int, currents map[string]*model.TDriftFinding, keys []string) (int, error) {
+	olds := make([]*model.TDriftFinding, 0)
+	if e := database.DB.Where("device_id = ? and status = ?", deviceId, DriftStatusOpen).Find(&olds).Error; e != nil {
+		return 0, fmt.Errorf("获取设备漂移结果失败, device_id: %d, err: %w", deviceId, e)
+	}
+	now := time.Now()
+	tx := database.DB.Begin()
+	for _, old := range olds {
+		k := driftFindingKey(old)
+		if current, ok := currents[k]; ok {
+			delete(currents, k)
+			old.JiraKey, old.TaskId, old.InfoId, old.Detail = current.JiraKey, current.TaskId, current.InfoId, current.Detail
+		} else {
+			old.Status = DriftStatusResolved
+			old.ResolvedAt = &now
+		}
+		if e := tx.Save(old).Error; e != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("更新漂移结果失败, err: %w", e)
+		}
+	}
+	news := make([]*model.TDriftFinding, 0)
+	for _, k := range keys {
+		if f, ok := currents[k]; ok {
+			f.Status = DriftStatusOpen
+			news = append(news, f)
+		}
+	}
+	if len(news) > 0 {
+		if e := tx.CreateInBatches(news, 100).Error; e != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("保存漂移结果失败, err: %w", e)
+		}
+	}
+	if e := tx.Commit().Error; e != nil {
+		return 0, fmt.Errorf("保存漂移结果commit失败, err: %w", e)
+	}
+	var count int64
+	if e := database.DB.Model(&model.TDriftFinding{}).Where("device_id = ? and status = ?", deviceId, DriftStatusOpen).Count(&count).Error; e != nil {
+		return 0, fmt.Errorf("获取设备漂移数量失败, device_id: %d, err: %w", deviceId, e)
+	}
+	return int(count), nil
+}
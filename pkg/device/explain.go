@@ -0,0 +1,303 @@
+package device
+
+import (
+	"fmt"
+	"netops/database"
+	"netops/model"
+	"sort"
+	"strings"
+)
+
+const (
+	ExplainVerdictPermit  = "permit"
+	ExplainVerdictDeny    = "deny"
+	ExplainVerdictNoMatch = "no_match"
+)
+
+// FlowExplain 访问流量的匹配过程，类似packet-tracer，说明设备、方向、每条候选策略和nat转换
+type FlowExplain struct {
+	Src             string         `json:"src"`
+	Dst             string         `json:"dst"`
+	Protocol        string         `json:"protocol"`
+	Port            string         `json:"port"`
+	Direction       string         `json:"direction"`
+	DirectionReason string         `json:"direction_reason"`
+	DeviceId        int            `json:"device_id"`
+	Device          string         `json:"device"`
+	DeviceReason    string         `json:"device_reason"`
+	Verdict         string         `json:"verdict"`
+	MatchedPolicy   *RuleExplain   `json:"matched_policy"`
+	Rules           []*RuleExplain `json:"rules"`
+	Others          int            `json:"others"` // 源目地址都不包含的策略数，不在列表中展示
+	Nats            []*NatExplain  `json:"nats"`
+	Message         string         `json:"message"`
+}
+
+// RuleExplain 单条策略的匹配结果，每个维度是否包含查询的流量
+type RuleExplain struct {
+	PolicyId      int    `json:"policy_id"`
+	Name          string `json:"name"`
+	Line          int    `json:"line"`
+	Direction     string `json:"direction"`
+	Action        string `json:"action"`
+	Src           string `json:"src"`
+	SrcGroup      string `json:"src_group"`
+	Dst           string `json:"dst"`
+	DstGroup      string `json:"dst_group"`
+	Port          string `json:"port"`
+	PortGroup     string `json:"port_group"`
+	Protocol      string `json:"protocol"`
+	Inactive      bool   `json:"inactive"`
+	SrcMatch      bool   `json:"src_match"`
+	DstMatch      bool   `json:"dst_match"`
+	ProtocolMatch bool   `json:"protocol_match"`
+	PortMatch     bool   `json:"port_match"`
+	Matched       bool   `json:"matched"`
+	Hit           bool   `json:"hit"` // 按行号顺序第一条匹配的策略，决定访问结果
+	Reason        string `json:"reason"`
+}
+
+// NatExplain 适用于该流量的nat转换
+type NatExplain struct {
+	Table      string `json:"table"` // t_device_nat t_device_srx_nat
+	Id         int    `json:"id"`
+	Name       string `json:"name"`
+	NatType    string `json:"nat_type"`
+	Direction  string `json:"direction"`
+	Original   string `json:"original"`
+	Translated string `json:"translated"`
+	Command    string `json:"command"`
+}
+
+// ExplainPolicy 按行号顺序说明设备上每条候选策略是否匹配，源目地址都不包含的策略只计数
+func ExplainPolicy(deviceId int, direction, src, dst, protocol, port string) (*FlowExplain, error) {
+	q, e := newPolicyQuery(direction, src, dst, protocol, port)
+	if e != nil {
+		return nil, e
+	}
+	m, e := getPolicyMatcher(deviceId)
+	if e != nil {
+		return nil, e
+	}
+	result := &FlowExplain{
+		Src:       src,
+		Dst:       dst,
+		Protocol:  protocol,
+		Port:      port,
+		Direction: direction,
+		DeviceId:  deviceId,
+		Verdict:   ExplainVerdictNoMatch,
+		Rules:     make([]*RuleExplain, 0),
+		Nats:      make([]*NatExplain, 0),
+	}
+	items := make([]*RuleExplain, 0)
+	for _, r := range m.rules {
+		if direction != "" && r.policy.Direction != direction {
+			continue
+		}
+		v := newRuleExplain(r.policy)
+		v.SrcMatch, v.DstMatch, v.ProtocolMatch, v.PortMatch = r.srcMatch(q), r.dstMatch(q), r.protocolMatch(q), r.portMatch(q)
+		if !v.SrcMatch && !v.DstMatch {
+			result.Others++
+			continue
+		}
+		v.Matched = v.SrcMatch && v.DstMatch && v.ProtocolMatch && v.PortMatch
+		switch {
+		case v.Matched && result.MatchedPolicy == nil:
+			v.Hit = true
+			v.Reason = fmt.Sprintf("命中策略, 动作为%s", v.Action)
+			result.MatchedPolicy = v
+			if v.Action == "permit" {
+				result.Verdict = ExplainVerdictPermit
+			} else {
+				result.Verdict = ExplainVerdictDeny
+			}
+		case v.Matched:
+			v.Reason = fmt.Sprintf("匹配但不生效, 已被第%d行策略%s先匹配", result.MatchedPolicy.Line, result.MatchedPolicy.Name)
+		default:
+			v.Reason = ruleMismatchReason(v)
+		}
+		items = append(items, v)
+	}
+	// 未生效和地址无法解析的策略也展示，说明未匹配的原因
+	for _, p := range m.skipped {
+		if direction != "" && p.Direction != direction {
+			continue
+		}
+		if !addressContains(p.Src, src) && !addressContains(p.Dst, dst) {
+			result.Others++
+			continue
+		}
+		v := newRuleExplain(p)
+		v.Inactive = true
+		v.Reason = "策略未生效或目标地址无法解析, 不参与匹配"
+		items = append(items, v)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Line < items[j].Line
+	})
+	result.Rules = items
+	switch result.Verdict {
+	case ExplainVerdictPermit:
+		result.Message = fmt.Sprintf("第%d行策略%s允许访问", result.MatchedPolicy.Line, result.MatchedPolicy.Name)
+	case ExplainVerdictDeny:
+		result.Message = fmt.Sprintf("第%d行策略%s拒绝访问", result.MatchedPolicy.Line, result.MatchedPolicy.Name)
+	default:
+		result.Message = "没有匹配的策略, 访问被设备默认拒绝"
+	}
+	nats, e := ExplainNat(deviceId, direction, src, dst, port)
+	if e != nil {
+		return nil, e
+	}
+	result.Nats = nats
+	return result, nil
+}
+
+func newRuleExplain(p *model.TDevicePolicy) *RuleExplain {
+	return &RuleExplain{
+		PolicyId:  p.Id,
+		Name:      p.Name,
+		Line:      p.Line,
+		Direction: p.Direction,
+		Action:    p.Action,
+		Src:       p.Src,
+		SrcGroup:  p.SrcGroup,
+		Dst:       p.Dst,
+		DstGroup:  p.DstGroup,
+		Port:      p.Port,
+		PortGroup: p.PortGroup,
+		Protocol:  p.Protocol,
+	}
+}
+
+func ruleMismatchReason(v *RuleExplain) string {
+	reasons := make([]string, 0)
+	if !v.SrcMatch {
+		reasons = append(reasons, "源地址不包含")
+	}
+	if !v.DstMatch {
+		reasons = append(reasons, "目标地址不包含")
+	}
+	if !v.ProtocolMatch {
+		reasons = append(reasons, "协议不匹配")
+	}
+	if !v.PortMatch {
+		reasons = append(reasons, fmt.Sprintf("端口不包含(端口组: %s)", v.PortGroup))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// ExplainNat 获取适用于该流量的nat转换，入向匹配目标地址和端口，出向匹配源地址和目标地址
+func ExplainNat(deviceId int, direction, src, dst, port string) ([]*NatExplain, error) {
+	results := make([]*NatExplain, 0)
+	nats := make([]*model.TDeviceNat, 0)
+	db := database.DB.Where("device_id = ?", deviceId)
+	if direction != "" {
+		db = db.Where("direction = ?", direction)
+	}
+	if e := db.Find(&nats).Error; e != nil {
+		return nil, fmt.Errorf("获取设备nat失败, device_id: %d, err: %w", deviceId, e)
+	}
+	for _, v := range nats {
+		var ok bool
+		if v.Direction == "inside" {
+			ok = (addressContains(v.Static, dst) || addressContains(v.Network, dst)) &&
+				(portContains(v.StaticPort, port) || portContains(v.NetworkPort, port))
+		} else {
+			ok = addressContains(v.Network, src) && (v.Destination == "" || addressContains(v.Destination, dst))
+		}
+		if !ok {
+			continue
+		}
+		results = append(results, &NatExplain{
+			Table:      model.TDeviceNat{}.TableName(),
+			Id:         v.Id,
+			Name:       v.StaticGroup,
+			Direction:  v.Direction,
+			Original:   natAddress(v.Network, v.NetworkPort),
+			Translated: natAddress(v.Static, v.StaticPort),
+			Command:    v.Command,
+		})
+	}
+	srxNats := make([]*model.TDeviceSrxNat, 0)
+	db = database.DB.Where("device_id = ?", deviceId)
+	if direction != "" {
+		db = db.Where("direction = ?", direction)
+	}
+	if e := db.Find(&srxNats).Error; e != nil {
+		return nil, fmt.Errorf("获取设备nat规则失败, device_id: %d, err: %w", deviceId, e)
+	}
+	if len(srxNats) == 0 {
+		return results, nil
+	}
+	pools := make([]*model.TDeviceNatPool, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&pools).Error; e != nil {
+		return nil, fmt.Errorf("获取设备nat pool失败, device_id: %d, err: %w", deviceId, e)
+	}
+	poolM := make(map[string]*model.TDeviceNatPool)
+	for _, v := range pools {
+		poolM[v.NatType+"|"+v.Name] = v
+	}
+	for _, v := range srxNats {
+		ok := (v.Src == "" || addressContains(v.Src, src)) && (v.Dst == "" || addressContains(v.Dst, dst))
+		if v.NatType == "destination" && v.DstPort != "" {
+			ok = ok && portContains(v.DstPort, port)
+		}
+		if !ok {
+			continue
+		}
+		item := &NatExplain{
+			Table:     model.TDeviceSrxNat{}.TableName(),
+			Id:        v.Id,
+			Name:      v.Rule,
+			NatType:   v.NatType,
+			Direction: v.Direction,
+			Command:   v.Command,
+		}
+		if v.NatType == "destination" {
+			item.Original = natAddress(dst, port)
+		} else {
+			item.Original = src
+		}
+		if pool, ok := poolM[v.NatType+"|"+v.Pool]; ok {
+			item.Translated = natAddress(pool.Address, pool.Port)
+		} else {
+			item.Translated = v.Pool
+		}
+		results = append(results, item)
+	}
+	return results, nil
+}
+
+// 地址列表是否包含查询的地址，查询地址为空时不限制
+func addressContains(text, address string) bool {
+	if address == "" {
+		return true
+	}
+	a, ok := parseAddressSpans(text)
+	if !ok {
+		return false
+	}
+	b, ok := parseAddressSpans(address)
+	return ok && spansCover(a, b, compareIP)
+}
+
+// 端口列表是否包含查询的端口，任意一方为空时不限制
+func portContains(text, port string) bool {
+	if port == "" || text == "" {
+		return true
+	}
+	a, ok := parsePortSpans(text)
+	if !ok {
+		return false
+	}
+	b, ok := parsePortSpans(port)
+	return ok && spansCover(a, b, compareInt)
+}
+
+func natAddress(address, port string) string {
+	if port == "" || isAny(strings.ToLower(port)) {
+		return address
+	}
+	return fmt.Sprintf("%s:%s", address, port)
+}
@@ -9,6 +9,7 @@ import (
 	"netops/grpc_client/net_api"
 	net_api2 "netops/grpc_client/protobuf/net_api"
 	"netops/model"
+	"netops/pkg/credential"
 	subnet2 "netops/pkg/subnet"
 	"netops/utils"
 	"strings"
@@ -270,6 +271,7 @@ type F5Parse struct {
 	error      error
 	client     *net_api.Client
 	operateLog *model.TPolicyLog
+	offline    *OfflineConfig
 }
 
 func (f *F5Parse) Error() error {
@@ -342,22 +344,40 @@ func (f *F5Parse) ParseConfig() error {
 	}
 	f.addLog("清除历史数据--->")
 	f.clear()
-	go func() {
-		f.addLog("解析vs--->")
-		if e := f.parseVs(); e != nil {
-			f.parseFailed(e)
-			return
-		}
-		f.addLog("解析pool信息")
-		if e := f.parsePool(); e != nil {
-			f.parseFailed(e)
-			return
-		}
-		f.parseSuccess()
-	}()
+	go f.parse()
+	return nil
+}
+
+// ParseOffline 使用离线配置同步解析，不依赖net_api
+func (f *F5Parse) ParseOffline(config *OfflineConfig) error {
+	if f.error != nil {
+		return f.error
+	}
+	f.offline = config
+	f.addLog("使用离线配置解析--->")
+	if e := f.device.UpdateParseStatus(ParseStatusInit); e != nil {
+		return e
+	}
+	f.addLog("清除历史数据--->")
+	f.clear()
+	f.parse()
 	return nil
 }
 
+func (f *F5Parse) parse() {
+	f.addLog("解析vs--->")
+	if e := f.parseVs(); e != nil {
+		f.parseFailed(e)
+		return
+	}
+	f.addLog("解析pool信息")
+	if e := f.parsePool(); e != nil {
+		f.parseFailed(e)
+		return
+	}
+	f.parseSuccess()
+}
+
 func (f *F5Parse) parseSuccess() {
 	f.operateLog.Status = "success"
 	f.addLog("策略解析成功!")
@@ -370,11 +390,18 @@ func (f *F5Parse) parseFailed(e error) {
 }
 
 func (f *F5Parse) send(uri, method, params string, result any) error {
+	if f.offline != nil {
+		return f.sendOffline(uri, method, result)
+	}
+	account, e := credential.ResolveNlb(f.device)
+	if e != nil {
+		return e
+	}
 	req := &net_api2.HttpRequest{
 		Url:      fmt.Sprintf("https://%s%s", f.device.Host, uri),
 		Method:   method,
-		Username: f.device.Username,
-		Password: f.device.Password,
+		Username: account.Username,
+		Password: account.Password,
 		Params:   params,
 	}
 	message, e := f.client.Http(req)
@@ -391,6 +418,24 @@ func (f *F5Parse) send(uri, method, params string, result any) error {
 	return nil
 }
 
+// 离线模式下只支持查询接口
+func (f *F5Parse) sendOffline(uri, method string, result any) error {
+	if method != "GET" {
+		return fmt.Errorf("离线模式不支持下发配置, uri: %s", uri)
+	}
+	message, e := f.offline.uri(uri)
+	if e != nil {
+		return e
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(message), result); err != nil {
+		return fmt.Errorf("解析离线接口数据失败, uri: %s, err: %w", uri, err)
+	}
+	return nil
+}
+
 func (f *F5Parse) parsePool() error {
 	result := struct {
 		Items []PoolResult `json:"items"`
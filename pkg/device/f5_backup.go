@@ -0,0 +1,58 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"netops/conf"
+)
+
+// F5备份的LTM对象，key为备份json中的字段名
+var f5BackupUris = []struct {
+	key string
+	uri string
+}{
+	{"virtual", "/mgmt/tm/ltm/virtual/?expandSubcollections=true"},
+	{"pool", "/mgmt/tm/ltm/pool/?expandSubcollections=true"},
+	{"profile_http", "/mgmt/tm/ltm/profile/http/"},
+	{"profile_tcp", "/mgmt/tm/ltm/profile/tcp/"},
+	{"profile_fastl4", "/mgmt/tm/ltm/profile/fastl4/"},
+	{"profile_client_ssl", "/mgmt/tm/ltm/profile/client-ssl/"},
+	{"profile_server_ssl", "/mgmt/tm/ltm/profile/server-ssl/"},
+	{"profile_one_connect", "/mgmt/tm/ltm/profile/one-connect/"},
+	{"rule", "/mgmt/tm/ltm/rule/"},
+	{"snatpool", "/mgmt/tm/ltm/snatpool/"},
+}
+
+// Backup 通过iControl REST导出LTM对象保存为json备份，pool中包含member
+func (f *F5Parse) Backup() error {
+	if f.error != nil {
+		return f.error
+	}
+	defer f.CloseGrpc()
+	l := zap.L().With(zap.String("func", "F5Backup"), zap.Int("device_id", f.DeviceId))
+	l.Info("1. 获取设备配置------------>")
+	text, e := f.getBackupConfig()
+	if e != nil {
+		l.Error("调用接口失败", zap.Error(e))
+		return e
+	}
+	return saveBackup(conf.DeviceTypeNlb, f.DeviceId, f.device.Name, text)
+}
+
+// 获取各对象的json，按固定顺序缩进输出，便于备份之间按行对比
+func (f *F5Parse) getBackupConfig() (string, error) {
+	result := make(map[string]json.RawMessage)
+	for _, v := range f5BackupUris {
+		var data json.RawMessage
+		if e := f.send(v.uri, "GET", "", &data); e != nil {
+			return "", fmt.Errorf("获取F5配置失败, uri: %s, err: %w", v.uri, e)
+		}
+		result[v.key] = data
+	}
+	body, e := json.MarshalIndent(result, "", "  ")
+	if e != nil {
+		return "", fmt.Errorf("序列化F5配置失败, err: %w", e)
+	}
+	return string(body), nil
+}
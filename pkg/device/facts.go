@@ -0,0 +1,335 @@
+package device
+
+import (
+	"fmt"
+	"net"
+	"netops/database"
+	net_api2 "netops/grpc_client/protobuf/net_api"
+	"netops/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm/clause"
+)
+
+// 采集资产信息的命令id
+const (
+	factsVersion = iota + 1
+	factsInventory
+	factsHa
+	factsUptime
+	factsInterface
+	factsLicense
+	factsHaNode // srx集群当前登录的节点
+)
+
+// 各厂商采集资产信息的命令，命令id对应解析的内容
+var factsCommands = map[string][]*net_api2.Command{
+	"asa": {
+		{Id: factsVersion, Cmd: "show version"},
+		{Id: factsInventory, Cmd: "show inventory"},
+		{Id: factsHa, Cmd: "show failover"},
+		{Id: factsInterface, Cmd: "show interface ip brief"},
+		{Id: factsLicense, Cmd: "show activation-key"},
+	},
+	"srx": {
+		{Id: factsVersion, Cmd: "show version"},
+		{Id: factsInventory, Cmd: "show chassis hardware"},
+		{Id: factsHa, Cmd: "show chassis cluster status redundancy-group 0"},
+		{Id: factsHaNode, Cmd: "show chassis routing-engine node local"},
+		{Id: factsUptime, Cmd: "show system uptime"},
+		{Id: factsInterface, Cmd: "show interfaces terse"},
+		{Id: factsLicense, Cmd: "show system license"},
+	},
+	"h3c": {
+		{Id: factsVersion, Cmd: "display version"},
+		{Id: factsInventory, Cmd: "display device manuinfo"},
+		{Id: factsHa, Cmd: "display remote-backup-group status"},
+		{Id: factsInterface, Cmd: "display interface brief"},
+		{Id: factsLicense, Cmd: "display license"},
+	},
+	"huawei": {
+		{Id: factsVersion, Cmd: "display version"},
+		{Id: factsInventory, Cmd: "display esn"},
+		{Id: factsHa, Cmd: "display hrp state"},
+		{Id: factsInterface, Cmd: "display ip interface brief"},
+		{Id: factsLicense, Cmd: "display license"},
+	},
+}
+
+// 各厂商资产信息的正则，第一个分组为需要的值
+var factsPatterns = map[string]map[string]*regexp.Regexp{
+	"asa": {
+		"version": regexp.MustCompile(`Software Version (\S+)`),
+		"model":   regexp.MustCompile(`Hardware:\s+([^,\s]+)`),
+		"serial":  regexp.MustCompile(`(?:Serial Number:|SN:)\s*(\S+)`),
+		"uptime":  regexp.MustCompile(`(?m)^\S+ up (.+?)\s*$`),
+		"ha":      regexp.MustCompile(`This host:\s*\S+\s*-\s*(\w+)`),
+	},
+	"srx": {
+		"version": regexp.MustCompile(`(?:Junos:\s*|JUNOS Software Release \[)([^\s\]]+)`),
+		"model":   regexp.MustCompile(`Model:\s*(\S+)`),
+		"serial":  regexp.MustCompile(`(?m)^Chassis\s+(\S+)`),
+		"uptime":  regexp.MustCompile(`System booted:.*\((.+) ago\)`),
+		"ha":      regexp.MustCompile(`(?m)^(node\d+)\s+\d+\s+(primary|secondary(?:-hold)?)\b`),
+		"ha_node": regexp.MustCompile(`(?m)^(node\d+):`),
+	},
+	"h3c": {
+		"version": regexp.MustCompile(`Version (\S+?),? (Release \S+)`),
+		"model":   regexp.MustCompile(`(?m)^H3C (.+?) uptime is`),
+		"serial":  regexp.MustCompile(`DEVICE_SERIAL_NUMBER\s*:\s*(\S+)`),
+		"uptime":  regexp.MustCompile(`(?m)uptime is (.+?)\s*$`),
+		"ha":      regexp.MustCompile(`(?:Running status|Device role)\s*:\s*(\w+)`),
+	},
+	"huawei": {
+		"version": regexp.MustCompile(`Version \S+ \(\S+ (\S+)\)`),
+		"model":   regexp.MustCompile(`(?m)^(?:HUAWEI|Huawei)\s+(\S+) uptime is`),
+		"serial":  regexp.MustCompile(`ESN[^:]*:\s*(\S+)`),
+		"uptime":  regexp.MustCompile(`(?m)uptime is (.+?)\s*$`),
+		"ha":      regexp.MustCompile(`Role:\s*(\w+)`),
+	},
+}
+
+// CollectFacts 采集设备的型号、版本、序列号、HA角色、运行时间、接口和license信息
+func CollectFacts(deviceId int) (*model.TDeviceFacts, error) {
+	b := &base{DeviceId: deviceId}
+	b.init()
+	if b.error != nil {
+		return nil, b.error
+	}
+	vendor := strings.ToLower(b.deviceType.Name)
+	commands, ok := factsCommands[vendor]
+	if !ok {
+		return nil, fmt.Errorf("暂不支持当前类型的设备, 设备类型: %s", b.deviceType.Name)
+	}
+	// 未配置HA的设备不是集群，不查询当前节点
+	if !b.isHa() {
+		commands = excludeCommand(commands, factsHaNode)
+	}
+	result := &model.TDeviceFacts{DeviceId: deviceId, Device: b.device.Name, Vendor: vendor, CollectedAt: time.Now(), Interfaces: make([]*model.FactsInterface, 0)}
+	outputs, e := b.send(commands)
+	if e != nil {
+		result.Message = e.Error()
+		// 从未采集成功的设备也记录失败原因，已有的资产信息保持不变
+		if e := database.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "device_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"message", "collected_at"}),
+		}).Create(result).Error; e != nil {
+			return nil, fmt.Errorf("更新设备资产采集结果失败, err: %w", e)
+		}
+		return nil, fmt.Errorf("采集设备<%s>资产信息失败, err: %w", b.device.Name, e)
+	}
+	texts := make(map[int32]string)
+	for _, v := range outputs {
+		texts[v.Id] = strings.ReplaceAll(strings.ReplaceAll(v.Result, "---- More ----", ""), "\r", "\n")
+	}
+	parseFacts(result, texts)
+	if e := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"vendor", "model", "version", "serial", "ha_role", "uptime", "interfaces", "license", "message", "collected_at"}),
+	}).Create(result).Error; e != nil {
+		return nil, fmt.Errorf("保存设备资产信息失败, err: %w", e)
+	}
+	return result, nil
+}
+
+func excludeCommand(commands []*net_api2.Command, id int32) []*net_api2.Command {
+	results := make([]*net_api2.Command, 0, len(commands))
+	for _, v := range commands {
+		if v.Id != id {
+			results = append(results, v)
+		}
+	}
+	return results
+}
+
+// 按厂商的正则解析命令输出，运行时间未单独采集时从版本信息中获取
+func parseFacts(result *model.TDeviceFacts, texts map[int32]string) {
+	patterns := factsPatterns[result.Vendor]
+	find := func(key string, ids ...int32) string {
+		for _, id := range ids {
+			if r := patterns[key].FindStringSubmatch(texts[id]); r != nil {
+				return strings.TrimSpace(strings.Join(r[1:], " "))
+			}
+		}
+		return ""
+	}
+	result.Version = find("version", factsVersion)
+	result.Model = find("model", factsVersion, factsInventory)
+	result.Serial = find("serial", factsInventory, factsVersion)
+	result.Uptime = find("uptime", factsUptime, factsVersion)
+	result.HaRole = parseHaRole(result.Vendor, texts)
+	result.Interfaces = parseFactsInterfaces(texts[factsInterface])
+	result.License = strings.TrimSpace(texts[factsLicense])
+}
+
+/*
+解析HA角色:
+  - srx: 在redundancy-group 0的节点表中找到当前登录节点的状态，当前节点从node local命令输出的节点名获取
+    node0   200   primary     no   no   None
+  - 其他厂商: 命令输出中本机的角色
+*/
+func parseHaRole(vendor string, texts map[int32]string) string {
+	patterns := factsPatterns[vendor]
+	if vendor != "srx" {
+		if r := patterns["ha"].FindStringSubmatch(texts[factsHa]); r != nil {
+			return haRole(r[1])
+		}
+		return haRole("")
+	}
+	node := patterns["ha_node"].FindStringSubmatch(texts[factsHaNode])
+	if node == nil {
+		return haRole("")
+	}
+	for _, r := range patterns["ha"].FindAllStringSubmatch(texts[factsHa], -1) {
+		if r[1] == node[1] {
+			return haRole(strings.TrimSuffix(r[2], "-hold"))
+		}
+	}
+	return haRole("")
+}
+
+// 统一HA角色名称，未启用HA时为standalone
+func haRole(role string) string {
+	switch strings.ToLower(role) {
+	case "active", "primary", "master":
+		return "active"
+	case "standby", "secondary", "backup", "slave":
+		return "standby"
+	}
+	return "standalone"
+}
+
+/*
+解析接口列表，各厂商格式不同，按行取接口名、第一个地址和最后一个状态
+asa:    GigabitEthernet0/0  10.1.1.1  YES CONFIG up  up
+srx:    ge-0/0/0.0  up  up  inet  10.0.0.1/24
+h3c:    GE1/0/1  UP  UP  10.0.0.1  description
+huawei: GigabitEthernet0/0/0  10.0.0.1/24  up  up(s)
+*/
+func parseFactsInterfaces(text string) []*model.FactsInterface {
+	results := make([]*model.FactsInterface, 0)
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(strings.ToLower(fields[0]), "interface") {
+			continue
+		}
+		item := &model.FactsInterface{Name: fields[0]}
+		for _, v := range fields[1:] {
+			if item.Address == "" && isFactsAddress(v) {
+				item.Address = v
+			}
+			// 取最后一个状态，管理状态和链路状态都存在时以链路状态为准
+			switch status := strings.ToLower(strings.TrimPrefix(v, "*")); {
+			case status == "up", status == "down", strings.HasPrefix(status, "up("), strings.HasPrefix(status, "adm"):
+				item.Status = status
+			}
+		}
+		if item.Status == "" {
+			continue
+		}
+		results = append(results, item)
+	}
+	return results
+}
+
+func isFactsAddress(text string) bool {
+	if _, _, e := net.ParseCIDR(text); e == nil {
+		return true
+	}
+	return net.ParseIP(text) != nil
+}
+
+// FactsQuery 资产信息查询条件，为空的条件不限制
+type FactsQuery struct {
+	Vendor     string `form:"vendor"`
+	Model      string `form:"model"`
+	HaRole     string `form:"ha_role"`
+	Keyword    string `form:"keyword"`     // 匹配设备名、序列号、版本
+	VersionLt  string `form:"version_lt"`  // 版本低于
+	VersionGte string `form:"version_gte"` // 版本不低于
+}
+
+// FindFacts 查询资产信息，版本按数字和字母分段比较，如 18.4R3-S4.2 < 19.1R1
+func FindFacts(q *FactsQuery) ([]*model.TDeviceFacts, error) {
+	db := database.DB.Model(&model.TDeviceFacts{}).Select("t_device_facts.*")
+	if q.Vendor != "" {
+		db = db.Where("t_device_facts.vendor = ?", strings.ToLower(q.Vendor))
+	}
+	if q.Model != "" {
+		db = db.Where("t_device_facts.model like ?", "%"+q.Model+"%")
+	}
+	if q.HaRole != "" {
+		db = db.Where("t_device_facts.ha_role = ?", q.HaRole)
+	}
+	// 设备名在设备表中
+	if q.Keyword != "" {
+		keyword := "%" + q.Keyword + "%"
+		db = db.Joins("left join t_firewall_device on t_firewall_device.id = t_device_facts.device_id").
+			Where("t_firewall_device.name like ? or t_device_facts.serial like ? or t_device_facts.version like ?", keyword, keyword, keyword)
+	}
+	facts := make([]*model.TDeviceFacts, 0)
+	if e := db.Order("t_device_facts.device_id").Find(&facts).Error; e != nil {
+		return nil, fmt.Errorf("获取设备资产信息失败, err: %w", e)
+	}
+	results := make([]*model.TDeviceFacts, 0, len(facts))
+	for _, v := range facts {
+		if q.VersionLt != "" && (v.Version == "" || CompareVersion(v.Version, q.VersionLt) >= 0) {
+			continue
+		}
+		if q.VersionGte != "" && (v.Version == "" || CompareVersion(v.Version, q.VersionGte) < 0) {
+			continue
+		}
+		results = append(results, v)
+	}
+	return results, nil
+}
+
+// CompareVersion 按数字和字母分段比较版本，数字按大小比较，字母按字典序比较
+func CompareVersion(a, b string) int {
+	x, y := versionTokens(a), versionTokens(b)
+	for i := 0; i < len(x) && i < len(y); i++ {
+		m, e1 := strconv.Atoi(x[i])
+		n, e2 := strconv.Atoi(y[i])
+		switch {
+		case e1 == nil && e2 == nil:
+			if c := compareInt(m, n); c != 0 {
+				return c
+			}
+		default:
+			if c := strings.Compare(strings.ToLower(x[i]), strings.ToLower(y[i])); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(x), len(y))
+}
+
+func versionTokens(version string) []string {
+	results := make([]string, 0)
+	current := make([]rune, 0)
+	for _, c := range version {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			if len(current) > 0 {
+				results = append(results, string(current))
+				current = current[:0]
+			}
+			continue
+		}
+		if len(current) > 0 && unicode.IsDigit(c) != unicode.IsDigit(current[len(current)-1]) {
+			results = append(results, string(current))
+			current = current[:0]
+		}
+		current = append(current, c)
+	}
+	if len(current) > 0 {
+		results = append(results, string(current))
+	}
+	return results
+}
@@ -3,13 +3,11 @@ package device
 import (
 	"fmt"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 	"netops/conf"
 	"netops/database"
 	netApi2 "netops/grpc_client/protobuf/net_api"
 	"netops/model"
 	"netops/utils"
-	"os"
 	"strings"
 )
 
@@ -33,14 +31,22 @@ var actions = map[string]string{"pass": "permit", "drop": "deny"}
 // ParseConfig 获取并解析配置
 func (h *H3cHandler) ParseConfig() {
 	h.addLog("<-------开始解析设备策略------->")
+	if e := h.selectActive(); e != nil {
+		h.operateLog.Status = "failed"
+		h.addLog(e.Error())
+		_ = h.device.UpdateParseStatus(ParseStatusFailed)
+		return
+	}
+	if h.host != "" {
+		h.addLog("HA主设备: %s", h.host)
+	}
 	if e := h.parse(); e != nil {
 		h.operateLog.Status = "failed"
 		h.addLog(e.Error())
 		_ = h.device.UpdateParseStatus(ParseStatusFailed)
 		return
 	}
-	_ = h.device.UpdateParseStatus(ParseStatusSuccess)
-	h.addLog("<-------解析策略完成------->")
+	h.parseSuccess()
 }
 func (h *H3cHandler) Search(info *model.TTaskInfo) (*model.TDevicePolicy, error) {
 	if h.error != nil {
@@ -48,92 +54,16 @@ func (h *H3cHandler) Search(info *model.TTaskInfo) (*model.TDevicePolicy, error)
 	}
 	l := zap.L().With(zap.Int("infoId", info.Id), zap.String("func", "Search"))
 	l.Info("策略查询", zap.Any("info", info))
-	l.Debug("1. 根据源目地址模糊匹配符合条件的策略---------->")
-	var (
-		result    *model.TDevicePolicy
-		db        *gorm.DB
-		portNames = []string{"any"}
-		err       error
-	)
-	db = database.DB.Where("device_id = ? and dst like ? and direction = ? and action = ?",
-		h.DeviceId, "%"+info.Dst+"%", info.Direction, "permit")
-	if info.Direction == "inside" && (info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6) {
-		db = db.Where("src_group = ?", info.Src)
-	} else {
-		db = db.Where("src like ?", "%"+info.Src+"%")
-	}
-
-	if info.Protocol != "ip" {
-		l.Info("根据端口和协议获取端口所在的组--------->")
-		if portNames, err = h.getPortNames(info.DPort, info.Protocol); err != nil {
-			return nil, err
+	if info.StaticIp != "" {
+		l.Debug("若需要做nat，先校验nat是否存在--->")
+		if nat := h.SearchNat(info); nat == nil {
+			l.Debug("未匹配到nat策略", zap.Any("nat", nat))
+			return nil, h.error
 		}
-		l.Info(fmt.Sprintf("port:<%s> -> portNames:<%+v>", info.DPort, portNames))
-		db = db.Where("port = ? or port = ? or port_group in ?", "any", info.DPort, portNames)
-	}
-	policies := make([]*model.TDevicePolicy, 0)
-	db = db.Find(&policies)
-	if db.Error != nil {
-		h.error = fmt.Errorf("查询策略失败, err: %w", db.Error)
 	}
-	if len(policies) > 0 {
-		l.Info("匹配到策略信息------------------>")
-		result = policies[0]
-		l.Debug("匹配到策略", zap.Any("policy", result))
-		return result, nil
-	} else {
-		l.Info("2. 根据基本信息未匹配到相应的策略，开始进行网段的匹配------->")
-		// 如果没有匹配的策略，则获取所有地址组，根据地址组来查询
-		// 先获取源地址为网段的策略信息
-		l.Info("先根据基本条件进行过滤------------>")
-		subnetPolicies := make([]*model.TDevicePolicy, 0)
-		db = database.DB.Where("action = ? and device_id = ? and direction = ?",
-			"permit", h.DeviceId, info.Direction)
-		if info.Protocol != "ip" {
-			db = db.Where("port = ? or port = ? or port in ?", "any", info.DPort, portNames)
-		}
-		if e1 := db.Find(&subnetPolicies).Error; e1 != nil {
-			return nil, fmt.Errorf("查询策略失败, err: %w", e1)
-		}
-		// 根据源目地址找到符合条件的策略
-		l.Info("3. 根据源目地址从策略表中匹配策略--------->")
-		policies = h.getSubnetPolicy(subnetPolicies, info.Src, info.Dst)
-		if len(policies) > 0 {
-			if info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6 {
-				result = policies[0]
-			} else {
-				// 匹配出最小的策略
-				l.Info("根据匹配到的网段策略, 获取范围最小的策略信息-------->")
-				result = h.getPolicy(policies, info.Src, info.Dst)
-				l.Info(fmt.Sprintf("匹配到的策略: <%+v>", result))
-			}
-			return result, nil
-		}
-		l.Info("查询结果", zap.Any("policies", policies))
-	}
-	l.Info("<-------策略查询结束------->")
-	return nil, nil
+	return h.searchPolicy(info)
 }
 
-// 获取组名
-func (h *H3cHandler) getPortNames(port, protocol string) (results []string, err error) {
-	p, err := utils.ParseRangePort(port)
-	if err != nil {
-		return
-	}
-	ports := make([]model.TDevicePort, 0)
-	db := database.DB.Where("device_id = ? and protocol like ? and start <= ? and end >= ?", h.DeviceId, "%"+protocol+"%",
-		p.Start, p.End).Find(&ports)
-	if db.Error != nil {
-		return nil, fmt.Errorf("根据port<%s>获取端口组异常: <%s>", port, db.Error.Error())
-	}
-	results = make([]string, 0)
-	for _, p := range ports {
-		results = append(results, p.Name)
-	}
-	results = append(results, "any")
-	return results, nil
-}
 func (h *H3cHandler) GetCommand(dp *model.TDevicePolicy) string {
 	return dp.Command
 }
@@ -194,16 +124,8 @@ func (h *H3cHandler) genePortCmd(info *model.TTaskInfo) (portNames []string, por
 }
 
 // 生成策略命令
-func (h *H3cHandler) genePolicyCmd(direction, name, srcGroup, dstGroup string, portNames []string, ipType string) (string, error) {
-	var sourceZone, destinationZone string
-	switch direction {
-	case "inside":
-		sourceZone = h.device.OutPolicy
-		destinationZone = h.device.InPolicy
-	case "outside":
-		sourceZone = h.device.InPolicy
-		destinationZone = h.device.OutPolicy
-	default:
+func (h *H3cHandler) genePolicyCmd(sourceZone, destinationZone, name, srcGroup, dstGroup string, portNames []string, ipType string) (string, error) {
+	if sourceZone == "" || destinationZone == "" {
 		return "", fmt.Errorf("未知的策略方向")
 	}
 	policyCmd := fmt.Sprintf("security-policy %s\n", ipType)
@@ -281,6 +203,7 @@ func (h *H3cHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 		groupName    = h.groupName(jiraKey, info)
 		ipType       = h.getIpType(info.Src)
 	)
+	sourceZone, destinationZone := h.zonePair(info)
 	l.Info("1. 生成源地址组策略命令--->")
 	// 如果办公网，地址组直接设置为办公网
 	if info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6 {
@@ -291,12 +214,7 @@ func (h *H3cHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 
 	} else {
 		srcGroupName = h.geneSrcGroupName(groupName)
-		if info.Direction == "inside" {
-			commands = append(commands, h.geneAddressCmd(h.device.OutPolicy, srcGroupName, info.Src, ipType))
-		} else {
-			commands = append(commands, h.geneAddressCmd(h.device.InPolicy, srcGroupName, info.Src, ipType))
-		}
-
+		commands = append(commands, h.geneAddressCmd(sourceZone, srcGroupName, info.Src, ipType))
 	}
 	l.Info("2. 生成目标地址组策略命令--->")
 	dstAddressGroup := h.getAddressGroup(info.Dst)
@@ -306,11 +224,7 @@ func (h *H3cHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 
 	} else {
 		dstGroupName = h.geneDstGroupName(groupName)
-		if info.Direction == "inside" {
-			commands = append(commands, h.geneAddressCmd(h.device.InPolicy, dstGroupName, info.Dst, ipType))
-		} else {
-			commands = append(commands, h.geneAddressCmd(h.device.OutPolicy, dstGroupName, info.Dst, ipType))
-		}
+		commands = append(commands, h.geneAddressCmd(destinationZone, dstGroupName, info.Dst, ipType))
 	}
 
 	l.Info("3. 生成端口策略命令--->")
@@ -319,22 +233,28 @@ func (h *H3cHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 	}
 
 	l.Info("4. 生成策略--->")
-	policyCmd, e := h.genePolicyCmd(info.Direction, groupName, srcGroupName, dstGroupName, portNames, ipType)
+	policyCmd, e := h.genePolicyCmd(sourceZone, destinationZone, groupName, srcGroupName, dstGroupName, portNames, ipType)
 	if e != nil {
 		return "", e
 	}
 	commands = append(commands, policyCmd)
-	return strings.Join(commands, "\n"), nil
-}
 
-func (h *H3cHandler) CheckNat(info *model.TTaskInfo) (err error) {
-	return
+	l.Info("5. 生成nat--->")
+	natCmd, e := h.geneNatCmd(groupName, info, srcGroupName, dstGroupName)
+	if e != nil {
+		return "", e
+	}
+	if natCmd != "" {
+		commands = append(commands, natCmd)
+	}
+	return strings.Join(commands, "\n"), nil
 }
 
 type h3cParse struct {
 	base
 	policyText string
 	groupText  string
+	natText    string
 }
 
 func (h *h3cParse) parse() error {
@@ -364,37 +284,21 @@ func (h *h3cParse) parse() error {
 		return e
 	}
 
-	//h.addLog("5. 解析黑名单地址组信息--->")
+	h.addLog("5. 解析nat信息--->")
+	if e := h.parseNat(addresses); e != nil {
+		return e
+	}
+
+	//h.addLog("6. 解析黑名单地址组信息--->")
 	//h.parseBlacklistGroupAddress(addresses)
-	//h.saveNatPool(h.parseNatPool())
 	return nil
 }
-func (h *h3cParse) getConfig1() {
-	fb, err := os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\wh-h3c-ip.log")
-	if err != nil {
-		h.error = err
-		return
-	}
-	h.policyText += string(fb)
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\wh-h3c-ipv6.log")
-	if err != nil {
-		h.error = err
-		return
-	}
-	h.policyText += string(fb)
-	h.policyText += string(fb)
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\wh-h3c-group.log")
-	if err != nil {
-		h.error = err
-		return
-	}
-	h.groupText = string(fb)
-}
 func (h *h3cParse) getConfig() error {
 	commands := []*netApi2.Command{
 		{Id: 1, Cmd: "dis security-policy ip"},
 		{Id: 2, Cmd: "dis object-group"},
 		{Id: 3, Cmd: "dis security-policy ipv6"},
+		{Id: 4, Cmd: "dis current-configuration"},
 	}
 	result, e := h.send(commands)
 	if e != nil {
@@ -408,6 +312,8 @@ func (h *h3cParse) getConfig() error {
 			h.groupText = strings.ReplaceAll(item.Result, "---- More ----", "")
 		case 3:
 			h.policyText += strings.ReplaceAll(item.Result, "---- More ----", "")
+		case 4:
+			h.natText = strings.ReplaceAll(item.Result, "---- More ----", "")
 		}
 	}
 	return nil
@@ -802,6 +708,8 @@ func (h *h3cParse) saveRules(rules []*h3cRule, services []*h3cService, groups []
 				Name:      v.name,
 				Action:    actions[v.action],
 				Direction: direction,
+				SrcZone:   v.sourceZone,
+				DstZone:   v.destinationZone,
 				SrcGroup:  v.sourceIp,
 				Src:       h.findAddress(v.sourceIp, groupM),
 				DstGroup:  v.destinationIp,
@@ -821,18 +729,6 @@ func (h *h3cParse) saveRules(rules []*h3cRule, services []*h3cService, groups []
 	return h.savePolicy(bulks)
 }
 
-// 根据from-zone和to-zone区分出方向
-func (h *h3cParse) parseDirection(sourceZone, destinationZone string) string {
-	// 解析方向 如果 source-zone in destination-zone out则是出向， source-zone out destination-zone in 则是入向
-	switch {
-	case sourceZone == h.device.InPolicy && destinationZone == h.device.OutPolicy:
-		return "outside"
-	case sourceZone == h.device.OutPolicy && destinationZone == h.device.InPolicy:
-		return "inside"
-	}
-	return fmt.Sprintf("%s-%s", sourceZone, destinationZone)
-}
-
 // 根据端口组从所有端口组map中找到对应的端口信息
 func (h *h3cParse) findPort(portName string, groupPorts map[string]*h3cService) (port, protocol string) {
 	if portName == "" || portName == "any" {
@@ -0,0 +1,124 @@
+package device
+
+import (
+	"fmt"
+	net_api2 "netops/grpc_client/protobuf/net_api"
+	"netops/utils"
+	"strings"
+)
+
+// 是否配置了HA，配置对端或VIP后解析、备份和下发前都需要先确认主设备
+func (b *base) isHa() bool {
+	return b.device.HaVip != "" || b.device.HaPeerHost != ""
+}
+
+// 查询指定地址的HA角色，返回active、standby，未识别到HA信息时返回standalone
+func (b *base) queryHaRole(host string) (string, error) {
+	vendor := strings.ToLower(b.deviceType.Name)
+	commands := make([]*net_api2.Command, 0, 1)
+	for _, v := range factsCommands[vendor] {
+		if v.Id == factsHa || v.Id == factsHaNode {
+			commands = append(commands, &net_api2.Command{Id: v.Id, Cmd: v.Cmd})
+		}
+	}
+	if len(commands) == 0 {
+		return "", fmt.Errorf("暂不支持查询当前类型设备的HA状态, 设备类型: %s", b.deviceType.Name)
+	}
+	result, e := b.sendTo(host, commands)
+	if e != nil {
+		return "", fmt.Errorf("查询设备<%s>HA状态失败, err: %w", host, e)
+	}
+	texts := make(map[int32]string)
+	for _, v := range result {
+		texts[v.Id] = v.Result
+	}
+	return parseHaRole(vendor, texts), nil
+}
+
+/*
+获取HA主设备的地址:
+ 1. 配置了VIP时通过VIP登录，VIP所在设备不能是备机
+ 2. 配置了对端时依次查询本端和对端，返回角色为active的设备
+*/
+func (b *base) activeHost() (string, error) {
+	if b.device.HaVip != "" {
+		role, e := b.queryHaRole(b.device.HaVip)
+		if e != nil {
+			return "", e
+		}
+		if role == "standby" {
+			return "", fmt.Errorf("设备<%s>VIP<%s>当前登录的是备机, 请检查HA状态", b.device.Name, b.device.HaVip)
+		}
+		return b.device.HaVip, nil
+	}
+	messages := make([]string, 0, 2)
+	for _, host := range []string{b.device.Host, b.device.HaPeerHost} {
+		role, e := b.queryHaRole(host)
+		if e != nil {
+			messages = append(messages, e.Error())
+			continue
+		}
+		if role == "active" {
+			return host, nil
+		}
+		messages = append(messages, fmt.Sprintf("%s: %s", host, role))
+	}
+	return "", fmt.Errorf("未获取到设备<%s>的HA主设备, %s", b.device.Name, strings.Join(messages, "; "))
+}
+
+// 选择HA主设备，之后的命令都发送到主设备，离线解析时不处理
+func (b *base) selectActive() error {
+	if b.offline != nil || !b.isHa() {
+		return nil
+	}
+	host, e := b.activeHost()
+	if e != nil {
+		return e
+	}
+	b.host = host
+	return nil
+}
+
+// ActiveHost 获取设备当前可以下发配置的地址，未配置HA时返回设备地址
+func ActiveHost(deviceId int) (string, error) {
+	b := &base{DeviceId: deviceId}
+	b.init()
+	if b.error != nil {
+		return "", b.error
+	}
+	if !b.isHa() {
+		return b.device.Host, nil
+	}
+	return b.activeHost()
+}
+
+// CheckHaSync 对比HA两台设备的配置，配置不一致时返回差异，未配置对端时不检查
+func (b *base) CheckHaSync() (string, error) {
+	if b.error != nil {
+		return "", b.error
+	}
+	if b.offline != nil || b.device.HaPeerHost == "" {
+		return "", nil
+	}
+	commands := []*net_api2.Command{{Id: 1, Cmd: b.backupCommand}}
+	texts := make([]string, 0, 2)
+	for _, host := range []string{b.device.Host, b.device.HaPeerHost} {
+		result, e := b.sendTo(host, commands)
+		if e != nil {
+			return "", fmt.Errorf("获取设备<%s>配置失败, err: %w", host, e)
+		}
+		texts = append(texts, result[0].Result)
+	}
+	ignore, e := diffIgnore(strings.ToLower(b.deviceType.Name))
+	if e != nil {
+		return "", e
+	}
+	d := utils.NewTextDiff(ignore)
+	d.Diff(texts[0], texts[1])
+	hunks := d.Hunks(backupDiffContext)
+	if len(hunks) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("HA设备配置不一致, 共%d处差异:\n%s", len(hunks),
+		d.Unified(b.device.Host, b.device.HaPeerHost, backupDiffContext)), nil
+}
@@ -0,0 +1,127 @@
+package device
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/database"
+	"netops/grpc_client/net_api"
+	net_api2 "netops/grpc_client/protobuf/net_api"
+	"netops/model"
+	"netops/pkg/credential"
+	"strings"
+	"time"
+)
+
+// 健康检查使用的轻量命令，只验证能登录设备并执行命令
+var healthCommands = map[string]string{
+	"asa":    "show clock",
+	"srx":    "show system uptime",
+	"h3c":    "display clock",
+	"huawei": "display clock",
+}
+
+// 登录失败的关键字，其他失败视为网络不可达
+var loginFailedKeywords = []string{"auth", "password", "permission denied", "login", "认证", "密码"}
+
+// F5健康检查使用的轻量接口
+const f5HealthUri = "/mgmt/tm/sys/clock"
+
+// CheckHealth 通过设备所在区域的net_api执行轻量命令，记录延迟和登录结果，并更新设备的当前健康状态
+func CheckHealth(deviceId int, timeout time.Duration) (*model.TDeviceHealth, error) {
+	b := &base{DeviceId: deviceId}
+	b.init()
+	if b.error != nil {
+		return nil, b.error
+	}
+	cmd, ok := healthCommands[strings.ToLower(b.deviceType.Name)]
+	if !ok {
+		return nil, fmt.Errorf("暂不支持当前类型的设备, 设备类型: %s", b.deviceType.Name)
+	}
+	result := &model.TDeviceHealth{DeviceId: deviceId, DeviceType: conf.DeviceTypeFirewall, CheckedAt: time.Now()}
+	setHealthResult(result, b.ping(cmd, timeout), b.device.HealthFailures)
+	return result, saveHealth(result, model.TFirewallDevice{}.TableName())
+}
+
+// CheckNlbHealth 通过net_api调用F5的iControl REST接口，记录延迟和登录结果，并更新设备的当前健康状态
+func CheckNlbHealth(deviceId int, timeout time.Duration) (*model.TDeviceHealth, error) {
+	f := &F5Parse{DeviceId: deviceId}
+	f.init()
+	if f.error != nil {
+		return nil, f.error
+	}
+	defer f.CloseGrpc()
+	f.client.SetTimeout(timeout)
+	result := &model.TDeviceHealth{DeviceId: deviceId, DeviceType: conf.DeviceTypeNlb, CheckedAt: time.Now()}
+	setHealthResult(result, f.send(f5HealthUri, "GET", "", nil), f.device.HealthFailures)
+	return result, saveHealth(result, model.TNLBDevice{}.TableName())
+}
+
+// 根据检查结果设置状态、延迟和连续失败次数
+func setHealthResult(result *model.TDeviceHealth, e error, failures int) {
+	if e != nil {
+		result.Status = healthFailedStatus(e)
+		result.Message = e.Error()
+	} else {
+		result.Status = model.HealthStatusUp
+		result.LoginSuccess = true
+	}
+	result.Latency = int(time.Since(result.CheckedAt).Milliseconds())
+	if !result.LoginSuccess {
+		result.Failures = failures + 1
+	}
+}
+
+// 保存检查记录并更新设备表的当前健康状态
+func saveHealth(result *model.TDeviceHealth, table string) error {
+	if e := database.DB.Create(result).Error; e != nil {
+		return fmt.Errorf("保存设备健康检查记录失败, err: %w", e)
+	}
+	if e := database.DB.Table(table).Where("id = ?", result.DeviceId).UpdateColumns(map[string]any{
+		"health_status":     result.Status,
+		"health_failures":   result.Failures,
+		"health_latency":    result.Latency,
+		"health_message":    result.Message,
+		"health_checked_at": result.CheckedAt,
+	}).Error; e != nil {
+		return fmt.Errorf("更新设备健康状态失败, err: %w", e)
+	}
+	return nil
+}
+
+func (b *base) ping(cmd string, timeout time.Duration) error {
+	account, e := credential.Resolve(b.device, credential.PurposeRead)
+	if e != nil {
+		return e
+	}
+	client := net_api.NewClient(b.region.ApiServer).SetTimeout(timeout)
+	defer client.Close()
+	_, e = client.Show(&net_api2.ConfigRequest{
+		DeviceType:     b.deviceType.Name,
+		Host:           b.device.Host,
+		Username:       account.Username,
+		Password:       account.Password,
+		EnablePassword: account.EnablePassword,
+		Port:           int32(b.device.Port),
+		Commands:       []*net_api2.Command{{Id: 1, Cmd: cmd}},
+	})
+	return e
+}
+
+func healthFailedStatus(e error) string {
+	message := strings.ToLower(e.Error())
+	for _, v := range loginFailedKeywords {
+		if strings.Contains(message, v) {
+			return model.HealthStatusLoginFailed
+		}
+	}
+	return model.HealthStatusUnreachable
+}
+
+// PruneHealth 清理保留天数之前的健康检查记录
+func PruneHealth(keepDays int) (int64, error) {
+	r := database.DB.Where("checked_at < ?", time.Now().AddDate(0, 0, -keepDays)).Delete(&model.TDeviceHealth{})
+	if r.Error != nil {
+		return 0, fmt.Errorf("清理设备健康检查记录失败, err: %w", r.Error)
+	}
+	return r.RowsAffected, nil
+}
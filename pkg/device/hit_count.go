@@ -0,0 +1,380 @@
+package device
+
+import (
+	"fmt"
+	"netops/database"
+	net_api2 "netops/grpc_client/protobuf/net_api"
+	"netops/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 设备命中数输出中解析出的策略命中信息
+type policyHit struct {
+	direction string // srx根据from-zone和to-zone解析出的方向，h3c和华为策略名唯一，为空
+	name      string
+	hitCount  int
+	command   string
+}
+
+// 获取并解析无效策略，getHits获取设备上各策略的命中数
+func (b *base) parseInvalidPolicy(getHits func() ([]*policyHit, error)) {
+	if b.error != nil {
+		return
+	}
+	b.addLog("<-------开始解析设备无效策略------->")
+	b.addLog("1. 获取策略命中数--------------->")
+	hits, e := getHits()
+	if e != nil {
+		b.error = e
+		b.addLog(e.Error())
+		return
+	}
+	b.addLog("2. 匹配策略信息----------------->")
+	policies, e := b.makePolicyHitCounts(hits)
+	if e != nil {
+		b.error = e
+		b.addLog(e.Error())
+		return
+	}
+	if e := b.parsePolicyHitCount(policies); e != nil {
+		b.error = e
+		b.addLog(e.Error())
+		return
+	}
+	b.addLog("3. 保存策略命中数--------------->")
+	if e := b.savePolicyHitCount(policies); e != nil {
+		b.error = e
+		b.addLog(e.Error())
+		return
+	}
+	b.addLog("<-------解析无效策略完成------->")
+}
+
+// 根据已解析的策略补全命中数的源、目的、协议和端口，只保留permit策略
+func (b *base) makePolicyHitCounts(hits []*policyHit) ([]*model.TDevicePolicyHitCount, error) {
+	policies := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", b.DeviceId).Order("line, id").Find(&policies).Error; e != nil {
+		return nil, fmt.Errorf("获取设备策略失败, device_id: %d, err: %w", b.DeviceId, e)
+	}
+	policyM := make(map[string][]*model.TDevicePolicy)
+	for _, v := range policies {
+		policyM[v.Direction+"|"+v.Name] = append(policyM[v.Direction+"|"+v.Name], v)
+		policyM["|"+v.Name] = append(policyM["|"+v.Name], v)
+	}
+	results := make([]*model.TDevicePolicyHitCount, 0)
+	exists := make(map[string]bool)
+	for _, v := range hits {
+		items, ok := policyM[v.direction+"|"+v.name]
+		if !ok {
+			b.addLog("策略<%s>未解析到配置, 请先解析设备策略", v.name)
+			continue
+		}
+		if items[0].Action != "permit" {
+			continue
+		}
+		name := fmt.Sprintf("%d-%s-%s", b.DeviceId, items[0].Direction, v.name)
+		if exists[name] {
+			continue
+		}
+		exists[name] = true
+		sources, destinations, protocols, ports := newUniqueList(), newUniqueList(), newUniqueList(), newUniqueList()
+		for _, p := range items {
+			sources.add(p.SrcGroup, p.Src)
+			destinations.add(p.DstGroup, p.Dst)
+			protocols.add(p.Protocol, "")
+			ports.add(p.PortGroup, p.Port)
+		}
+		results = append(results, &model.TDevicePolicyHitCount{
+			DeviceId:    b.DeviceId,
+			Name:        name,
+			Source:      sources.String(),
+			Destination: destinations.String(),
+			Protocol:    protocols.String(),
+			Port:        ports.String(),
+			HitCount:    v.hitCount,
+			Command:     v.command,
+		})
+	}
+	b.addLog("解析到<%d>条permit策略命中数", len(results))
+	return results, nil
+}
+
+// 处理当前存在的策略与新的策略，是否有新的命中次数（新的访问次数）
+func (b *base) parsePolicyHitCount(policies []*model.TDevicePolicyHitCount) error {
+	// 1. 取出旧的策略信息
+	oldPolices := make([]*model.TDevicePolicyHitCount, 0)
+	if e := database.DB.Model(&model.TDevicePolicyHitCount{}).Select("name", "hit_count", "id").Where("device_id = ?", b.DeviceId).Find(&oldPolices).Error; e != nil {
+		return fmt.Errorf("根据设备ID<%d>获取策略命中次数异常: <%s>", b.DeviceId, e.Error())
+	}
+	// 取出旧的策略和命中数
+	oldNameHits := make(map[string]int, 0)
+	for _, v := range oldPolices {
+		oldNameHits[v.Name] = v.HitCount
+	}
+	// 2. 对比旧策略，设置state和before hit count
+	for _, v := range policies {
+		beforeHit, ok := oldNameHits[v.Name]
+		if ok {
+			// 命中次数为0设置为无效策略
+			v.BeforeHitCount = beforeHit
+		}
+		// 存在则更新
+		switch {
+		case v.HitCount < v.BeforeHitCount:
+			// 计数器被重置（设备重启或clear），重置后有命中则有效
+			v.State = 0
+			if v.HitCount > 0 {
+				v.State = 1
+			}
+		case v.HitCount == v.BeforeHitCount:
+			v.State = 0
+		default:
+			v.State = 1
+		}
+	}
+	return nil
+}
+
+// 策略命中数历史保留天数
+const hitCountHistoryDays = 400
+
+// 根据上次采集的命中数生成本次采集的历史记录，命中数变小说明计数器被重置
+func (b *base) makePolicyHitCountHistories(data []*model.TDevicePolicyHitCount) ([]*model.TDevicePolicyHitCountHistory, error) {
+	names := make([]string, 0)
+	if e := database.DB.Model(&model.TDevicePolicyHitCount{}).Where("device_id = ?", b.DeviceId).Pluck("name", &names).Error; e != nil {
+		return nil, fmt.Errorf("获取策略命中数失败, device_id: %d, err: %w", b.DeviceId, e)
+	}
+	olds := make(map[string]bool)
+	for _, v := range names {
+		olds[v] = true
+	}
+	now := time.Now()
+	results := make([]*model.TDevicePolicyHitCountHistory, 0, len(data))
+	for _, v := range data {
+		item := &model.TDevicePolicyHitCountHistory{DeviceId: v.DeviceId, Name: v.Name, HitCount: v.HitCount, CollectedAt: now}
+		switch {
+		case !olds[v.Name]:
+			// 首次采集，无法知道之前的命中数
+		case v.HitCount < v.BeforeHitCount:
+			item.Reset = true
+			item.Delta = v.HitCount
+		default:
+			item.Delta = v.HitCount - v.BeforeHitCount
+		}
+		results = append(results, item)
+	}
+	return results, nil
+}
+
+// FindZeroHitPolicies 获取最近days天内没有命中的策略，只返回采集历史覆盖了整个时间段的策略
+func FindZeroHitPolicies(deviceId, days int) ([]*model.TDevicePolicyHitCount, error) {
+	start := time.Now().AddDate(0, 0, -days)
+	stats := make([]*struct {
+		Name    string
+		FirstAt time.Time
+		Hits    int
+	}, 0)
+	if e := database.DB.Model(&model.TDevicePolicyHitCountHistory{}).
+		Select("name, min(collected_at) as first_at, sum(case when collected_at > ? then delta else 0 end) as hits", start).
+		Where("device_id = ?", deviceId).Group("name").Scan(&stats).Error; e != nil {
+		return nil, fmt.Errorf("统计策略命中数失败, device_id: %d, err: %w", deviceId, e)
+	}
+	names := make([]string, 0)
+	for _, v := range stats {
+		if !v.FirstAt.After(start) && v.Hits == 0 {
+			names = append(names, v.Name)
+		}
+	}
+	results := make([]*model.TDevicePolicyHitCount, 0)
+	if len(names) == 0 {
+		return results, nil
+	}
+	if e := database.DB.Where("device_id = ? and name in ?", deviceId, names).Order("id").Find(&results).Error; e != nil {
+		return nil, fmt.Errorf("获取策略命中数失败, device_id: %d, err: %w", deviceId, e)
+	}
+	return results, nil
+}
+
+// 去重并保持顺序的字符串列表，优先使用组名，组名为空时使用解析后的值
+type uniqueList struct {
+	items  []string
+	exists map[string]bool
+}
+
+func newUniqueList() *uniqueList {
+	return &uniqueList{items: make([]string, 0), exists: make(map[string]bool)}
+}
+
+func (u *uniqueList) add(value, fallback string) {
+	if value == "" {
+		value = fallback
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" && !u.exists[v] {
+			u.exists[v] = true
+			u.items = append(u.items, v)
+		}
+	}
+}
+
+func (u *uniqueList) String() string {
+	return strings.Join(u.items, ",")
+}
+
+// ParseInvalidPolicy 解析无效策略
+func (s *SrxHandler) ParseInvalidPolicy() {
+	s.parseInvalidPolicy(s.getPolicyHits)
+}
+
+func (s *srxParse) getPolicyHits() ([]*policyHit, error) {
+	result, e := s.send([]*net_api2.Command{{Id: 1, Cmd: "show security policies hit-count"}})
+	if e != nil {
+		return nil, fmt.Errorf("获取策略命中数失败, err: %w", e)
+	}
+	hits := s.parsePolicyHits(result[0].Result)
+	s.addLog("解析到<%d>条策略命中数", len(hits))
+	return hits, nil
+}
+
+func (s *srxParse) parsePolicyHits(text string) []*policyHit {
+	/*
+		Logical system: root-logical-system
+		 Index   From zone        To zone           Name           Policy count  Action
+		 1       trust            untrust           YWJS-93513     1024          Permit
+		 2       untrust          trust             deny-all       0             Deny
+	*/
+	results := make([]*policyHit, 0)
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		lines := splitLineBySpace(line)
+		if len(lines) < 5 {
+			continue
+		}
+		if _, e := strconv.Atoi(lines[0]); e != nil {
+			continue
+		}
+		count, e := strconv.Atoi(lines[4])
+		if e != nil {
+			continue
+		}
+		results = append(results, &policyHit{
+			direction: s.parseDirection(lines[1], lines[2]),
+			name:      lines[3],
+			hitCount:  count,
+			command:   line,
+		})
+	}
+	return results
+}
+
+// ParseInvalidPolicy 解析无效策略
+func (h *H3cHandler) ParseInvalidPolicy() {
+	h.parseInvalidPolicy(h.getPolicyHits)
+}
+
+func (h *h3cParse) getPolicyHits() ([]*policyHit, error) {
+	result, e := h.send([]*net_api2.Command{
+		{Id: 1, Cmd: "dis security-policy statistics ip"},
+		{Id: 2, Cmd: "dis security-policy statistics ipv6"},
+	})
+	if e != nil {
+		return nil, fmt.Errorf("获取策略命中数失败, err: %w", e)
+	}
+	text := ""
+	for _, v := range result {
+		text += strings.ReplaceAll(v.Result, "---- More ----", "") + "\n"
+	}
+	hits := h.parsePolicyHits(text)
+	h.addLog("解析到<%d>条策略命中数", len(hits))
+	return hits, nil
+}
+
+var (
+	h3cRuleRegexp     = regexp.MustCompile(`^rule\s+\d+\s+name\s+(\S+)`)
+	h3cHitCountRegexp = regexp.MustCompile(`(?i)(?:hit count|matched|packets)\D*(\d+)|(\d+)\s+times matched`)
+)
+
+func (h *h3cParse) parsePolicyHits(text string) []*policyHit {
+	/*
+	 rule 21 name YWJS-93513-28431 (Hit count 1024)
+	 rule 22 name YWJS-93513-28432 (0 times matched)
+	 rule 23 name YWJS-93513-28433
+	  Packets: 1024, Bytes: 65536
+	*/
+	results := make([]*policyHit, 0)
+	var p *policyHit
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if r := h3cRuleRegexp.FindStringSubmatch(line); r != nil {
+			p = &policyHit{name: r[1], command: line}
+			results = append(results, p)
+		} else if p == nil {
+			continue
+		}
+		r := h3cHitCountRegexp.FindStringSubmatch(line)
+		if r == nil {
+			continue
+		}
+		count := r[1]
+		if count == "" {
+			count = r[2]
+		}
+		p.hitCount, _ = strconv.Atoi(count)
+		if line != p.command {
+			p.command += "\n" + line
+		}
+	}
+	return results
+}
+
+// ParseInvalidPolicy 解析无效策略
+func (h *HuaWeiHandler) ParseInvalidPolicy() {
+	h.parseInvalidPolicy(h.getPolicyHits)
+}
+
+func (h *huaWeiParse) getPolicyHits() ([]*policyHit, error) {
+	result, e := h.send([]*net_api2.Command{{Id: 1, Cmd: "dis security-policy rule all"}})
+	if e != nil {
+		return nil, fmt.Errorf("获取策略命中数失败, err: %w", e)
+	}
+	text := strings.ReplaceAll(result[0].Result, "---- More ----", "")
+	text = strings.ReplaceAll(text, "\u001B[42D                                          \u001B[42D", "")
+	hits := h.parsePolicyHits(text)
+	h.addLog("解析到<%d>条策略命中数", len(hits))
+	return hits, nil
+}
+
+func (h *huaWeiParse) parsePolicyHits(text string) []*policyHit {
+	/*
+		Total:3
+		RULE ID  RULE NAME                         STATE      ACTION       HITS
+		-------------------------------------------------------------------------------
+		1        YWJS-87034-Pre                    enable     permit       1024
+		0        default                           enable     deny         0
+	*/
+	results := make([]*policyHit, 0)
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		lines := splitLineBySpace(line)
+		if len(lines) < 5 {
+			continue
+		}
+		if _, e := strconv.Atoi(lines[0]); e != nil {
+			continue
+		}
+		count, e := strconv.Atoi(lines[len(lines)-1])
+		if e != nil {
+			continue
+		}
+		results = append(results, &policyHit{
+			// 策略名中可能有空格
+			name:     strings.Join(lines[1:len(lines)-3], " "),
+			hitCount: count,
+			command:  line,
+		})
+	}
+	return results
+}
@@ -3,13 +3,11 @@ package device
 import (
 	"fmt"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 	"netops/conf"
 	"netops/database"
 	netApi2 "netops/grpc_client/protobuf/net_api"
 	"netops/model"
 	"netops/utils"
-	"os"
 	"strings"
 )
 
@@ -31,14 +29,22 @@ func (h *HuaWeiHandler) init() {
 // ParseConfig 获取并解析配置
 func (h *HuaWeiHandler) ParseConfig() {
 	h.addLog("<-------开始解析设备策略------->")
+	if e := h.selectActive(); e != nil {
+		h.operateLog.Status = "failed"
+		h.addLog(e.Error())
+		_ = h.device.UpdateParseStatus(ParseStatusFailed)
+		return
+	}
+	if h.host != "" {
+		h.addLog("HA主设备: %s", h.host)
+	}
 	if e := h.parse(); e != nil {
 		h.operateLog.Status = "failed"
 		h.addLog(e.Error())
 		_ = h.device.UpdateParseStatus(ParseStatusFailed)
 		return
 	}
-	_ = h.device.UpdateParseStatus(ParseStatusSuccess)
-	h.addLog("<-------解析策略完成------->")
+	h.parseSuccess()
 }
 func (h *HuaWeiHandler) Search(info *model.TTaskInfo) (*model.TDevicePolicy, error) {
 	if h.error != nil {
@@ -46,99 +52,16 @@ func (h *HuaWeiHandler) Search(info *model.TTaskInfo) (*model.TDevicePolicy, err
 	}
 	l := zap.L().With(zap.Int("infoId", info.Id), zap.String("func", "Search"))
 	l.Debug("策略查询--->", zap.Any("device", h.device), zap.Any("info", info))
-	var (
-		result    *model.TDevicePolicy
-		db        *gorm.DB
-		portNames = []string{"any"}
-		err       error
-	)
-	// 根据设备ID，目标地址和方向获取已经开通的策略
-	l.Debug("1. 根据源目地址模糊匹配符合条件的策略--->")
-	db = database.DB.Where("device_id = ? and dst like ? and direction = ? and action = ?",
-		h.DeviceId, "%"+info.Dst+"%", info.Direction, "permit")
-	if info.Direction == "inside" && (info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6) { // 如果是办公网，则获取源为办公网的策略
-		db = db.Where("src_group = ?", info.Src)
-	} else {
-		db = db.Where("src like ?", "%"+info.Src+"%") // 否则获取源
-	}
-
-	// 如果协议不是IP，则获取端口所有所在的组
-	if info.Protocol != "ip" {
-		l.Debug("根据端口和协议获取端口所在的组--------->")
-		if portNames, err = h.getPortNames(info.DPort, info.Protocol); err != nil {
-			return nil, err
-		}
-		l.Debug("根据port和port_names过滤", zap.String("port", info.DPort), zap.Any("port_names", portNames))
-		// 根据源目地址获取到的策略，再进一步过滤端口是否开通，端口全匹配，或者端口为any，或者存在一个端口组
-		db = db.Where("port = ? or port = ? or port_group in ?", "any", info.DPort, portNames)
-	}
-	// 查询以上符合条件的策略
-	policies := make([]*model.TDevicePolicy, 0)
-	if err1 := db.Find(&policies).Error; err1 != nil {
-		return nil, fmt.Errorf("查询策略表失败, err: %w", err1)
-	}
-	// 如果匹配到策略，就返回第一条匹配的策略信息
-	if len(policies) > 0 {
-		l.Debug("匹配到策略信息--->")
-		result = policies[0]
-		l.Debug(fmt.Sprintf("匹配到的策略: <%+v>", *result))
-		return result, nil
-	} else {
-		// 否则进行模糊匹配，匹配地址所在的组策略是否开通
-		l.Info("2. 根据基本信息未匹配到相应的策略，开始进行网段的匹配------->")
-		// 如果没有匹配的策略，则获取所有地址组，根据地址组来查询
-		// 先获取源地址为网段的策略信息
-		l.Info("先根据基本条件进行过滤------------>")
-		subnetPolicies := make([]*model.TDevicePolicy, 0)
-		// 获取所有出向或入向所有开通的策略
-		db = database.DB.Where("action = ? and device_id = ? and direction = ?",
-			"permit", h.DeviceId, info.Direction)
-		// 加上端口过滤
-		if info.Protocol != "ip" {
-			db = db.Where("port = ? or port = ? or port in ?", "any", info.DPort, portNames)
-		}
-		// 获取到所有端口和方向已经开通的策略
-		if e1 := db.Find(&subnetPolicies).Error; e1 != nil {
-			return nil, fmt.Errorf("查询策略地址组失败, err: %w", e1)
-		}
-		// 根据源目地址找到符合条件的策略
-		l.Info("3. 根据源目地址从策略表中匹配策略--------->")
-		policies = h.getSubnetPolicy(subnetPolicies, info.Src, info.Dst)
-		if len(policies) > 0 {
-			if info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6 {
-				result = policies[0]
-			} else {
-				// 匹配出最小的策略
-				l.Debug("根据匹配到的网段策略, 获取范围最小的策略信息-------->")
-				result = h.getPolicy(policies, info.Src, info.Dst)
-				l.Debug("匹配到的策略--->", zap.Any("result", result))
-			}
-			return result, nil
+	if info.StaticIp != "" {
+		l.Debug("若需要做nat，先校验nat是否存在--->")
+		if nat := h.SearchNat(info); nat == nil {
+			l.Debug("未匹配到nat策略", zap.Any("nat", nat))
+			return nil, h.error
 		}
 	}
-	l.Debug("<-------策略查询结束------->")
-	return nil, nil
+	return h.searchPolicy(info)
 }
 
-// 获取端口所有组
-func (h *HuaWeiHandler) getPortNames(port, protocol string) (results []string, err error) {
-	p, err := utils.ParseRangePort(port)
-	if err != nil {
-		return
-	}
-	ports := make([]model.TDevicePort, 0)
-	db := database.DB.Where("device_id = ? and protocol = ? and start <= ? and end >= ?", h.DeviceId, protocol,
-		p.Start, p.End).Find(&ports)
-	if db.Error != nil {
-		return nil, fmt.Errorf("根据port<%s>获取端口组异常: <%s>", port, db.Error.Error())
-	}
-	results = make([]string, 0)
-	for _, p := range ports {
-		results = append(results, p.Name)
-	}
-	results = append(results, "any")
-	return results, nil
-}
 func (h *HuaWeiHandler) GetCommand(dp *model.TDevicePolicy) string {
 	return dp.Command
 }
@@ -209,7 +132,7 @@ func (h *HuaWeiHandler) genePortCmd(info *model.TTaskInfo) (portNames []string,
 }
 
 // 生成策略命令
-func (h *HuaWeiHandler) genePolicyCmd(direction, name, srcGroup, dstGroup string, portNames []string) string {
+func (h *HuaWeiHandler) genePolicyCmd(sourceZone, destinationZone, name, srcGroup, dstGroup string, portNames []string) string {
 	/*
 	 security-policy
 	 rule name YWJS-87034-Pre
@@ -222,15 +145,7 @@ func (h *HuaWeiHandler) genePolicyCmd(direction, name, srcGroup, dstGroup string
 	  service TCP-8001
 	  action permit
 	*/
-	var sourceZone, destinationZone string
-	switch direction {
-	case "inside":
-		sourceZone = h.device.OutPolicy
-		destinationZone = h.device.InPolicy
-	case "outside":
-		sourceZone = h.device.InPolicy
-		destinationZone = h.device.OutPolicy
-	default:
+	if sourceZone == "" || destinationZone == "" {
 		h.error = fmt.Errorf("未知的策略方向")
 	}
 	policyCmd := fmt.Sprintf("security-policy \n")
@@ -298,6 +213,7 @@ func (h *HuaWeiHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (stri
 		commands     = make([]string, 0)
 		groupName    = h.groupName(jiraKey, info)
 	)
+	sourceZone, destinationZone := h.zonePair(info)
 	l.Info("1. 生成源地址组策略命令--->")
 	// 如果办公网，地址组直接设置为办公网
 	if info.Src == "0.0.0.0/0" {
@@ -326,12 +242,17 @@ func (h *HuaWeiHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (stri
 	}
 
 	l.Info("4. 生成策略---------------------------------->")
-	commands = append(commands, h.genePolicyCmd(info.Direction, groupName, srcGroupName, dstGroupName, portNames))
-	return strings.Join(commands, "\n"), nil
-}
+	commands = append(commands, h.genePolicyCmd(sourceZone, destinationZone, groupName, srcGroupName, dstGroupName, portNames))
 
-func (h *HuaWeiHandler) CheckNat(info *model.TTaskInfo) (err error) {
-	return
+	l.Info("5. 生成nat---------------------------------->")
+	natCmd, e := h.geneNatCmd(groupName, info, srcGroupName, dstGroupName)
+	if e != nil {
+		return "", e
+	}
+	if natCmd != "" {
+		commands = append(commands, natCmd)
+	}
+	return strings.Join(commands, "\n"), nil
 }
 
 type huaWeiParse struct {
@@ -341,6 +262,7 @@ type huaWeiParse struct {
 	addressObjectText string
 	portGroupText     string
 	portObjectText    string
+	natText           string
 }
 
 func (h *huaWeiParse) parse() error {
@@ -371,42 +293,15 @@ func (h *huaWeiParse) parse() error {
 		return e
 	}
 
-	//h.addLog("5. 解析黑名单组地址--------------->")
+	h.addLog("5. 解析nat信息----------------->")
+	if e := h.parseNat(addressSets); e != nil {
+		return e
+	}
+
+	//h.addLog("6. 解析黑名单组地址--------------->")
 	//h.parseBlacklistGroupAddress()
 	return nil
 }
-func (h *huaWeiParse) getConfig1() {
-	fb, err := os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-huawei-policy.log")
-	if err != nil {
-		h.error = err
-		return
-	}
-	h.policyText = string(fb)
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-huawei-address-group.log")
-	if err != nil {
-		h.error = err
-		return
-	}
-	h.addressGroupText = string(fb)
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-huawei-address-object.log")
-	if err != nil {
-		h.error = err
-		return
-	}
-	h.addressObjectText = string(fb)
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-huawei-service-group.log")
-	if err != nil {
-		h.error = err
-		return
-	}
-	h.portGroupText = string(fb)
-	fb, err = os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\nj-huawei-service-object.log")
-	if err != nil {
-		h.error = err
-		return
-	}
-	h.portObjectText = string(fb)
-}
 func (h *huaWeiParse) getConfig() error {
 	h.addLog("2. 获取配置----------------->")
 	commands := []*netApi2.Command{
@@ -415,6 +310,7 @@ func (h *huaWeiParse) getConfig() error {
 		{Id: 3, Cmd: "dis ip address-set type object"},
 		{Id: 4, Cmd: "dis ip service-set type group"},
 		{Id: 5, Cmd: "dis ip service-set type object"},
+		{Id: 6, Cmd: "dis current-configuration"},
 	}
 	result, e := h.send(commands)
 	if e != nil {
@@ -434,6 +330,8 @@ func (h *huaWeiParse) getConfig() error {
 			h.portGroupText = item.Result
 		case 5:
 			h.portObjectText = item.Result
+		case 6:
+			h.natText = item.Result
 		}
 	}
 	return nil
@@ -902,6 +800,8 @@ func (h *huaWeiParse) savePolicies(policies []*huaweiPolicy, addressSets []*huaw
 				Name:      v.name,
 				Action:    v.action,
 				Direction: direction,
+				SrcZone:   v.sourceZone,
+				DstZone:   v.destinationZone,
 				SrcGroup:  strings.Join(srcGroups, ","),
 				DstGroup:  strings.Join(dstGroups, ","),
 				PortGroup: s,
@@ -924,18 +824,6 @@ func (h *huaWeiParse) savePolicies(policies []*huaweiPolicy, addressSets []*huaw
 	return h.savePolicy(bulks)
 }
 
-// 根据from-zone和to-zone区分出方向
-func (h *huaWeiParse) parseDirection(sourceZone, destinationZone string) string {
-	// 解析方向 如果 source-zone in destination-zone out则是出向， source-zone out destination-zone in 则是入向
-	switch {
-	case sourceZone == h.device.InPolicy && destinationZone == h.device.OutPolicy:
-		return "outside"
-	case sourceZone == h.device.OutPolicy && destinationZone == h.device.InPolicy:
-		return "inside"
-	}
-	return fmt.Sprintf("%s-%s", sourceZone, destinationZone)
-}
-
 // 判断是否是策略行
 func (h *huaWeiParse) isPolicyLine(line string) (string, bool) {
 	if line == "" {
@@ -0,0 +1,413 @@
+package device
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var maxIP = [16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// 设备策略匹配器缓存，解析成功后重新编译，保存策略时失效
+var policyMatchers = struct {
+	sync.RWMutex
+	m map[int]*policyMatcher
+}{m: make(map[int]*policyMatcher)}
+
+// 获取设备的策略匹配器，缓存中没有时从策略表编译
+func getPolicyMatcher(deviceId int) (*policyMatcher, error) {
+	policyMatchers.RLock()
+	m, ok := policyMatchers.m[deviceId]
+	policyMatchers.RUnlock()
+	if ok {
+		return m, nil
+	}
+	return reloadPolicyMatcher(deviceId)
+}
+
+// 重新编译设备的策略匹配器
+func reloadPolicyMatcher(deviceId int) (*policyMatcher, error) {
+	vendor, e := getDeviceVendor(deviceId)
+	if e != nil {
+		return nil, e
+	}
+	policies := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Order("line, id").Find(&policies).Error; e != nil {
+		return nil, fmt.Errorf("获取设备策略失败, device_id: %d, err: %w", deviceId, e)
+	}
+	ports := make([]*model.TDevicePort, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&ports).Error; e != nil {
+		return nil, fmt.Errorf("获取设备端口失败, device_id: %d, err: %w", deviceId, e)
+	}
+	m := newPolicyMatcher(vendor, policies, ports)
+	zap.L().Debug("编译策略匹配器", zap.Int("device_id", deviceId), zap.Int("total", len(policies)),
+		zap.Int("rules", len(m.rules)), zap.Int("skipped", len(m.skipped)))
+	policyMatchers.Lock()
+	policyMatchers.m[deviceId] = m
+	policyMatchers.Unlock()
+	return m, nil
+}
+
+// 设备策略变更后清除缓存的匹配器
+func invalidatePolicyMatcher(deviceId int) {
+	policyMatchers.Lock()
+	delete(policyMatchers.m, deviceId)
+	policyMatchers.Unlock()
+}
+
+/*
+策略匹配器，按行号顺序保存编译后的策略，源目地址分别建立区间索引
+查询时先通过索引取出源目地址都可能包含查询地址的策略，再按行号顺序校验协议和端口
+*/
+type policyMatcher struct {
+	rules   []*matchRule
+	src     *spanIndex
+	dst     *spanIndex
+	skipped []*model.TDevicePolicy // 未生效或目标地址无法解析的策略
+}
+
+// 编译后的策略，源地址无法解析时只能通过源地址组匹配，端口无法解析时不能匹配指定端口的查询
+type matchRule struct {
+	policy      *model.TDevicePolicy
+	anyProtocol bool
+	src         []span[[16]byte]
+	dst         []span[[16]byte]
+	ports       []span[int]
+}
+
+func newPolicyMatcher(vendor string, policies []*model.TDevicePolicy, ports []*model.TDevicePort) *policyMatcher {
+	portM := devicePortMap(ports)
+	m := &policyMatcher{rules: make([]*matchRule, 0, len(policies))}
+	for _, p := range policies {
+		if policyInactive(vendor, p) {
+			m.skipped = append(m.skipped, p)
+			continue
+		}
+		r := &matchRule{policy: p}
+		protocol := strings.ToLower(p.Protocol)
+		r.anyProtocol = protocol == "" || protocol == "ip" || isAny(protocol)
+		var ok bool
+		if r.dst, ok = parseAddressSpans(p.Dst); !ok {
+			m.skipped = append(m.skipped, p)
+			continue
+		}
+		r.src, _ = parseAddressSpans(p.Src)
+		if protocol == "ip" {
+			r.ports = []span[int]{{0, 65535}}
+		} else {
+			r.ports = parseRulePorts(p.Port, portM)
+		}
+		m.rules = append(m.rules, r)
+	}
+	srcSpans, dstSpans := make([][]span[[16]byte], len(m.rules)), make([][]span[[16]byte], len(m.rules))
+	for i, r := range m.rules {
+		srcSpans[i], dstSpans[i] = r.src, r.dst
+	}
+	m.src, m.dst = newSpanIndex(srcSpans), newSpanIndex(dstSpans)
+	return m
+}
+
+// 策略是否未生效，srx解析了deactivate，asa为inactive，h3c和华为为disable
+func policyInactive(vendor string, p *model.TDevicePolicy) bool {
+	switch vendor {
+	case "srx":
+		return !p.Valid
+	case "asa":
+		return strings.HasSuffix(strings.TrimSpace(strings.Split(p.Command, "\n")[0]), " inactive")
+	case "h3c", "huawei":
+		for _, v := range strings.Split(p.Command, "\n") {
+			if strings.TrimSpace(v) == "disable" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 设备端口名对应的端口范围，同名的多个端口用逗号拼接
+func devicePortMap(ports []*model.TDevicePort) map[string]string {
+	portM := make(map[string]string)
+	for _, v := range ports {
+		if p, ok := portM[v.Name]; ok {
+			portM[v.Name] = fmt.Sprintf("%s,%d-%d", p, v.Start, v.End)
+			continue
+		}
+		portM[v.Name] = fmt.Sprintf("%d-%d", v.Start, v.End)
+	}
+	return portM
+}
+
+// 解析策略端口，端口中的服务名从设备端口表中转换为端口范围
+func parseRulePorts(text string, portM map[string]string) []span[int] {
+	if r, ok := parsePortSpans(text); ok {
+		return r
+	}
+	items := strings.Split(text, ",")
+	for i, v := range items {
+		if p, ok := portM[strings.TrimSpace(v)]; ok {
+			items[i] = p
+		}
+	}
+	r, _ := parsePortSpans(strings.Join(items, ","))
+	return r
+}
+
+// 策略查询条件，为空的条件不限制
+type policyQuery struct {
+	direction   string
+	srcZone     string // 区域对不为空时按策略的区域匹配
+	dstZone     string
+	defaultZone bool // 区域对是否是方向对应的默认区域对，只有默认区域对能匹配没有区域的旧策略
+	srcGroup    string
+	src         []span[[16]byte]
+	dst         []span[[16]byte]
+	protocol    string
+	anyProtocol bool
+	ports       []span[int]
+}
+
+// 根据查询参数生成查询条件，源地址为办公网时匹配源地址组
+func newPolicyQuery(direction, src, dst, protocol, port string) (*policyQuery, error) {
+	q := &policyQuery{direction: direction, protocol: strings.ToLower(protocol)}
+	var ok bool
+	switch {
+	case src == conf.BanGongWang || src == conf.BanGongWangV6:
+		q.srcGroup = src
+	case src != "":
+		if q.src, ok = parseAddressSpans(src); !ok {
+			return nil, fmt.Errorf("源地址<%s>格式不正确", src)
+		}
+	}
+	if dst != "" {
+		if q.dst, ok = parseAddressSpans(dst); !ok {
+			return nil, fmt.Errorf("目标地址<%s>格式不正确", dst)
+		}
+	}
+	switch {
+	case q.protocol == "ip":
+		q.anyProtocol = true
+		q.ports = []span[int]{{0, 65535}}
+	case port != "":
+		if q.ports, ok = parsePortSpans(port); !ok {
+			return nil, fmt.Errorf("端口<%s>格式不正确", port)
+		}
+	}
+	return q, nil
+}
+
+func newTaskInfoQuery(info *model.TTaskInfo) (*policyQuery, error) {
+	return newPolicyQuery(info.Direction, info.Src, info.Dst, info.Protocol, info.DPort)
+}
+
+// match 策略是否包含查询的所有地址和端口
+func (r *matchRule) match(q *policyQuery) bool {
+	if !r.zoneMatch(q) {
+		return false
+	}
+	return r.srcMatch(q) && r.dstMatch(q) && r.protocolMatch(q) && r.portMatch(q)
+}
+
+func (r *matchRule) zoneMatch(q *policyQuery) bool {
+	directionMatch := q.direction == "" || r.policy.Direction == q.direction
+	if q.srcZone == "" && q.dstZone == "" {
+		return directionMatch
+	}
+	// 策略没有区域时无法确认区域对，只有查询的是方向对应的默认区域对时才按方向匹配
+	if r.policy.SrcZone == "" && r.policy.DstZone == "" {
+		return q.defaultZone && directionMatch
+	}
+	return r.policy.SrcZone == q.srcZone && r.policy.DstZone == q.dstZone
+}
+
+func (r *matchRule) srcMatch(q *policyQuery) bool {
+	switch {
+	case q.srcGroup != "":
+		return r.policy.SrcGroup == q.srcGroup
+	case q.src != nil:
+		return r.src != nil && spansCover(r.src, q.src, compareIP)
+	}
+	return true
+}
+
+func (r *matchRule) dstMatch(q *policyQuery) bool {
+	return q.dst == nil || spansCover(r.dst, q.dst, compareIP)
+}
+
+func (r *matchRule) protocolMatch(q *policyQuery) bool {
+	switch {
+	case q.anyProtocol:
+		return r.anyProtocol
+	case q.protocol != "":
+		return r.anyProtocol || strings.Contains(strings.ToLower(r.policy.Protocol), q.protocol)
+	}
+	return true
+}
+
+func (r *matchRule) portMatch(q *policyQuery) bool {
+	return q.ports == nil || (r.ports != nil && spansCover(r.ports, q.ports, compareInt))
+}
+
+// 通过索引获取候选策略的序号，按行号顺序排列
+func (m *policyMatcher) candidates(q *policyQuery) []int {
+	var results []int
+	switch {
+	case q.src != nil && q.dst != nil:
+		// 策略需要包含查询的所有地址，只需要查询第一个区间的起始地址
+		srcM := make(map[int]bool)
+		for _, v := range m.src.stab(q.src[0].start) {
+			srcM[v] = true
+		}
+		for _, v := range m.dst.stab(q.dst[0].start) {
+			if srcM[v] {
+				results = append(results, v)
+			}
+		}
+	case q.src != nil:
+		results = m.src.stab(q.src[0].start)
+	case q.dst != nil:
+		results = m.dst.stab(q.dst[0].start)
+	default:
+		results = make([]int, len(m.rules))
+		for i := range m.rules {
+			results[i] = i
+		}
+		return results
+	}
+	sort.Ints(results)
+	return results
+}
+
+// first 按行号顺序返回第一条匹配的策略
+func (m *policyMatcher) first(q *policyQuery) *model.TDevicePolicy {
+	for _, i := range m.candidates(q) {
+		if m.rules[i].match(q) {
+			p := *m.rules[i].policy
+			return &p
+		}
+	}
+	return nil
+}
+
+// all 按行号顺序返回所有匹配的策略
+func (m *policyMatcher) all(q *policyQuery) []*model.TDevicePolicy {
+	results := make([]*model.TDevicePolicy, 0)
+	for _, i := range m.candidates(q) {
+		if m.rules[i].match(q) {
+			p := *m.rules[i].policy
+			results = append(results, &p)
+		}
+	}
+	return results
+}
+
+// 地址区间索引，线段树的每个节点保存完整覆盖该节点区间的策略序号，查询时从根节点走到地址所在的叶子节点
+type spanIndex struct {
+	bounds [][16]byte // 基本区间的起始地址，最后一个区间到最大地址为止
+	nodes  [][]int
+}
+
+func newSpanIndex(items [][]span[[16]byte]) *spanIndex {
+	idx := &spanIndex{bounds: make([][16]byte, 0)}
+	for _, spans := range items {
+		for _, s := range spans {
+			idx.bounds = append(idx.bounds, s.start)
+			if s.end != maxIP {
+				idx.bounds = append(idx.bounds, nextIP(s.end))
+			}
+		}
+	}
+	sort.Slice(idx.bounds, func(i, j int) bool {
+		return compareIP(idx.bounds[i], idx.bounds[j]) < 0
+	})
+	bounds := idx.bounds[:0]
+	for i, v := range idx.bounds {
+		if i == 0 || v != idx.bounds[i-1] {
+			bounds = append(bounds, v)
+		}
+	}
+	idx.bounds = bounds
+	if len(idx.bounds) == 0 {
+		return idx
+	}
+	idx.nodes = make([][]int, 4*len(idx.bounds))
+	for i, spans := range items {
+		for _, s := range spans {
+			lo, hi := idx.find(s.start), len(idx.bounds)-1
+			if s.end != maxIP {
+				hi = idx.find(nextIP(s.end)) - 1
+			}
+			idx.insert(1, 0, len(idx.bounds)-1, lo, hi, i)
+		}
+	}
+	return idx
+}
+
+// 地址所在的基本区间，小于所有区间时返回-1
+func (idx *spanIndex) find(ip [16]byte) int {
+	return sort.Search(len(idx.bounds), func(i int) bool {
+		return compareIP(idx.bounds[i], ip) > 0
+	}) - 1
+}
+
+func (idx *spanIndex) insert(node, l, r, lo, hi, id int) {
+	if lo <= l && r <= hi {
+		idx.nodes[node] = append(idx.nodes[node], id)
+		return
+	}
+	mid := (l + r) / 2
+	if lo <= mid {
+		idx.insert(node*2, l, mid, lo, hi, id)
+	}
+	if hi > mid {
+		idx.insert(node*2+1, mid+1, r, lo, hi, id)
+	}
+}
+
+// stab 获取包含该地址的所有策略序号，同一策略的区间已合并，不会重复
+func (idx *spanIndex) stab(ip [16]byte) []int {
+	k := idx.find(ip)
+	if k < 0 {
+		return nil
+	}
+	results := make([]int, 0)
+	node, l, r := 1, 0, len(idx.bounds)-1
+	for {
+		results = append(results, idx.nodes[node]...)
+		if l == r {
+			return results
+		}
+		mid := (l + r) / 2
+		if k <= mid {
+			node, r = node*2, mid
+		} else {
+			node, l = node*2+1, mid+1
+		}
+	}
+}
+
+// 根据工单策略查询设备上第一条匹配的策略，第一条为deny时说明未开通
+func (b *base) searchPolicy(info *model.TTaskInfo) (*model.TDevicePolicy, error) {
+	l := zap.L().With(zap.String("func", "searchPolicy"), zap.Int("info_id", info.Id))
+	m, e := getPolicyMatcher(b.DeviceId)
+	if e != nil {
+		return nil, e
+	}
+	q, e := newTaskInfoQuery(info)
+	if e != nil {
+		return nil, e
+	}
+	q.srcZone, q.dstZone = b.zonePair(info)
+	q.defaultZone = b.isDefaultZonePair(info.Direction, q.srcZone, q.dstZone)
+	result := m.first(q)
+	l.Debug("匹配到的策略--->", zap.Any("result", result))
+	if result == nil || result.Action != "permit" {
+		return nil, nil
+	}
+	return result, nil
+}
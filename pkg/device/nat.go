@@ -0,0 +1,671 @@
+package device
+
+import (
+	"fmt"
+	"net"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// SearchNat 查询nat是否已存在，入向匹配内网地址端口和映射地址端口，出向匹配源地址、目标地址和映射地址池
+func (b *base) SearchNat(info *model.TTaskInfo) *model.TDeviceNat {
+	nats := make([]*model.TDeviceNat, 0)
+	if e := database.DB.Where("device_id = ? and direction = ?", b.DeviceId, info.Direction).Find(&nats).Error; e != nil {
+		b.error = fmt.Errorf("获取nat配置信息异常: %w", e)
+		return nil
+	}
+	for _, v := range nats {
+		if info.Direction == "inside" {
+			if info.StaticIp == "" || !natProtocolMatch(v.Protocol, info.Protocol) {
+				continue
+			}
+			if addressContains(v.Network, info.Dst) && addressContains(v.Static, info.StaticIp) &&
+				portContains(v.NetworkPort, info.DPort) && portContains(v.StaticPort, info.StaticPort) {
+				return v
+			}
+			continue
+		}
+		if info.PoolName == "" || v.StaticGroup != info.PoolName {
+			continue
+		}
+		if addressContains(v.Network, info.Src) && (v.Destination == "" || addressContains(v.Destination, info.Dst)) {
+			return v
+		}
+	}
+	return nil
+}
+
+// 校验nat映射端口是否被占用，一个公网地址端口只能映射到一个内网地址端口
+func (b *base) checkNat(info *model.TTaskInfo) error {
+	if info.StaticIp == "" {
+		return nil
+	}
+	nats := make([]*model.TDeviceNat, 0)
+	if e := database.DB.Where("device_id = ? and direction = ?", b.DeviceId, "inside").Find(&nats).Error; e != nil {
+		return fmt.Errorf("获取nat配置信息异常: %w", e)
+	}
+	for _, v := range nats {
+		if !natProtocolMatch(v.Protocol, info.Protocol) || !addressContains(v.Static, info.StaticIp) || !portOverlaps(v.StaticPort, info.StaticPort) {
+			continue
+		}
+		if addressContains(v.Network, info.Dst) && portContains(v.NetworkPort, info.DPort) {
+			continue
+		}
+		return fmt.Errorf("策略<%s-%s>端口已映射到<%s-%s>", info.StaticIp, info.StaticPort, v.Network, v.NetworkPort)
+	}
+	return nil
+}
+
+// nat协议为空或ip时包含所有协议
+func natProtocolMatch(natProtocol, protocol string) bool {
+	natProtocol = strings.ToLower(natProtocol)
+	return natProtocol == "" || natProtocol == "ip" || natProtocol == strings.ToLower(protocol)
+}
+
+// 端口是否有交集，任意一方为空时视为any
+func portOverlaps(text, port string) bool {
+	if text == "" || port == "" {
+		return true
+	}
+	a, ok := parsePortSpans(text)
+	if !ok {
+		return false
+	}
+	b, ok := parsePortSpans(port)
+	return ok && spansIntersect(a, b, compareInt)
+}
+
+// 单个地址转换为带掩码的地址
+func hostAddress(ip string) string {
+	if strings.Contains(ip, ":") {
+		return ip + "/128"
+	}
+	return ip + "/32"
+}
+
+// 端口名转换为端口号，两个端口时为端口范围
+func natPort(ports []string) string {
+	results := make([]string, 0, len(ports))
+	for _, v := range ports {
+		if p, ok := PortMaps[v]; ok {
+			v = p
+		}
+		results = append(results, v)
+	}
+	switch len(results) {
+	case 0:
+		return "any"
+	case 1:
+		return results[0]
+	}
+	return fmt.Sprintf("%s-%s", results[0], results[1])
+}
+
+/*
+解析nat server，h3c和华为格式基本一致，地址后可以跟结束地址和端口
+h3c:    nat server protocol tcp global 116.228.151.3 1022 inside 172.17.25.49 22 rule ServerRule_1
+huawei: nat server web 0 protocol tcp global 116.228.151.3 www inside 172.17.25.49 www no-reverse
+*/
+func (b *base) parseNatServer(line string) (*model.TDeviceNat, bool) {
+	lines := splitLineBySpace(line)
+	if len(lines) < 6 || lines[0] != "nat" || lines[1] != "server" {
+		return nil, false
+	}
+	result := &model.TDeviceNat{DeviceId: b.DeviceId, Direction: "inside", Protocol: "ip", Command: line}
+	i := 2
+	for ; i < len(lines) && lines[i] != "protocol" && lines[i] != "global"; i++ {
+		if result.StaticGroup == "" {
+			result.StaticGroup = lines[i]
+		}
+	}
+	if i < len(lines)-1 && lines[i] == "protocol" {
+		result.Protocol = b.changeNatProtocol(lines[i+1])
+		i += 2
+	}
+	if i >= len(lines) || lines[i] != "global" {
+		return nil, false
+	}
+	var globalAddresses, globalPorts, insideAddresses, insidePorts []string
+	target := &globalAddresses
+	ports := &globalPorts
+	for i++; i < len(lines); i++ {
+		v := lines[i]
+		switch {
+		case v == "inside":
+			target, ports = &insideAddresses, &insidePorts
+			continue
+		case v == "rule" && i < len(lines)-1:
+			result.StaticGroup = lines[i+1]
+			i++
+			continue
+		case net.ParseIP(v) != nil:
+			*target = append(*target, v)
+			continue
+		}
+		if _, ok := PortMaps[v]; ok || isNumber(v) {
+			*ports = append(*ports, v)
+		}
+	}
+	if len(globalAddresses) == 0 || len(insideAddresses) == 0 {
+		return nil, false
+	}
+	result.Static = b.natServerAddress(globalAddresses)
+	result.Network = b.natServerAddress(insideAddresses)
+	result.StaticPort = natPort(globalPorts)
+	result.NetworkPort = natPort(insidePorts)
+	return result, true
+}
+
+func (b *base) natServerAddress(addresses []string) string {
+	if len(addresses) > 1 {
+		return strings.Join(b.getRangeAddress(addresses[0], addresses[1]), ",")
+	}
+	return hostAddress(addresses[0])
+}
+
+func (b *base) changeNatProtocol(protocol string) string {
+	if r, ok := ProtocolMaps[protocol]; ok {
+		return r
+	}
+	return protocol
+}
+
+func isNumber(text string) bool {
+	if text == "" {
+		return false
+	}
+	for _, c := range text {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 按\r拆分配置，保留行首的缩进用于区分配置块
+func splitConfigLines(text string) []string {
+	results := make([]string, 0)
+	for _, line := range strings.Split(text, "\r") {
+		line = strings.TrimRight(strings.TrimLeft(line, "\n"), " ")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		results = append(results, line)
+	}
+	return results
+}
+
+var natInterfaceRegexp = regexp.MustCompile(`^interface (\S+)`)
+
+// 获取已有nat server所在的接口，h3c的nat server需要配置在接口下
+func (b *base) getNatServerInterface() (string, error) {
+	nats := make([]*model.TDeviceNat, 0)
+	if e := database.DB.Where("device_id = ? and direction = ? and command like ?", b.DeviceId, "inside", "interface %").Find(&nats).Error; e != nil {
+		return "", fmt.Errorf("获取nat server接口失败, err: %w", e)
+	}
+	for _, v := range nats {
+		if r := natInterfaceRegexp.FindStringSubmatch(v.Command); r != nil {
+			return r[1], nil
+		}
+	}
+	return "", fmt.Errorf("设备上没有已配置nat server的接口, 无法生成nat server命令")
+}
+
+type h3cNatPolicy struct {
+	name            string
+	sourceZone      string
+	destinationZone string
+	sourceIp        string
+	destinationIp   string
+	pool            string
+	commands        []string
+}
+
+// 解析h3c的nat配置，nat server和nat outbound配置在接口下，地址池和全局nat策略单独配置
+func (h *h3cParse) parseNat(addresses []*h3cAddressGroup) error {
+	/*
+		interface GigabitEthernet1/0/1
+		 nat outbound 3000 address-group 1
+		 nat server protocol tcp global 116.228.151.3 1022 inside 172.17.25.49 22 rule ServerRule_1
+		nat static outbound 172.17.1.1 116.228.151.5
+		nat address-group 1 name PAT-CN2
+		 address 116.228.151.10 116.228.151.20
+		nat global-policy
+		 rule name snat1
+		  source-ip snat1-src
+		  destination-ip snat1-dst
+		  action snat address-group name PAT-CN2
+	*/
+	var (
+		nats         = make([]*model.TDeviceNat, 0)
+		pools        = make([]*model.TDeviceNatPool, 0)
+		policies     = make([]*h3cNatPolicy, 0)
+		block        string
+		pool         *model.TDeviceNatPool
+		policy       *h3cNatPolicy
+		outbounds    = make([]*model.TDeviceNat, 0)
+		poolIds      = make(map[string]string)
+		groupM       = h.makeAddressM(addresses)
+		natInterface string
+	)
+	for _, line := range splitConfigLines(h.natText) {
+		lines := splitLineBySpace(line)
+		if !strings.HasPrefix(line, " ") {
+			block, pool, policy, natInterface = "", nil, nil, ""
+			switch {
+			case strings.HasPrefix(line, "interface "):
+				block, natInterface = "interface", lines[1]
+			case strings.HasPrefix(line, "nat address-group ") && len(lines) > 2:
+				block = "address-group"
+				pool = &model.TDeviceNatPool{DeviceId: h.DeviceId, NatType: "source", Name: lines[2], Command: line}
+				if len(lines) > 4 && lines[3] == "name" {
+					pool.Name = lines[4]
+				}
+				poolIds[lines[2]] = pool.Name
+				pools = append(pools, pool)
+			case line == "nat global-policy":
+				block = "global-policy"
+			case strings.HasPrefix(line, "nat server "):
+				if n, ok := h.parseNatServer(line); ok {
+					nats = append(nats, n)
+				}
+			case strings.HasPrefix(line, "nat static outbound ") && len(lines) > 4 && net.ParseIP(lines[3]) != nil:
+				nats = append(nats, &model.TDeviceNat{
+					DeviceId:    h.DeviceId,
+					Direction:   "outside",
+					Network:     hostAddress(lines[3]),
+					Static:      hostAddress(lines[4]),
+					Protocol:    "ip",
+					NetworkPort: "any",
+					StaticPort:  "any",
+					Destination: "any",
+					Command:     line,
+				})
+			}
+			continue
+		}
+		text := strings.TrimSpace(line)
+		switch block {
+		case "interface":
+			switch {
+			case strings.HasPrefix(text, "nat server "):
+				if n, ok := h.parseNatServer(text); ok {
+					n.Command = fmt.Sprintf("interface %s\n %s", natInterface, text)
+					nats = append(nats, n)
+				}
+			case strings.HasPrefix(text, "nat outbound ") && len(lines) > 4 && lines[3] == "address-group":
+				// 接口下的nat outbound通过acl匹配源地址，acl不解析，只记录引用的地址池
+				n := &model.TDeviceNat{
+					DeviceId:     h.DeviceId,
+					Direction:    "outside",
+					NetworkGroup: "acl " + lines[2],
+					StaticGroup:  lines[4],
+					Protocol:     "ip",
+					NetworkPort:  "any",
+					StaticPort:   "any",
+					Destination:  "any",
+					Command:      fmt.Sprintf("interface %s\n %s", natInterface, text),
+				}
+				nats = append(nats, n)
+				outbounds = append(outbounds, n)
+			}
+		case "address-group":
+			pool.Command += "\n" + line
+			if lines[0] == "address" && len(lines) > 2 {
+				addrs := h.getRangeAddress(lines[1], lines[2])
+				if pool.Address != "" {
+					addrs = append([]string{pool.Address}, addrs...)
+				}
+				pool.Address = strings.Join(addrs, ",")
+			}
+		case "global-policy":
+			if lines[0] == "rule" && len(lines) > 2 {
+				policy = &h3cNatPolicy{name: lines[2], commands: []string{text}}
+				policies = append(policies, policy)
+				continue
+			}
+			if policy == nil || len(lines) < 2 {
+				continue
+			}
+			policy.commands = append(policy.commands, text)
+			switch lines[0] {
+			case "source-zone":
+				policy.sourceZone = lines[1]
+			case "destination-zone":
+				policy.destinationZone = lines[1]
+			case "source-ip":
+				policy.sourceIp = lines[1]
+			case "destination-ip":
+				policy.destinationIp = lines[1]
+			case "action":
+				// action snat address-group name PAT-CN2
+				if len(lines) > 4 && lines[1] == "snat" && lines[2] == "address-group" && lines[3] == "name" {
+					policy.pool = lines[4]
+				}
+			}
+		}
+	}
+	poolM := make(map[string]*model.TDeviceNatPool)
+	for _, v := range pools {
+		poolM[v.Name] = v
+	}
+	// nat outbound引用的是地址池编号，转换为地址池名称
+	for _, v := range outbounds {
+		if name, ok := poolIds[v.StaticGroup]; ok {
+			v.StaticGroup = name
+		}
+		if p, ok := poolM[v.StaticGroup]; ok {
+			v.Static = p.Address
+		}
+	}
+	for _, v := range policies {
+		if v.pool == "" {
+			h.addLog("全局nat策略<%s>不是源nat, 跳过", v.name)
+			continue
+		}
+		direction := "outside"
+		if v.sourceZone != "" || v.destinationZone != "" {
+			direction = h.parseDirection(v.sourceZone, v.destinationZone)
+		}
+		n := &model.TDeviceNat{
+			DeviceId:         h.DeviceId,
+			Direction:        direction,
+			NetworkGroup:     v.sourceIp,
+			Network:          h3cNatAddress(v.sourceIp, groupM),
+			DestinationGroup: v.destinationIp,
+			Destination:      h3cNatAddress(v.destinationIp, groupM),
+			StaticGroup:      v.pool,
+			Protocol:         "ip",
+			NetworkPort:      "any",
+			StaticPort:       "any",
+			Command:          "nat global-policy\n " + strings.Join(v.commands, "\n  "),
+		}
+		if p, ok := poolM[v.pool]; ok {
+			n.Static = p.Address
+		}
+		nats = append(nats, n)
+	}
+	h.addLog("解析到%d个nat地址池, %d条nat", len(pools), len(nats))
+	if e := h.saveNatPool(pools); e != nil {
+		return e
+	}
+	return h.saveNat(nats)
+}
+
+func h3cNatAddress(groupName string, groupM map[string][]string) string {
+	if groupName == "" {
+		return "any"
+	}
+	if addresses, ok := groupM[groupName]; ok {
+		return strings.Join(addresses, ",")
+	}
+	return groupName
+}
+
+type huaweiNatPolicy struct {
+	name               string
+	sourceZone         string
+	destinationZone    string
+	sourceGroups       []string
+	sourceAddress      []string
+	destinationGroups  []string
+	destinationAddress []string
+	pool               string
+	commands           []string
+}
+
+// 解析华为的nat配置，nat server、地址池和nat-policy都是全局配置
+func (h *huaWeiParse) parseNat(addressSets []*huaweiAddressSet) error {
+	/*
+		nat address-group PAT-CN2 0
+		 mode pat
+		 section 0 116.228.151.10 116.228.151.20
+		nat server web 0 protocol tcp global 116.228.151.3 1022 inside 172.17.25.49 22 no-reverse
+		nat-policy
+		 rule name snat1
+		  source-zone trust
+		  destination-zone untrust
+		  source-address address-set snat1-src
+		  destination-address 10.233.89.0 mask 255.255.255.0
+		  action source-nat address-group PAT-CN2
+	*/
+	var (
+		nats     = make([]*model.TDeviceNat, 0)
+		pools    = make([]*model.TDeviceNatPool, 0)
+		policies = make([]*huaweiNatPolicy, 0)
+		block    string
+		pool     *model.TDeviceNatPool
+		policy   *huaweiNatPolicy
+	)
+	for _, line := range splitConfigLines(h.natText) {
+		lines := splitLineBySpace(line)
+		if !strings.HasPrefix(line, " ") {
+			block, pool, policy = "", nil, nil
+			switch {
+			case strings.HasPrefix(line, "nat address-group ") && len(lines) > 2:
+				block = "address-group"
+				pool = &model.TDeviceNatPool{DeviceId: h.DeviceId, NatType: "source", Name: lines[2], Command: line}
+				pools = append(pools, pool)
+			case line == "nat-policy":
+				block = "nat-policy"
+			case strings.HasPrefix(line, "nat server "):
+				if n, ok := h.parseNatServer(line); ok {
+					nats = append(nats, n)
+				}
+			}
+			continue
+		}
+		text := strings.TrimSpace(line)
+		switch block {
+		case "address-group":
+			pool.Command += "\n" + line
+			// section 0 116.228.151.10 116.228.151.20
+			if lines[0] == "section" && len(lines) > 3 {
+				addrs := h.getRangeAddress(lines[2], lines[3])
+				if pool.Address != "" {
+					addrs = append([]string{pool.Address}, addrs...)
+				}
+				pool.Address = strings.Join(addrs, ",")
+			}
+		case "nat-policy":
+			if lines[0] == "rule" && len(lines) > 2 {
+				policy = &huaweiNatPolicy{name: lines[2], commands: []string{text}}
+				policies = append(policies, policy)
+				continue
+			}
+			if policy == nil || len(lines) < 2 {
+				continue
+			}
+			policy.commands = append(policy.commands, text)
+			switch lines[0] {
+			case "source-zone":
+				policy.sourceZone = lines[1]
+			case "destination-zone":
+				policy.destinationZone = lines[1]
+			case "source-address":
+				group, addresses := h.parseNatPolicyAddress(lines[1:])
+				policy.sourceGroups = append(policy.sourceGroups, group...)
+				policy.sourceAddress = append(policy.sourceAddress, addresses...)
+			case "destination-address":
+				group, addresses := h.parseNatPolicyAddress(lines[1:])
+				policy.destinationGroups = append(policy.destinationGroups, group...)
+				policy.destinationAddress = append(policy.destinationAddress, addresses...)
+			case "action":
+				// action source-nat address-group PAT-CN2
+				if len(lines) > 3 && lines[1] == "source-nat" && lines[2] == "address-group" {
+					policy.pool = lines[3]
+				}
+			}
+		}
+	}
+	poolM := make(map[string]*model.TDeviceNatPool)
+	for _, v := range pools {
+		poolM[v.Name] = v
+	}
+	addressSetM := h.makeAddressSetM(addressSets)
+	for _, v := range policies {
+		if v.pool == "" {
+			h.addLog("nat策略<%s>不是源nat, 跳过", v.name)
+			continue
+		}
+		n := &model.TDeviceNat{
+			DeviceId:         h.DeviceId,
+			Direction:        h.parseDirection(v.sourceZone, v.destinationZone),
+			NetworkGroup:     strings.Join(v.sourceGroups, ","),
+			Network:          huaweiNatAddress(v.sourceGroups, v.sourceAddress, addressSetM),
+			DestinationGroup: strings.Join(v.destinationGroups, ","),
+			Destination:      huaweiNatAddress(v.destinationGroups, v.destinationAddress, addressSetM),
+			StaticGroup:      v.pool,
+			Protocol:         "ip",
+			NetworkPort:      "any",
+			StaticPort:       "any",
+			Command:          "nat-policy\n " + strings.Join(v.commands, "\n  "),
+		}
+		if p, ok := poolM[v.pool]; ok {
+			n.Static = p.Address
+		}
+		nats = append(nats, n)
+	}
+	h.addLog("解析到%d个nat地址池, %d条nat", len(pools), len(nats))
+	if e := h.saveNatPool(pools); e != nil {
+		return e
+	}
+	return h.saveNat(nats)
+}
+
+// 解析nat-policy中的地址，address-set返回组名，其他格式返回带掩码的地址
+func (h *huaWeiParse) parseNatPolicyAddress(lines []string) (groups []string, addresses []string) {
+	switch {
+	case lines[0] == "address-set" && len(lines) > 1:
+		return []string{lines[1]}, nil
+	case lines[0] == "range" && len(lines) > 2:
+		return nil, h.getRangeAddress(lines[1], lines[2])
+	case len(lines) > 2 && lines[1] == "mask":
+		return nil, []string{ipMaskSimple(lines[0], lines[2])}
+	case len(lines) > 1:
+		return nil, []string{fmt.Sprintf("%s/%s", lines[0], lines[1])}
+	}
+	return nil, []string{hostAddress(lines[0])}
+}
+
+func huaweiNatAddress(groups, addresses []string, addressSetM map[string][]string) string {
+	results := append([]string{}, addresses...)
+	for _, v := range groups {
+		if items, ok := addressSetM[v]; ok {
+			results = append(results, items...)
+		} else {
+			results = append(results, v)
+		}
+	}
+	if len(results) == 0 {
+		return "any"
+	}
+	return strings.Join(results, ",")
+}
+
+// CheckNat 校验NAT端口是否被占用
+func (h *H3cHandler) CheckNat(info *model.TTaskInfo) error {
+	return h.checkNat(info)
+}
+
+// 生成nat命令，入向生成nat server，出向CN2生成全局源nat策略，nat已存在时记录已有配置
+func (h *H3cHandler) geneNatCmd(groupName string, info *model.TTaskInfo, srcGroupName, dstGroupName string) (string, error) {
+	if info.StaticIp == "" && !(info.Direction == "outside" && strings.Contains(info.OutboundNetworkType, "CN2")) {
+		return "", nil
+	}
+	if info.Direction == "outside" && info.PoolName == "" {
+		return "", fmt.Errorf("出向<%s>类型，未定义nat映射信息", info.OutboundNetworkType)
+	}
+	if nat := h.SearchNat(info); nat != nil {
+		zap.L().Info("nat已存在", zap.Any("nat", nat))
+		info.ExistsConfig = nat.Command
+		return "", nil
+	}
+	if h.error != nil {
+		return "", h.error
+	}
+	name := fmt.Sprintf("%s-NAT", groupName)
+	if info.StaticIp != "" {
+		natInterface, e := h.getNatServerInterface()
+		if e != nil {
+			return "", e
+		}
+		static, dst := strings.Split(info.StaticIp, "/")[0], strings.Split(info.Dst, "/")[0]
+		cmd := fmt.Sprintf("interface %s\n", natInterface)
+		if info.Protocol == "ip" {
+			cmd += fmt.Sprintf(" nat server global %s inside %s rule %s\n", static, dst, name)
+		} else {
+			cmd += fmt.Sprintf(" nat server protocol %s global %s %s inside %s %s rule %s\n",
+				info.Protocol, static, natPortArg(info.StaticPort), dst, natPortArg(info.DPort), name)
+		}
+		return cmd + "quit\n", nil
+	}
+	cmd := fmt.Sprintf("nat global-policy\n rule name %s\n", name)
+	if natMatchSource(srcGroupName) {
+		cmd += fmt.Sprintf("  source-ip %s\n", srcGroupName)
+	}
+	if dstGroupName != "" && dstGroupName != "any" {
+		cmd += fmt.Sprintf("  destination-ip %s\n", dstGroupName)
+	}
+	cmd += fmt.Sprintf("  action snat address-group name %s\nquit\n", info.PoolName)
+	return cmd, nil
+}
+
+// CheckNat 校验NAT端口是否被占用
+func (h *HuaWeiHandler) CheckNat(info *model.TTaskInfo) error {
+	return h.checkNat(info)
+}
+
+// 生成nat命令，入向生成nat server，出向CN2生成源nat策略，nat已存在时记录已有配置
+func (h *HuaWeiHandler) geneNatCmd(groupName string, info *model.TTaskInfo, srcGroupName, dstGroupName string) (string, error) {
+	if info.StaticIp == "" && !(info.Direction == "outside" && strings.Contains(info.OutboundNetworkType, "CN2")) {
+		return "", nil
+	}
+	if info.Direction == "outside" && info.PoolName == "" {
+		return "", fmt.Errorf("出向<%s>类型，未定义nat映射信息", info.OutboundNetworkType)
+	}
+	if nat := h.SearchNat(info); nat != nil {
+		zap.L().Info("nat已存在", zap.Any("nat", nat))
+		info.ExistsConfig = nat.Command
+		return "", nil
+	}
+	if h.error != nil {
+		return "", h.error
+	}
+	name := fmt.Sprintf("%s-NAT", groupName)
+	if info.StaticIp != "" {
+		static, dst := strings.Split(info.StaticIp, "/")[0], strings.Split(info.Dst, "/")[0]
+		if info.Protocol == "ip" {
+			return fmt.Sprintf("nat server %s global %s inside %s no-reverse\n", name, static, dst), nil
+		}
+		return fmt.Sprintf("nat server %s protocol %s global %s %s inside %s %s no-reverse\n",
+			name, info.Protocol, static, natPortArg(info.StaticPort), dst, natPortArg(info.DPort)), nil
+	}
+	sourceZone, destinationZone := h.zonePair(info)
+	cmd := fmt.Sprintf("nat-policy\n rule name %s\n", name)
+	cmd += fmt.Sprintf("  source-zone %s\n", sourceZone)
+	cmd += fmt.Sprintf("  destination-zone %s\n", destinationZone)
+	if natMatchSource(srcGroupName) {
+		cmd += fmt.Sprintf("  source-address address-set %s\n", srcGroupName)
+	}
+	if dstGroupName != "" && dstGroupName != "any" {
+		cmd += fmt.Sprintf("  destination-address address-set %s\n", dstGroupName)
+	}
+	cmd += fmt.Sprintf("  action source-nat address-group %s\nquit\n", info.PoolName)
+	return cmd, nil
+}
+
+// 源nat策略是否需要匹配源地址组，any和办公网为全部内网地址，不限制源地址
+func natMatchSource(srcGroupName string) bool {
+	return srcGroupName != "" && srcGroupName != "any" && srcGroupName != conf.BanGongWang && srcGroupName != conf.BanGongWangV6
+}
+
+// nat server的端口范围使用空格分隔
+func natPortArg(port string) string {
+	return strings.Replace(port, "-", " ", 1)
+}
@@ -0,0 +1,133 @@
+package device
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OfflineConfig 离线配置，用于无法直连的设备、历史备份或解析问题复现
+// Text 为完整的配置文本，所有命令均返回该文本，由各解析器按行过滤
+// Results 为按命令id区分的命令输出，对应各解析器getConfig中的命令id，优先于Text
+// Uris 为F5接口返回的json，key为去掉/mgmt/tm/ltm/前缀后把/替换为_的接口路径，如pool、virtual、virtual-address
+type OfflineConfig struct {
+	Text    string            `json:"text"`
+	Results map[int32]string  `json:"results"`
+	Uris    map[string]string `json:"uris"`
+}
+
+// NewOfflineConfig 根据文件名和内容组装离线配置
+// 文件名为数字的(如1.log)按命令id处理，.json文件按F5接口处理，其他文件视为完整配置
+func NewOfflineConfig(files map[string][]byte) (*OfflineConfig, error) {
+	result := &OfflineConfig{
+		Results: make(map[int32]string),
+		Uris:    make(map[string]string),
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	texts := make([]string, 0)
+	for _, name := range names {
+		content := files[name]
+		ext := filepath.Ext(name)
+		key := strings.TrimSuffix(filepath.Base(name), ext)
+		if id, e := strconv.Atoi(key); e == nil {
+			result.Results[int32(id)] = string(content)
+			continue
+		}
+		if strings.ToLower(ext) == ".json" {
+			result.Uris[key] = string(content)
+			continue
+		}
+		texts = append(texts, string(content))
+	}
+	result.Text = strings.Join(texts, "\n")
+	if result.Empty() {
+		return nil, fmt.Errorf("离线配置内容为空")
+	}
+	return result, nil
+}
+
+// LoadOfflineConfig 从本地路径加载离线配置，路径为文件时视为完整配置，为目录时读取目录下的所有文件
+func LoadOfflineConfig(path string) (*OfflineConfig, error) {
+	info, e := os.Stat(path)
+	if e != nil {
+		return nil, fmt.Errorf("读取离线配置失败, err: %w", e)
+	}
+	files := make(map[string][]byte)
+	if !info.IsDir() {
+		content, e := os.ReadFile(path)
+		if e != nil {
+			return nil, fmt.Errorf("读取离线配置失败, err: %w", e)
+		}
+		files[info.Name()] = content
+		return NewOfflineConfig(files)
+	}
+	entries, e := os.ReadDir(path)
+	if e != nil {
+		return nil, fmt.Errorf("读取离线配置目录失败, err: %w", e)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, e := os.ReadFile(filepath.Join(path, entry.Name()))
+		if e != nil {
+			return nil, fmt.Errorf("读取离线配置失败, file: %s, err: %w", entry.Name(), e)
+		}
+		files[entry.Name()] = content
+	}
+	return NewOfflineConfig(files)
+}
+
+// NewOfflineConfigFromFiles 根据上传的文件组装离线配置
+func NewOfflineConfigFromFiles(headers []*multipart.FileHeader) (*OfflineConfig, error) {
+	files := make(map[string][]byte)
+	for _, header := range headers {
+		f, e := header.Open()
+		if e != nil {
+			return nil, fmt.Errorf("读取上传文件失败, file: %s, err: %w", header.Filename, e)
+		}
+		content, e := io.ReadAll(f)
+		_ = f.Close()
+		if e != nil {
+			return nil, fmt.Errorf("读取上传文件失败, file: %s, err: %w", header.Filename, e)
+		}
+		files[header.Filename] = content
+	}
+	return NewOfflineConfig(files)
+}
+
+func (o *OfflineConfig) Empty() bool {
+	return o.Text == "" && len(o.Results) == 0 && len(o.Uris) == 0
+}
+
+// 获取命令对应的输出，未单独提供时返回完整配置
+func (o *OfflineConfig) result(id int32) string {
+	if text, ok := o.Results[id]; ok {
+		return normalizeOfflineText(text)
+	}
+	return normalizeOfflineText(o.Text)
+}
+
+// 获取F5接口对应的json
+func (o *OfflineConfig) uri(uri string) (string, error) {
+	key := strings.ReplaceAll(strings.Trim(strings.TrimPrefix(uri, "/mgmt/tm/ltm/"), "/"), "/", "_")
+	if text, ok := o.Uris[key]; ok {
+		return text, nil
+	}
+	return "", fmt.Errorf("离线配置缺少接口数据, uri: %s, key: %s", uri, key)
+}
+
+// 解析器按\r拆分行，统一换行符与设备返回保持一致
+func normalizeOfflineText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\n", "\r\n")
+}
@@ -0,0 +1,304 @@
+package device
+
+import (
+	"fmt"
+	"math/big"
+	"netops/database"
+	"netops/model"
+	"netops/utils"
+	"strings"
+	"time"
+)
+
+const (
+	RiskStatusOpen     = "open"
+	RiskStatusAcked    = "acked"
+	RiskStatusExcepted = "excepted"
+	RiskStatusResolved = "resolved"
+)
+
+// EvaluateRisk 使用启用的风险规则检查设备所有策略，更新风险结果，返回未处理的风险数
+func EvaluateRisk(deviceId int) (int, error) {
+	rules, e := new(model.TRiskRule).FindEnabled()
+	if e != nil {
+		return 0, e
+	}
+	vendor, e := getDeviceVendor(deviceId)
+	if e != nil {
+		return 0, e
+	}
+	policies := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Order("line, id").Find(&policies).Error; e != nil {
+		return 0, fmt.Errorf("获取设备策略失败, device_id: %d, err: %w", deviceId, e)
+	}
+	ports := make([]*model.TDevicePort, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&ports).Error; e != nil {
+		return 0, fmt.Errorf("获取设备端口失败, device_id: %d, err: %w", deviceId, e)
+	}
+	portM := devicePortMap(ports)
+	netTypes, e := getNetTypeSpans()
+	if e != nil {
+		return 0, e
+	}
+	exceptions, e := new(model.TRiskException).FindActive()
+	if e != nil {
+		return 0, e
+	}
+	// 本次检查出的风险，key为规则+策略+内容
+	currents, keys := make(map[string]*model.TRiskFinding), make([]string, 0)
+	for _, p := range policies {
+		// 未生效的策略不会放行流量，不检查风险
+		if policyInactive(vendor, p) {
+			continue
+		}
+		r, ok := newAnalyzeRule(p, portM)
+		if !ok {
+			continue
+		}
+		fingerprint := utils.HashString(policyChangeOption.fingerprint(p))
+		for _, rule := range rules {
+			details, ok := matchRiskRule(rule, r, netTypes)
+			if !ok {
+				continue
+			}
+			f := &model.TRiskFinding{
+				DeviceId:    deviceId,
+				RuleId:      rule.Id,
+				PolicyId:    p.Id,
+				PolicyName:  p.Name,
+				Direction:   p.Direction,
+				Line:        p.Line,
+				Fingerprint: fingerprint,
+				Severity:    rule.Severity,
+				Detail:      strings.Join(details, "; "),
+			}
+			k := riskFindingKey(f)
+			if _, ok := currents[k]; ok {
+				continue
+			}
+			currents[k] = f
+			keys = append(keys, k)
+		}
+	}
+	olds := make([]*model.TRiskFinding, 0)
+	if e := database.DB.Where("device_id = ? and status != ?", deviceId, RiskStatusResolved).Find(&olds).Error; e != nil {
+		return 0, fmt.Errorf("获取设备风险结果失败, device_id: %d, err: %w", deviceId, e)
+	}
+	now := time.Now()
+	tx := database.DB.Begin()
+	for _, old := range olds {
+		k := riskFindingKey(old)
+		current, ok := currents[k]
+		if !ok {
+			// 策略已删除、已禁用或内容已变更
+			old.Status = RiskStatusResolved
+			old.ResolvedAt = &now
+			if e := tx.Save(old).Error; e != nil {
+				tx.Rollback()
+				return 0, fmt.Errorf("更新风险结果失败, err: %w", e)
+			}
+			continue
+		}
+		delete(currents, k)
+		old.PolicyId, old.Line, old.Severity, old.Detail = current.PolicyId, current.Line, current.Severity, current.Detail
+		setRiskStatus(old, exceptions)
+		if e := tx.Save(old).Error; e != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("更新风险结果失败, err: %w", e)
+		}
+	}
+	news := make([]*model.TRiskFinding, 0)
+	for _, k := range keys {
+		if f, ok := currents[k]; ok {
+			setRiskStatus(f, exceptions)
+			news = append(news, f)
+		}
+	}
+	for i := 0; i*100 < len(news); i++ {
+		r := (i + 1) * 100
+		if r > len(news) {
+			r = len(news)
+		}
+		items := news[i*100 : r]
+		if e := tx.Create(&items).Error; e != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("保存风险结果失败, err: %w", e)
+		}
+	}
+	if e := tx.Commit().Error; e != nil {
+		return 0, fmt.Errorf("保存风险结果commit失败, err: %w", e)
+	}
+	var count int64
+	if e := database.DB.Model(&model.TRiskFinding{}).Where("device_id = ? and status = ?", deviceId, RiskStatusOpen).Count(&count).Error; e != nil {
+		return 0, fmt.Errorf("获取设备风险数量失败, device_id: %d, err: %w", deviceId, e)
+	}
+	return int(count), nil
+}
+
+// RefreshRiskExceptions 修改例外后重新计算所有未解决风险的状态
+func RefreshRiskExceptions() error {
+	exceptions, e := new(model.TRiskException).FindActive()
+	if e != nil {
+		return e
+	}
+	findings := make([]*model.TRiskFinding, 0)
+	if e := database.DB.Where("status != ?", RiskStatusResolved).Find(&findings).Error; e != nil {
+		return fmt.Errorf("获取风险结果失败, err: %w", e)
+	}
+	for _, v := range findings {
+		status, exceptionId := v.Status, v.ExceptionId
+		setRiskStatus(v, exceptions)
+		if v.Status == status && v.ExceptionId == exceptionId {
+			continue
+		}
+		if e := database.DB.Model(v).Select("status", "exception_id").Updates(v).Error; e != nil {
+			return fmt.Errorf("更新风险结果状态失败, id: %d, err: %w", v.Id, e)
+		}
+	}
+	return nil
+}
+
+// AckRisk 确认风险
+func AckRisk(ids []int, user, comment string) error {
+	now := time.Now()
+	if e := database.DB.Model(&model.TRiskFinding{}).Where("id in ? and status = ?", ids, RiskStatusOpen).
+		Updates(map[string]any{"status": RiskStatusAcked, "acked_by": user, "acked_at": now, "ack_comment": comment}).Error; e != nil {
+		return fmt.Errorf("确认风险失败, err: %w", e)
+	}
+	return nil
+}
+
+func riskFindingKey(f *model.TRiskFinding) string {
+	return fmt.Sprintf("%d|%s|%s|%s", f.RuleId, f.PolicyName, f.Direction, f.Fingerprint)
+}
+
+// 根据例外和确认信息设置状态
+func setRiskStatus(f *model.TRiskFinding, exceptions []*model.TRiskException) {
+	f.ExceptionId = 0
+	for _, v := range exceptions {
+		if v.Match(f) {
+			f.ExceptionId = v.Id
+			break
+		}
+	}
+	switch {
+	case f.ExceptionId > 0:
+		f.Status = RiskStatusExcepted
+	case f.AckedBy != "":
+		f.Status = RiskStatusAcked
+	default:
+		f.Status = RiskStatusOpen
+	}
+}
+
+// 检查策略是否命中规则，返回命中的条件
+func matchRiskRule(rule *model.TRiskRule, r *analyzeRule, netTypes map[string][]span[[16]byte]) ([]string, bool) {
+	p := r.policy
+	if rule.Action != "" && rule.Action != p.Action {
+		return nil, false
+	}
+	if rule.Direction != "" && rule.Direction != p.Direction {
+		return nil, false
+	}
+	details := make([]string, 0)
+	if rule.SrcPrefix != nil {
+		prefix := minPrefix(r.src)
+		if prefix > *rule.SrcPrefix {
+			return nil, false
+		}
+		details = append(details, fmt.Sprintf("源地址范围/%d", prefix))
+	}
+	if rule.DstPrefix != nil {
+		prefix := minPrefix(r.dst)
+		if prefix > *rule.DstPrefix {
+			return nil, false
+		}
+		details = append(details, fmt.Sprintf("目标地址范围/%d", prefix))
+	}
+	if rule.SrcNetType != "" {
+		netType, ok := matchNetType(rule.SrcNetType, r.src, netTypes)
+		if !ok {
+			return nil, false
+		}
+		details = append(details, fmt.Sprintf("源地址包含%s网段", netType))
+	}
+	if rule.DstNetType != "" {
+		netType, ok := matchNetType(rule.DstNetType, r.dst, netTypes)
+		if !ok {
+			return nil, false
+		}
+		details = append(details, fmt.Sprintf("目标地址包含%s网段", netType))
+	}
+	if rule.Ports != "" {
+		ports, ok := parsePortSpans(rule.Ports)
+		if !ok || !spansIntersect(ports, r.ports, compareInt) {
+			return nil, false
+		}
+		details = append(details, fmt.Sprintf("端口包含%s", rule.Ports))
+	}
+	if rule.PortCount > 0 {
+		count := 0
+		for _, v := range r.ports {
+			count += v.end - v.start + 1
+		}
+		if count < rule.PortCount {
+			return nil, false
+		}
+		details = append(details, fmt.Sprintf("端口数量%d", count))
+	}
+	return details, true
+}
+
+func matchNetType(text string, spans []span[[16]byte], netTypes map[string][]span[[16]byte]) (string, bool) {
+	for _, v := range strings.Split(text, ",") {
+		v = strings.TrimSpace(v)
+		if s, ok := netTypes[v]; ok && spansIntersect(s, spans, compareIP) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// 按网络类型获取网段区间
+func getNetTypeSpans() (map[string][]span[[16]byte], error) {
+	subnets := make([]*model.TSubnet, 0)
+	if e := database.DB.Find(&subnets).Error; e != nil {
+		return nil, fmt.Errorf("获取网段信息失败, err: %w", e)
+	}
+	items := make(map[string][]span[[16]byte])
+	for _, v := range subnets {
+		s, ok := parseAddressSpan(strings.TrimSpace(v.Subnet))
+		if !ok {
+			continue
+		}
+		items[v.NetType] = append(items[v.NetType], s)
+	}
+	results := make(map[string][]span[[16]byte])
+	for k, v := range items {
+		results[k] = mergeSpans(v, compareIP, nextIP)
+	}
+	return results, nil
+}
+
+// 地址区间中最大的范围对应的掩码长度，如any为0，10.0.0.0/8为8
+func minPrefix(spans []span[[16]byte]) int {
+	result := 128
+	for _, v := range spans {
+		bits, start, end := 128, v.start[:], v.end[:]
+		if isIPv4Span(v) {
+			bits, start, end = 32, v.start[12:], v.end[12:]
+		}
+		size := new(big.Int).Sub(new(big.Int).SetBytes(end), new(big.Int).SetBytes(start))
+		size.Add(size, big.NewInt(1))
+		if prefix := bits - (size.BitLen() - 1); prefix < result {
+			result = prefix
+		}
+	}
+	return result
+}
+
+var ipv4Prefix = [12]byte{10: 0xff, 11: 0xff}
+
+func isIPv4Span(v span[[16]byte]) bool {
+	return [12]byte(v.start[:12]) == ipv4Prefix && [12]byte(v.end[:12]) == ipv4Prefix
+}
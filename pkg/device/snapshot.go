@@ -0,0 +1,255 @@
+package device
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotDiff 两次快照的差异
+type SnapshotDiff struct {
+	ObjectType string `json:"object_type"`
+	ObjectKey  string `json:"object_key"`
+	ChangeType string `json:"change_type"`
+	Old        string `json:"old"`
+	New        string `json:"new"`
+}
+
+// 默认保留最近30天的全部快照，更早的快照每月保留最后一个，共保留12个月
+const (
+	defaultSnapshotKeepDays = 30
+	defaultSnapshotMonthly  = 12
+)
+
+var snapshotItemOption = &changeOption[*model.TDeviceSnapshotItem]{
+	key: func(v *model.TDeviceSnapshotItem) string {
+		return fmt.Sprintf("%s|%s", v.ObjectType, v.ObjectKey)
+	},
+	fingerprint: func(v *model.TDeviceSnapshotItem) string {
+		return v.Content
+	},
+}
+
+// 保存当前设备的策略快照
+func (b *base) saveSnapshot() error {
+	items := make([]*model.TDeviceSnapshotItem, 0)
+	snapshot := &model.TDeviceSnapshot{DeviceId: b.device.Id}
+
+	policies := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", b.device.Id).Order("id").Find(&policies).Error; e != nil {
+		return fmt.Errorf("获取设备策略失败, err: %w", e)
+	}
+	for _, v := range policies {
+		items = append(items, &model.TDeviceSnapshotItem{ObjectType: "policy", ObjectKey: policyChangeOption.key(v), Content: normalizePolicy(v)})
+	}
+	snapshot.PolicyCount = len(policies)
+
+	groups := make([]*model.TDeviceAddressGroup, 0)
+	if e := database.DB.Where("device_id = ?", b.device.Id).Order("id").Find(&groups).Error; e != nil {
+		return fmt.Errorf("获取设备地址组失败, err: %w", e)
+	}
+	groupM, groupKeys := make(map[string][]string), make([]string, 0)
+	for _, v := range groups {
+		k := groupChangeOption.key(v)
+		if _, ok := groupM[k]; !ok {
+			groupKeys = append(groupKeys, k)
+		}
+		groupM[k] = append(groupM[k], v.Address)
+	}
+	for _, k := range groupKeys {
+		items = append(items, &model.TDeviceSnapshotItem{ObjectType: "group", ObjectKey: k, Content: normalizeList(strings.Join(groupM[k], ","))})
+	}
+	snapshot.GroupCount = len(groupKeys)
+
+	ports := make([]*model.TDevicePort, 0)
+	if e := database.DB.Where("device_id = ?", b.device.Id).Order("id").Find(&ports).Error; e != nil {
+		return fmt.Errorf("获取设备端口失败, err: %w", e)
+	}
+	portM, portKeys := make(map[string][]string), make([]string, 0)
+	for _, v := range ports {
+		k := portChangeOption.key(v)
+		if _, ok := portM[k]; !ok {
+			portKeys = append(portKeys, k)
+		}
+		portM[k] = append(portM[k], portChangeOption.fingerprint(v))
+	}
+	for _, k := range portKeys {
+		items = append(items, &model.TDeviceSnapshotItem{ObjectType: "port", ObjectKey: k, Content: normalizeList(strings.Join(portM[k], ","))})
+	}
+	snapshot.PortCount = len(portKeys)
+
+	nats := make([]*model.TDeviceNat, 0)
+	if e := database.DB.Where("device_id = ?", b.device.Id).Order("id").Find(&nats).Error; e != nil {
+		return fmt.Errorf("获取设备nat失败, err: %w", e)
+	}
+	for _, v := range nats {
+		items = append(items, &model.TDeviceSnapshotItem{ObjectType: "nat", ObjectKey: natChangeOption.key(v), Content: normalizeNat(v)})
+	}
+	srxNats := make([]*model.TDeviceSrxNat, 0)
+	if e := database.DB.Where("device_id = ?", b.device.Id).Order("id").Find(&srxNats).Error; e != nil {
+		return fmt.Errorf("获取设备srx nat失败, err: %w", e)
+	}
+	for _, v := range srxNats {
+		items = append(items, &model.TDeviceSnapshotItem{ObjectType: "nat", ObjectKey: fmt.Sprintf("%s|%s|%s", v.NatType, v.Direction, v.Rule), Content: normalizeSrxNat(v)})
+	}
+	snapshot.NatCount = len(nats) + len(srxNats)
+
+	tx := database.DB.Begin()
+	if e := tx.Create(snapshot).Error; e != nil {
+		tx.Rollback()
+		return fmt.Errorf("保存策略快照失败, err: %w", e)
+	}
+	for _, v := range items {
+		v.SnapshotId = snapshot.Id
+	}
+	for i := 0; i*100 < len(items); i++ {
+		r := (i + 1) * 100
+		if r > len(items) {
+			r = len(items)
+		}
+		bulks := items[i*100 : r]
+		if e := tx.Create(&bulks).Error; e != nil {
+			tx.Rollback()
+			return fmt.Errorf("保存策略快照内容失败, err: %w", e)
+		}
+	}
+	if e := tx.Commit().Error; e != nil {
+		return fmt.Errorf("保存策略快照commit失败, err: %w", e)
+	}
+	b.addLog("保存策略快照, 快照ID: %d, 策略%d, 地址组%d, 端口%d, nat%d", snapshot.Id, snapshot.PolicyCount, snapshot.GroupCount, snapshot.PortCount, snapshot.NatCount)
+	keepDays, monthly := defaultSnapshotKeepDays, defaultSnapshotMonthly
+	if conf.Config != nil {
+		if conf.Config.Snapshot.KeepDays > 0 {
+			keepDays = conf.Config.Snapshot.KeepDays
+		}
+		if conf.Config.Snapshot.Monthly > 0 {
+			monthly = conf.Config.Snapshot.Monthly
+		}
+	}
+	// 快照已保存成功，清理失败只记录日志，不影响解析结果
+	count, e := PruneSnapshots(b.device.Id, keepDays, monthly)
+	if e != nil {
+		b.addLog("清理过期策略快照失败, err: %s", e)
+	} else if count > 0 {
+		b.addLog("清理过期策略快照%d个, 保留最近%d天及%d个月的月末快照", count, keepDays, monthly)
+	}
+	return nil
+}
+
+// PruneSnapshots 保留设备最近keepDays天的全部快照，更早的快照每月只保留最后一个，最多保留monthly个月，返回删除的快照数
+func PruneSnapshots(deviceId, keepDays, monthly int) (int, error) {
+	snapshots := make([]*model.TDeviceSnapshot, 0)
+	if e := database.DB.Select("id", "created_at").Where("device_id = ?", deviceId).Order("created_at desc, id desc").Find(&snapshots).Error; e != nil {
+		return 0, fmt.Errorf("获取设备策略快照失败, err: %w", e)
+	}
+	if len(snapshots) == 0 {
+		return 0, nil
+	}
+	deadline := time.Now().AddDate(0, 0, -keepDays)
+	months := make(map[string]bool)
+	expired := make([]int, 0)
+	// 最新的快照始终保留，作为下次对比的基准
+	for i, v := range snapshots {
+		if i == 0 || v.CreatedAt.After(deadline) {
+			months[v.CreatedAt.Format("2006-01")] = true
+			continue
+		}
+		month := v.CreatedAt.Format("2006-01")
+		if !months[month] && len(months) < monthly {
+			months[month] = true
+			continue
+		}
+		expired = append(expired, v.Id)
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	tx := database.DB.Begin()
+	if e := tx.Where("snapshot_id in ?", expired).Delete(&model.TDeviceSnapshotItem{}).Error; e != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("清理策略快照内容失败, err: %w", e)
+	}
+	if e := tx.Delete(&model.TDeviceSnapshot{}, expired).Error; e != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("清理策略快照失败, err: %w", e)
+	}
+	if e := tx.Commit().Error; e != nil {
+		return 0, fmt.Errorf("清理策略快照commit失败, err: %w", e)
+	}
+	return len(expired), nil
+}
+
+// DiffSnapshot 对比同一设备的两个快照，返回新增、删除、修改的内容
+func DiffSnapshot(oldId, newId int) ([]*SnapshotDiff, error) {
+	oldSnapshot, newSnapshot := model.TDeviceSnapshot{}, model.TDeviceSnapshot{}
+	if e := oldSnapshot.FirstById(oldId); e != nil {
+		return nil, e
+	}
+	if e := newSnapshot.FirstById(newId); e != nil {
+		return nil, e
+	}
+	if oldSnapshot.DeviceId != newSnapshot.DeviceId {
+		return nil, fmt.Errorf("只能对比同一设备的快照, old: %s, new: %s", oldSnapshot.Device, newSnapshot.Device)
+	}
+	olds, e := new(model.TDeviceSnapshotItem).FindBySnapshotId(oldId)
+	if e != nil {
+		return nil, e
+	}
+	news, e := new(model.TDeviceSnapshotItem).FindBySnapshotId(newId)
+	if e != nil {
+		return nil, e
+	}
+	cs := diffRecords(olds, news, snapshotItemOption)
+	results := make([]*SnapshotDiff, 0)
+	for _, v := range cs.added {
+		results = append(results, &SnapshotDiff{ObjectType: v.ObjectType, ObjectKey: v.ObjectKey, ChangeType: ChangeTypeAdded, New: v.Content})
+	}
+	for _, v := range cs.removed {
+		results = append(results, &SnapshotDiff{ObjectType: v.ObjectType, ObjectKey: v.ObjectKey, ChangeType: ChangeTypeRemoved, Old: v.Content})
+	}
+	for _, v := range cs.modified {
+		results = append(results, &SnapshotDiff{ObjectType: v[1].ObjectType, ObjectKey: v[1].ObjectKey, ChangeType: ChangeTypeModified, Old: v[0].Content, New: v[1].Content})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].ObjectType != results[j].ObjectType {
+			return results[i].ObjectType < results[j].ObjectType
+		}
+		return results[i].ObjectKey < results[j].ObjectKey
+	})
+	return results, nil
+}
+
+// 标准化策略内容，地址和端口排序后比较，避免顺序不同被识别为变更
+func normalizePolicy(v *model.TDevicePolicy) string {
+	return fmt.Sprintf("action=%s protocol=%s src_zone=%s dst_zone=%s src=%s src_group=%s dst=%s dst_group=%s port=%s port_group=%s",
+		v.Action, v.Protocol, v.SrcZone, v.DstZone, normalizeList(v.Src), v.SrcGroup, normalizeList(v.Dst), v.DstGroup, normalizeList(v.Port), v.PortGroup)
+}
+
+func normalizeNat(v *model.TDeviceNat) string {
+	return fmt.Sprintf("network=%s network_port=%s static=%s static_group=%s static_port=%s protocol=%s destination=%s destination_group=%s",
+		v.Network, v.NetworkPort, v.Static, v.StaticGroup, v.StaticPort, v.Protocol, normalizeList(v.Destination), v.DestinationGroup)
+}
+
+func normalizeSrxNat(v *model.TDeviceSrxNat) string {
+	return fmt.Sprintf("src=%s dst=%s dst_port=%s protocol=%s pool=%s", normalizeList(v.Src), normalizeList(v.Dst), v.DstPort, v.Protocol, v.Pool)
+}
+
+// 逗号分隔的列表去重排序
+func normalizeList(text string) string {
+	items := make([]string, 0)
+	exists := make(map[string]bool)
+	for _, v := range strings.Split(text, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || exists[v] {
+			continue
+		}
+		exists[v] = true
+		items = append(items, v)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
@@ -10,7 +10,6 @@ import (
 	netApi2 "netops/grpc_client/protobuf/net_api"
 	"netops/model"
 	"netops/utils"
-	"os"
 	"strings"
 )
 
@@ -42,90 +41,28 @@ func (s *SrxHandler) init() {
 // ParseConfig 获取并解析配置
 func (s *SrxHandler) ParseConfig() {
 	s.addLog("<-------开始解析设备策略------->")
+	if e := s.selectActive(); e != nil {
+		s.operateLog.Status = "failed"
+		s.addLog(e.Error())
+		_ = s.device.UpdateParseStatus(ParseStatusFailed)
+		return
+	}
+	if s.host != "" {
+		s.addLog("HA主设备: %s", s.host)
+	}
 	if e := s.parse(); e != nil {
 		s.operateLog.Status = "failed"
 		s.addLog(e.Error())
 		_ = s.device.UpdateParseStatus(ParseStatusFailed)
 		return
 	}
-	_ = s.device.UpdateParseStatus(ParseStatusSuccess)
-	s.addLog("<-------解析策略完成------->")
+	s.parseSuccess()
 }
 func (s *SrxHandler) search(info *model.TTaskInfo) (*model.TDevicePolicy, error) {
 	l := zap.L().With(zap.String("func", "Search"), zap.Int("info_id", info.Id))
 	l.Debug("策略查询--->", zap.Any("device", s.device), zap.Any("info", info))
-	var (
-		result    *model.TDevicePolicy
-		db        *gorm.DB
-		portNames = []string{"any"}
-		err       error
-	)
-	l.Debug("1. 根据源目地址模糊匹配符合条件的策略---------->")
-	db = database.DB.Where("device_id = ? and dst like ? and direction = ? and valid = ?",
-		s.DeviceId, "%"+info.Dst+"%", info.Direction, true)
-	// 如果是办公网，直接对组名
-	if info.Direction == "inside" && (info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6) {
-		db = db.Where("src_group = ?", info.Src)
-	} else {
-		// 正常逻辑校验规则，源地址包含，目标地址包含，协议相同，方向相同，并且已开通的
-		db = db.Where("src like ?", "%"+info.Src+"%")
-	}
-
-	if info.Protocol != "ip" {
-		l.Debug("根据端口和协议获取端口所在的组--------->")
-		if portNames, err = s.getPortNames(info.DPort, info.Protocol); err != nil {
-			return nil, err
-		}
-		l.Debug("根据port和port_names过滤", zap.String("port", info.DPort), zap.Any("port_names", portNames))
-		db = db.Where("port = ? or port = ? or port_group in ?", "any", info.DPort, portNames)
-	}
-	policies := make([]*model.TDevicePolicy, 0)
-	if e1 := db.Find(&policies).Error; e1 != nil {
-		return nil, fmt.Errorf("查询策略表异常: <%s>", e1.Error())
-	}
-	if len(policies) > 0 {
-		l.Debug("匹配到策略信息------------------>")
-		result = policies[0]
-		// 如果匹配到的第一条是deny, 说明未开通
-		if result.Action == "deny" {
-			return nil, nil
-		}
-		l.Debug("匹配到的策略--->", zap.Any("result", result))
-		return result, nil
-	} else {
-		l.Debug("2. 根据基本信息未匹配到相应的策略，开始进行网段的匹配------->")
-		// 如果没有匹配的策略，则获取所有地址组，根据地址组来查询
-		// 先获取源地址为网段的策略信息
-		l.Debug("先根据基本条件进行过滤------------>")
-		subnetPolicies := make([]*model.TDevicePolicy, 0)
-		db = database.DB.Where("device_id = ? and direction = ? and valid = ?", s.DeviceId, info.Direction, true)
-		if info.Protocol != "ip" {
-			// 匹配端口等于目标端口，或者端口是any，或者策略在端口存在的组
-			db = db.Where("port = ? or port = ? or port_group in ?", "any", info.DPort, portNames)
-		}
-		if e1 := db.Find(&subnetPolicies).Error; e1 != nil {
-			return nil, fmt.Errorf("查询策略地址组异常, err: %w", e1)
-		}
-		// 根据源目地址找到符合条件的策略
-		l.Info("3. 根据源目地址从策略表中匹配策略--------->")
-		policies = s.getSubnetPolicy(subnetPolicies, info.Src, info.Dst)
-		if len(policies) > 0 {
-			if info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6 {
-				result = policies[0]
-			} else {
-				// 匹配出最小的策略
-				l.Debug("根据匹配到的网段策略, 获取范围最小的策略信息-------->")
-				result = s.getPolicy(policies, info.Src, info.Dst)
-				l.Debug("匹配到的策略--->", zap.Any("result", result))
-			}
-			if result.Action == "deny" {
-				return nil, nil
-			}
-			return result, nil
-		}
-	}
-	l.Debug("<-------策略查询结束------->")
-	return nil, nil
+	// 按行号顺序匹配第一条策略，如果匹配到的第一条是deny, 说明未开通
+	return s.searchPolicy(info)
 }
 func (s *SrxHandler) Search(info *model.TTaskInfo) (*model.TDevicePolicy, error) {
 	if s.error != nil {
@@ -182,16 +119,11 @@ func (s *SrxHandler) genePortCmd(info *model.TTaskInfo) (portNames []string, por
 }
 
 // 生成策略命令
-func (s *SrxHandler) genePolicyCmd(direction, name, denyPolicyName string, srcGroups, dstGroups, portNames []string) string {
-	var zones string
-	switch direction {
-	case "inside":
-		zones = fmt.Sprintf("from-zone %s to-zone %s", s.device.OutPolicy, s.device.InPolicy)
-	case "outside":
-		zones = fmt.Sprintf("from-zone %s to-zone %s", s.device.InPolicy, s.device.OutPolicy)
-	default:
+func (s *SrxHandler) genePolicyCmd(fromZone, toZone, name, denyPolicyName string, srcGroups, dstGroups, portNames []string) string {
+	if fromZone == "" || toZone == "" {
 		s.error = fmt.Errorf("未知的策略方向")
 	}
+	zones := fmt.Sprintf("from-zone %s to-zone %s", fromZone, toZone)
 	policyCmd := ""
 	for _, v := range srcGroups {
 		policyCmd += fmt.Sprintf("set security policies %s policy %s match source-address %s\n", zones, name, v)
@@ -287,6 +219,7 @@ func (s *SrxHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 	l.Info("<------------------------生成策略命令------------------------>")
 	l.Info(fmt.Sprintf("info: <%+v>", *info))
 	l.Info("1. 获取当前开通策略关联设备的出入向策略名---------->")
+	fromZone, toZone := s.zonePair(info)
 	var (
 		denyPolicyName = s.getInfoDenyPolicyName(info)
 		name           = s.groupName(jiraKey, info)
@@ -297,6 +230,10 @@ func (s *SrxHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 		portNames      = make([]string, 0)
 		commands       = make([]string, 0)
 	)
+	// 非默认区域对没有对应的拒绝策略，直接追加策略
+	if !s.isDefaultZonePair(info.Direction, fromZone, toZone) {
+		denyPolicyName = ""
+	}
 	l.Info("2. 生成源地址组策略命令---------------------->")
 	// 如果办公网，地址组直接设置为办公网
 	if info.Src == conf.BanGongWang || info.Src == conf.BanGongWangV6 {
@@ -306,12 +243,8 @@ func (s *SrxHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 			if group := s.getAddressGroup(v); group != nil {
 				srcGroups = append(srcGroups, group.Name)
 			} else {
-				// 如果是入向，则源地址的zone使用outPolicy  untrust
-				if info.Direction == "inside" {
-					addressCmd += s.geneAddressCmd(s.device.OutPolicy, v, v)
-				} else { // 否则使用inPolicy  trust
-					addressCmd += s.geneAddressCmd(s.device.InPolicy, v, v)
-				}
+				// 源地址的zone使用from-zone
+				addressCmd += s.geneAddressCmd(fromZone, v, v)
 				srcGroups = append(srcGroups, v)
 			}
 		}
@@ -323,13 +256,8 @@ func (s *SrxHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 		if group != nil {
 			dstGroups = append(dstGroups, group.Name)
 		} else {
-			// 如果是入向，则目标地址的zone使用inPolicy  trust
-			if info.Direction == "inside" {
-				addressCmd += s.geneAddressCmd(s.device.InPolicy, v, v)
-			} else { // 否则使用outPolicy  untrust
-				addressCmd += s.geneAddressCmd(s.device.OutPolicy, v, v)
-			}
-
+			// 目标地址的zone使用to-zone
+			addressCmd += s.geneAddressCmd(toZone, v, v)
 			dstGroups = append(dstGroups, v)
 		}
 	}
@@ -339,7 +267,7 @@ func (s *SrxHandler) GeneCommand(jiraKey string, info *model.TTaskInfo) (string,
 		commands = append(commands, portCmd)
 	}
 	l.Info("5. 生成策略命令----------------------------->")
-	policyCmd := s.genePolicyCmd(info.Direction, name, denyPolicyName, srcGroups, dstGroups, portNames)
+	policyCmd := s.genePolicyCmd(fromZone, toZone, name, denyPolicyName, srcGroups, dstGroups, portNames)
 	commands = append(commands, policyCmd)
 
 	// 如果是出向访问并且出向网络类型不为空，则生成nat地址转换策略
@@ -363,28 +291,6 @@ func (s *SrxHandler) parseAddressLine(line string) (direction, name, address str
 	return
 }
 
-// 获取组名
-func (s *SrxHandler) getPortNames(port, protocol string) (results []string, err error) {
-	p, err := utils.ParseRangePort(port)
-	if err != nil {
-		return
-	}
-	if p.Start > 0 || p.End < 65535 {
-		ports := make([]model.TDevicePort, 0)
-		db := database.DB.Where("device_id = ? and protocol like ? and start <= ? and end >= ?", s.DeviceId, "%"+protocol+"%",
-			p.Start, p.End).Find(&ports)
-		if db.Error != nil {
-			return nil, fmt.Errorf("根据port<%s>获取端口组异常: <%s>", port, db.Error.Error())
-		}
-		results = make([]string, 0)
-		for _, p := range ports {
-			results = append(results, p.Name)
-		}
-	}
-	results = append(results, "any")
-	return results, nil
-}
-
 func (s *SrxHandler) CheckNat(info *model.TTaskInfo) (err error) {
 	return
 }
@@ -482,25 +388,6 @@ func (s *srxParse) getConfig() error {
 	}
 	return nil
 }
-func (s *srxParse) getConfig1() {
-	fmt.Println("获取设备策略-------------->")
-	fb, err := os.ReadFile("C:\\Users\\34607\\.wind\\profiles\\default.v10\\terminal\\logs\\南京\\南京SRX.log")
-	if err != nil {
-		s.error = err
-		return
-	}
-	//newTexts := make([]string, 0)
-	//for _, line := range strings.Split(string(fb), "\r") {
-	//	newTexts = append(newTexts, strings.Split(line, "]")[1])
-	//}
-
-	s.policyText = string(fb)
-	s.addressText = s.policyText
-	s.addressSetText = s.policyText
-	s.portText = s.policyText
-	s.natRuleSetText = s.policyText
-	s.natPoolText = s.policyText
-}
 
 type srxAddressSet struct {
 	name  string
@@ -766,6 +653,8 @@ func (s *srxParse) savePolicies(policies []*srxPolicy, addresses []*srxAddress,
 				DstGroup:  strings.Join(v.destinationAddresses, ","),
 				Command:   strings.Join(v.commands, "\n"),
 				Direction: direction,
+				SrcZone:   v.fromZone,
+				DstZone:   v.toZone,
 				Line:      v.line,
 				Valid:     valid,
 			}
@@ -889,18 +778,6 @@ func (s *srxParse) parseBlacklistGroupAddress(addressSets []*srxAddressSet) {
 	}
 }
 
-// 根据from-zone和to-zone区分出方向
-func (s *srxParse) parseDirection(fromZone, toZone string) string {
-	// 解析方向 如果 from-zone in to-zone out则是出向， from-zone out to-zone in 则是入向
-	switch {
-	case fromZone == s.device.InPolicy && toZone == s.device.OutPolicy:
-		return "outside"
-	case fromZone == s.device.OutPolicy && toZone == s.device.InPolicy:
-		return "inside"
-	}
-	return fmt.Sprintf("%s-%s", fromZone, toZone)
-}
-
 // 地址地址名或地址组中取出地址信息
 func getAddress(zone, addr string, addressM map[string]map[string][]string, addressSetM map[string]map[string][]string) string {
 	// 先从地址组中获取
@@ -1229,33 +1106,6 @@ func (s *srxParse) changeProtocol(protocol string) string {
 	return protocol
 }
 
-// 保存解析好的nat pool信息
-func (s *srxParse) saveNatPool(data []*model.TDeviceNatPool) error {
-	if data == nil || len(data) == 0 {
-		return nil
-	}
-	tx := database.DB.Begin()
-	if e := tx.Delete(&model.TDeviceNatPool{}, "device_id = ?", s.device.Id).Error; e != nil {
-		tx.Rollback()
-		return fmt.Errorf("清除nat pool信息失败, err: %w", e)
-	}
-	for i := 0; i*100 < len(data); i++ {
-		r := (i + 1) * 100
-		if (i+1)*100 > len(data) {
-			r = len(data)
-		}
-		groups := data[i*100 : r]
-		if err := tx.Create(&groups).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("保存设备nat pool信息异常: <%s>", err.Error())
-		}
-	}
-	if e := tx.Commit().Error; e != nil {
-		return fmt.Errorf("保存nat pool信息异常: <%w>", e)
-	}
-	return nil
-}
-
 // 保存解析好的nat pool信息
 func (s *srxParse) saveNatRuleSet(data []*model.TDeviceSrxNat) error {
 	if data == nil || len(data) == 0 {
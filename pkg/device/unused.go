@@ -0,0 +1,309 @@
+package device
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"sort"
+	"strings"
+)
+
+const (
+	UnusedObjectAddress = "address"
+	UnusedObjectPort    = "port"
+)
+
+// UnusedObject 未被策略和nat引用的地址组或端口
+type UnusedObject struct {
+	ObjectType  string `json:"object_type"` // address port
+	Name        string `json:"name"`
+	Zone        string `json:"zone"`
+	AddressType string `json:"address_type"`
+	Content     string `json:"content"`
+	Command     string `json:"command"`
+}
+
+// UnusedReport 设备未使用对象及清理命令
+type UnusedReport struct {
+	DeviceId int             `json:"device_id"`
+	Device   string          `json:"device"`
+	Objects  []*UnusedObject `json:"objects"`
+	Commands string          `json:"commands"`
+}
+
+// FindUnusedObjects 获取设备上未被策略、nat、srx nat和黑名单引用的地址组和端口，并生成删除命令
+func FindUnusedObjects(deviceId int) (*UnusedReport, error) {
+	device := model.TFirewallDevice{}
+	if e := device.FirstById(deviceId); e != nil {
+		return nil, e
+	}
+	deviceType := model.TDeviceType{}
+	if e := deviceType.FirstById(device.DeviceTypeId); e != nil {
+		return nil, e
+	}
+	vendor := strings.ToLower(deviceType.Name)
+	if _, ok := unusedDeleteCommands[vendor]; !ok {
+		return nil, fmt.Errorf("暂不支持当前类型的设备生成清理命令, 设备类型: %s", deviceType.Name)
+	}
+	refs, e := getObjectReferences(deviceId)
+	if e != nil {
+		return nil, e
+	}
+	groups := make([]*model.TDeviceAddressGroup, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Order("id").Find(&groups).Error; e != nil {
+		return nil, fmt.Errorf("获取设备地址组失败, err: %w", e)
+	}
+	ports := make([]*model.TDevicePort, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Order("id").Find(&ports).Error; e != nil {
+		return nil, fmt.Errorf("获取设备端口失败, err: %w", e)
+	}
+	result := &UnusedReport{DeviceId: deviceId, Device: device.Name, Objects: make([]*UnusedObject, 0)}
+	result.Objects = append(result.Objects, findUnusedGroups(groups, refs)...)
+	result.Objects = append(result.Objects, findUnusedPorts(ports, refs)...)
+	result.Commands = unusedDeleteCommands[vendor](result.Objects)
+	for _, v := range result.Objects {
+		v.Command = unusedDeleteCommands[vendor]([]*UnusedObject{v})
+	}
+	return result, nil
+}
+
+// 获取设备上所有被引用的对象名，策略和nat的命令中出现的名称也视为引用
+func getObjectReferences(deviceId int) (map[string]bool, error) {
+	refs := make(map[string]bool)
+	add := func(texts ...string) {
+		for _, text := range texts {
+			for _, v := range strings.Split(text, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					refs[v] = true
+				}
+			}
+		}
+	}
+	addCommand := func(command string) {
+		for _, v := range strings.Fields(command) {
+			refs[v] = true
+		}
+	}
+	policies := make([]*model.TDevicePolicy, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&policies).Error; e != nil {
+		return nil, fmt.Errorf("获取设备策略失败, err: %w", e)
+	}
+	for _, v := range policies {
+		add(v.SrcGroup, v.DstGroup, v.PortGroup)
+		addCommand(v.Command)
+	}
+	nats := make([]*model.TDeviceNat, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&nats).Error; e != nil {
+		return nil, fmt.Errorf("获取设备nat失败, err: %w", e)
+	}
+	for _, v := range nats {
+		add(v.NetworkGroup, v.StaticGroup, v.DestinationGroup)
+		addCommand(v.Command)
+	}
+	srxNats := make([]*model.TDeviceSrxNat, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&srxNats).Error; e != nil {
+		return nil, fmt.Errorf("获取设备srx nat失败, err: %w", e)
+	}
+	for _, v := range srxNats {
+		add(v.Pool)
+		addCommand(v.Command)
+	}
+	blacklists := make([]*model.TBlacklistDeviceGroup, 0)
+	if e := database.DB.Where("device_id = ?", deviceId).Find(&blacklists).Error; e != nil {
+		return nil, fmt.Errorf("获取设备黑名单组失败, err: %w", e)
+	}
+	for _, v := range blacklists {
+		add(v.Name)
+	}
+	return refs, nil
+}
+
+// 地址组不同zone下可以重名，按zone和名称区分
+type groupKey struct {
+	zone string
+	name string
+}
+
+func findUnusedGroups(groups []*model.TDeviceAddressGroup, refs map[string]bool) []*UnusedObject {
+	items, keys := make(map[groupKey][]*model.TDeviceAddressGroup), make([]groupKey, 0)
+	names := make(map[string]bool)
+	for _, v := range groups {
+		k := groupKey{v.Zone, v.Name}
+		if _, ok := items[k]; !ok {
+			keys = append(keys, k)
+		}
+		items[k] = append(items[k], v)
+		names[v.Name] = true
+	}
+	used := make(map[groupKey]bool)
+	for _, k := range keys {
+		if refs[k.name] {
+			used[k] = true
+		}
+	}
+	// 华为等设备地址组中可以引用其他地址组，被引用组中的组也视为被引用
+	for changed := true; changed; {
+		changed = false
+		for _, k := range keys {
+			if !used[k] {
+				continue
+			}
+			for _, v := range items[k] {
+				nested := groupKey{k.zone, v.Address}
+				if names[v.Address] && items[nested] != nil && !used[nested] {
+					used[nested] = true
+					changed = true
+				}
+			}
+		}
+	}
+	// asa和srx的地址组解析时已展开为地址，无法知道组内引用了哪些地址对象，
+	// 地址对象的地址都包含在同zone被引用的地址组中时视为被引用，避免误删
+	usedAddresses := make(map[string]map[string]bool)
+	for _, k := range keys {
+		if !used[k] {
+			continue
+		}
+		if _, ok := usedAddresses[k.zone]; !ok {
+			usedAddresses[k.zone] = make(map[string]bool)
+		}
+		for _, v := range items[k] {
+			usedAddresses[k.zone][v.Address] = true
+		}
+	}
+	results := make([]*UnusedObject, 0)
+	for _, k := range keys {
+		if used[k] {
+			continue
+		}
+		addressType := items[k][0].AddressType
+		if addressType == "object" || addressType == "address" {
+			contained := true
+			for _, v := range items[k] {
+				if !usedAddresses[k.zone][v.Address] {
+					contained = false
+					break
+				}
+			}
+			if contained {
+				continue
+			}
+		}
+		addresses := make([]string, 0)
+		for _, v := range items[k] {
+			addresses = append(addresses, v.Address)
+		}
+		results = append(results, &UnusedObject{
+			ObjectType:  UnusedObjectAddress,
+			Name:        k.name,
+			Zone:        k.zone,
+			AddressType: addressType,
+			Content:     strings.Join(addresses, ","),
+		})
+	}
+	return results
+}
+
+func findUnusedPorts(ports []*model.TDevicePort, refs map[string]bool) []*UnusedObject {
+	items, names := make(map[string][]string), make([]string, 0)
+	for _, v := range ports {
+		// 设备预定义的应用不能删除
+		if strings.HasPrefix(v.Name, "junos-") {
+			continue
+		}
+		if _, ok := items[v.Name]; !ok {
+			names = append(names, v.Name)
+		}
+		items[v.Name] = append(items[v.Name], fmt.Sprintf("%s:%d-%d", v.Protocol, v.Start, v.End))
+	}
+	results := make([]*UnusedObject, 0)
+	for _, name := range names {
+		if refs[name] {
+			continue
+		}
+		results = append(results, &UnusedObject{ObjectType: UnusedObjectPort, Name: name, Content: strings.Join(items[name], ",")})
+	}
+	return results
+}
+
+// 地址组需要先于地址对象删除，否则被组引用的对象无法删除
+func sortUnusedObjects(objects []*UnusedObject, setTypes ...string) []*UnusedObject {
+	sets := make(map[string]bool)
+	for _, v := range setTypes {
+		sets[v] = true
+	}
+	rank := func(v *UnusedObject) int {
+		switch {
+		case v.ObjectType == UnusedObjectAddress && sets[v.AddressType]:
+			return 0
+		case v.ObjectType == UnusedObjectAddress:
+			return 1
+		}
+		return 2
+	}
+	results := make([]*UnusedObject, len(objects))
+	copy(results, objects)
+	sort.SliceStable(results, func(i, j int) bool {
+		return rank(results[i]) < rank(results[j])
+	})
+	return results
+}
+
+// 各厂商删除对象的命令
+var unusedDeleteCommands = map[string]func(objects []*UnusedObject) string{
+	"asa": func(objects []*UnusedObject) string {
+		builder := strings.Builder{}
+		for _, v := range sortUnusedObjects(objects, "object-group") {
+			switch {
+			case v.ObjectType == UnusedObjectPort:
+				builder.WriteString(fmt.Sprintf("no object-group service %s\n", v.Name))
+			case v.AddressType == "object":
+				builder.WriteString(fmt.Sprintf("no object network %s\n", v.Name))
+			default:
+				builder.WriteString(fmt.Sprintf("no object-group network %s\n", v.Name))
+			}
+		}
+		return builder.String()
+	},
+	"srx": func(objects []*UnusedObject) string {
+		builder := strings.Builder{}
+		for _, v := range sortUnusedObjects(objects, "address-set") {
+			switch {
+			case v.ObjectType == UnusedObjectPort:
+				builder.WriteString(fmt.Sprintf("delete applications application %s\n", v.Name))
+			case v.Zone == "" || v.Zone == "global":
+				builder.WriteString(fmt.Sprintf("delete security address-book global %s %s\n", v.AddressType, v.Name))
+			default:
+				builder.WriteString(fmt.Sprintf("delete security zones security-zone %s address-book %s %s\n", v.Zone, v.AddressType, v.Name))
+			}
+		}
+		return builder.String()
+	},
+	"h3c": func(objects []*UnusedObject) string {
+		builder := strings.Builder{}
+		for _, v := range objects {
+			switch {
+			case v.ObjectType == UnusedObjectPort:
+				builder.WriteString(fmt.Sprintf("undo object-group service %s\n", v.Name))
+			case v.AddressType == conf.IpTypeV6:
+				builder.WriteString(fmt.Sprintf("undo object-group ipv6 address %s\n", v.Name))
+			default:
+				builder.WriteString(fmt.Sprintf("undo object-group ip address %s\n", v.Name))
+			}
+		}
+		return builder.String()
+	},
+	"huawei": func(objects []*UnusedObject) string {
+		builder := strings.Builder{}
+		for _, v := range objects {
+			switch v.ObjectType {
+			case UnusedObjectPort:
+				builder.WriteString(fmt.Sprintf("undo ip service-set %s\n", v.Name))
+			default:
+				builder.WriteString(fmt.Sprintf("undo ip address-set %s\n", v.Name))
+			}
+		}
+		return builder.String()
+	},
+}
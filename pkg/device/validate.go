@@ -0,0 +1,385 @@
+package device
+
+import (
+	"fmt"
+	"net"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 命令参数的校验类型，def:和ref:后为对象类型，def为脚本中新建的对象，ref为引用的对象
+const (
+	argName     = "name"
+	argIp       = "ip"
+	argNetmask  = "netmask" // 点分十进制掩码
+	argMask     = "mask"    // 点分十进制掩码或前缀长度
+	argPrefix   = "prefix"
+	argCidr     = "cidr"
+	argPort     = "port"
+	argPortEnd  = "port-end" // 范围端口的结束端口，不能小于开始端口
+	argProtocol = "protocol"
+)
+
+// 引用对象的类型
+const (
+	objAddress = "address"
+	objService = "service"
+	objZone    = "zone"
+	objPolicy  = "policy"
+	objPool    = "pool"
+	objNatRule = "nat-rule"
+	objAcl     = "acl"
+)
+
+var objectTypeNames = map[string]string{
+	objAddress: "地址组",
+	objService: "端口组",
+	objZone:    "安全区域",
+	objPolicy:  "策略",
+	objPool:    "地址池",
+	objNatRule: "nat规则",
+	objAcl:     "访问控制列表",
+}
+
+var validProtocols = map[string]bool{"ip": true, "tcp": true, "udp": true, "icmp": true, "icmpv6": true, "sctp": true, "tcp-udp": true}
+
+// 语法规则，within为空时可以出现在任意位置，否则只能出现在对应的视图下，enter不为空时进入新的视图
+type grammarRule struct {
+	pattern *regexp.Regexp
+	args    []string
+	within  []string
+	enter   string
+}
+
+func rule(pattern string, args ...string) *grammarRule {
+	return &grammarRule{pattern: regexp.MustCompile("^" + pattern + "$"), args: args}
+}
+
+func (r *grammarRule) in(views ...string) *grammarRule {
+	r.within = views
+	return r
+}
+
+func (r *grammarRule) view(view string) *grammarRule {
+	r.enter = view
+	return r
+}
+
+// quit退出到系统视图
+var quitRule = rule(`quit`).view("")
+
+// 各厂商生成命令的语法，只包含netops会生成的语句
+var grammars = map[string][]*grammarRule{
+	"asa": {
+		rule(`object-group service (\S+) (\S+)`, "def:"+objService, argProtocol).view("service"),
+		rule(`port-object eq (\d+)`, argPort).in("service"),
+		rule(`port-object range (\d+) (\d+)`, argPort, argPortEnd).in("service"),
+		rule(`object-group network (\S+)`, "def:"+objAddress).view("network-group"),
+		rule(`network-object (\S+) (\S+)`, argIp, argNetmask).in("network-group"),
+		rule(`object network (\S+)`, "def:"+objAddress).view("object"),
+		rule(`subnet (\S+) (\S+)`, argIp, argNetmask).in("object"),
+		rule(`nat \(inside,outside\) static (\S+) service (\S+) (\d+) (\d+)`, "ref:"+objAddress, argProtocol, argPort, argPort).in("object"),
+		rule(`nat \(inside,outside\) source dynamic (\S+) (\S+) destination static (\S+) (\S+)`,
+			"ref:"+objAddress, "ref:"+objPool, "ref:"+objAddress, "ref:"+objAddress).view(""),
+		rule(`access-list (\S+) line \d+ extended permit (\S+) object-group (\S+) object-group (\S+) object-group (\S+)`,
+			"ref:"+objAcl, argProtocol, "ref:"+objAddress, "ref:"+objAddress, "ref:"+objService).view(""),
+	},
+	"srx": {
+		rule(`set security zones security-zone (\S+) address-book address (\S+) (\S+)`, "ref:"+objZone, "def:"+objAddress, argCidr),
+		rule(`set applications application (\S+) protocol (\S+)`, "def:"+objService, argProtocol),
+		rule(`set applications application (\S+) destination-port (\d+)-(\d+)`, "ref:"+objService, argPort, argPortEnd),
+		rule(`set security policies from-zone (\S+) to-zone (\S+) policy (\S+) match (?:source|destination)-address (\S+)`,
+			"ref:"+objZone, "ref:"+objZone, "def:"+objPolicy, "ref:"+objAddress),
+		rule(`set security policies from-zone (\S+) to-zone (\S+) policy (\S+) match application (\S+)`,
+			"ref:"+objZone, "ref:"+objZone, "def:"+objPolicy, "ref:"+objService),
+		rule(`set security policies from-zone (\S+) to-zone (\S+) policy (\S+) then permit`,
+			"ref:"+objZone, "ref:"+objZone, "def:"+objPolicy),
+		rule(`insert security policies from-zone (\S+) to-zone (\S+) policy (\S+) before policy (\S+)`,
+			"ref:"+objZone, "ref:"+objZone, "ref:"+objPolicy, "ref:"+objPolicy),
+		rule(`set security nat source rule-set (\S+) rule (\S+) match (?:source|destination)-address (\S+)`,
+			argName, "def:"+objNatRule, argCidr),
+		rule(`set security nat source rule-set (\S+) rule (\S+) then source-nat pool (\S+)`,
+			argName, "def:"+objNatRule, "ref:"+objPool),
+		rule(`insert security nat source rule-set (\S+) rule (\S+) before rule (\S+)`,
+			argName, "ref:"+objNatRule, "ref:"+objNatRule),
+	},
+	"h3c": {
+		rule(`object-group (?:ip|ipv6) address (\S+)`, "def:"+objAddress).view("address"),
+		rule(`security-zone (\S+)`, "ref:"+objZone).in("address"),
+		rule(`network host address (\S+)`, argIp).in("address"),
+		rule(`network subnet (\S+) (\S+)`, argIp, argMask).in("address"),
+		rule(`object-group service (\S+)`, "def:"+objService).view("service"),
+		rule(`(?:\d+ )?service (\S+) destination eq (\d+)`, argProtocol, argPort).in("service"),
+		rule(`(?:\d+ )?service (\S+) destination range (\d+) (\d+)`, argProtocol, argPort, argPortEnd).in("service"),
+		rule(`security-policy (?:ip|ipv6)`).view("policy"),
+		rule(`nat global-policy`).view("policy"),
+		rule(`rule name (\S+)`, argName).in("policy", "rule").view("rule"),
+		rule(`action (?:pass|snat address-group name (\S+))`, "ref:"+objPool).in("rule"),
+		rule(`(?:source|destination)-zone (\S+)`, "ref:"+objZone).in("rule"),
+		rule(`(?:source|destination)-ip (\S+)`, "ref:"+objAddress).in("rule"),
+		rule(`service (\S+)`, "ref:"+objService).in("rule"),
+		rule(`interface (\S+)`, argName).view("interface"),
+		rule(`nat server global (\S+) inside (\S+) rule (\S+)`, argIp, argIp, argName).in("interface"),
+		rule(`nat server protocol (\S+) global (\S+) (\d+)(?: (\d+))? inside (\S+) (\d+)(?: (\d+))? rule (\S+)`,
+			argProtocol, argIp, argPort, argPortEnd, argIp, argPort, argPortEnd, argName).in("interface"),
+		quitRule,
+	},
+	"huawei": {
+		rule(`ip address-set (\S+) type object`, "def:"+objAddress).view("address"),
+		rule(`address \d+ (\S+) mask (\d+)`, argIp, argPrefix).in("address"),
+		rule(`address \d+ (\S+) (\d+)`, argIp, argPrefix).in("address"),
+		rule(`ip service-set (\S+) type object`, "def:"+objService).view("service"),
+		rule(`service \d+ protocol (\S+) source-port 0 to 65535 destination-port (\d+)(?: to (\d+))?`,
+			argProtocol, argPort, argPortEnd).in("service"),
+		rule(`object-group service (\S+)`, "def:"+objService).view("service-group"),
+		rule(`\d+ service (\S+) destination eq (\d+)`, argProtocol, argPort).in("service-group"),
+		rule(`\d+ service (\S+) destination range (\d+) (\d+)`, argProtocol, argPort, argPortEnd).in("service-group"),
+		rule(`security-policy`).view("policy"),
+		rule(`nat-policy`).view("policy"),
+		rule(`rule name (\S+)`, argName).in("policy", "rule").view("rule"),
+		rule(`action (?:permit|source-nat address-group (\S+))`, "ref:"+objPool).in("rule"),
+		rule(`(?:source|destination)-zone (\S+)`, "ref:"+objZone).in("rule"),
+		rule(`(?:source|destination)-address address-set (\S+)`, "ref:"+objAddress).in("rule"),
+		rule(`service (\S+)`, "ref:"+objService).in("rule"),
+		rule(`nat server (\S+) global (\S+) inside (\S+) no-reverse`, argName, argIp, argIp).view(""),
+		rule(`nat server (\S+) protocol (\S+) global (\S+) (\d+)(?: (\d+))? inside (\S+) (\d+)(?: (\d+))? no-reverse`,
+			argName, argProtocol, argIp, argPort, argPortEnd, argIp, argPort, argPortEnd).view(""),
+		quitRule,
+	},
+}
+
+// 命令校验器，设备上已有的对象在第一次引用时加载
+type commandValidator struct {
+	b       *base
+	vendor  string
+	defined map[string]map[string]bool
+	objects map[string]map[string]bool
+}
+
+/*
+ValidateCommand 下发前离线校验生成的命令:
+ 1. 每行命令都要符合厂商的语法，子命令要在对应的视图下
+ 2. 地址、端口、协议等参数格式正确
+ 3. 引用的对象在设备上已存在，或在脚本前面已创建
+*/
+func (b *base) ValidateCommand(command string) error {
+	if b.error != nil {
+		return b.error
+	}
+	vendor := strings.ToLower(b.deviceType.Name)
+	if _, ok := grammars[vendor]; !ok {
+		return nil
+	}
+	v := &commandValidator{b: b, vendor: vendor, defined: map[string]map[string]bool{}, objects: map[string]map[string]bool{}}
+	return v.validate(command)
+}
+
+func (v *commandValidator) validate(command string) error {
+	messages := make([]string, 0)
+	view := ""
+	for i, line := range strings.Split(command, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		r := v.match(line, view)
+		if r == nil {
+			messages = append(messages, fmt.Sprintf("第%d行命令不符合%s语法: %s", i+1, v.vendor, line))
+			continue
+		}
+		if r.enter != "" || len(r.within) == 0 {
+			view = r.enter
+		}
+		values := r.pattern.FindStringSubmatch(line)[1:]
+		start := 0
+		for j, kind := range r.args {
+			if values[j] == "" { // 可选参数
+				continue
+			}
+			if kind == argPort {
+				start, _ = strconv.Atoi(values[j])
+			}
+			msg, e := v.checkArg(kind, values[j], start)
+			if e != nil {
+				return e
+			}
+			if msg != "" {
+				messages = append(messages, fmt.Sprintf("第%d行%s: %s", i+1, msg, line))
+			}
+		}
+	}
+	if len(messages) > 0 {
+		return fmt.Errorf("生成的命令校验失败:\n%s", strings.Join(messages, "\n"))
+	}
+	return nil
+}
+
+// 匹配当前视图下的语法规则，优先匹配当前视图的子命令
+func (v *commandValidator) match(line, view string) *grammarRule {
+	var global *grammarRule
+	for _, r := range grammars[v.vendor] {
+		if !r.pattern.MatchString(line) {
+			continue
+		}
+		if len(r.within) == 0 {
+			if global == nil {
+				global = r
+			}
+			continue
+		}
+		for _, w := range r.within {
+			if w == view {
+				return r
+			}
+		}
+	}
+	return global
+}
+
+// 校验单个参数，返回不符合要求的原因
+func (v *commandValidator) checkArg(kind, value string, start int) (string, error) {
+	switch {
+	case kind == argName:
+	case kind == argIp:
+		if net.ParseIP(value) == nil {
+			return fmt.Sprintf("地址<%s>格式错误", value), nil
+		}
+	case kind == argNetmask:
+		if !validNetmask(value) {
+			return fmt.Sprintf("掩码<%s>格式错误", value), nil
+		}
+	case kind == argMask:
+		if !validNetmask(value) && !validPrefix(value) {
+			return fmt.Sprintf("掩码<%s>格式错误", value), nil
+		}
+	case kind == argPrefix:
+		if !validPrefix(value) {
+			return fmt.Sprintf("前缀长度<%s>格式错误", value), nil
+		}
+	case kind == argCidr:
+		if _, _, e := net.ParseCIDR(value); e != nil && net.ParseIP(value) == nil {
+			return fmt.Sprintf("网段<%s>格式错误", value), nil
+		}
+	case kind == argPort || kind == argPortEnd:
+		p, e := strconv.Atoi(value)
+		if e != nil || p < 1 || p > 65535 {
+			return fmt.Sprintf("端口<%s>超出范围", value), nil
+		}
+		if kind == argPortEnd && p < start {
+			return fmt.Sprintf("结束端口<%s>小于开始端口<%d>", value, start), nil
+		}
+	case kind == argProtocol:
+		if !validProtocols[strings.ToLower(value)] {
+			return fmt.Sprintf("协议<%s>不支持", value), nil
+		}
+	case strings.HasPrefix(kind, "def:"):
+		objectType := strings.TrimPrefix(kind, "def:")
+		if v.defined[objectType] == nil {
+			v.defined[objectType] = map[string]bool{}
+		}
+		v.defined[objectType][value] = true
+	case strings.HasPrefix(kind, "ref:"):
+		objectType := strings.TrimPrefix(kind, "ref:")
+		ok, e := v.exists(objectType, value)
+		if e != nil {
+			return "", e
+		}
+		if !ok {
+			return fmt.Sprintf("引用的%s<%s>不存在", objectTypeNames[objectType], value), nil
+		}
+	}
+	return "", nil
+}
+
+// 对象是否在脚本中已创建、设备上已存在或是设备内置对象
+func (v *commandValidator) exists(objectType, name string) (bool, error) {
+	if v.defined[objectType][name] || v.builtin(objectType, name) {
+		return true, nil
+	}
+	if _, ok := v.objects[objectType]; !ok {
+		names, e := v.load(objectType)
+		if e != nil {
+			return false, e
+		}
+		v.objects[objectType] = make(map[string]bool, len(names))
+		for _, n := range names {
+			v.objects[objectType][n] = true
+		}
+	}
+	return v.objects[objectType][name], nil
+}
+
+func (v *commandValidator) builtin(objectType, name string) bool {
+	switch objectType {
+	case objAddress:
+		return name == "any" || name == "any-ipv4" || name == "any-ipv6" || name == conf.BanGongWang || name == conf.BanGongWangV6
+	case objService:
+		if _, ok := PortMaps[name]; ok {
+			return true
+		}
+		return name == "any" || (v.vendor == "srx" && strings.HasPrefix(name, "junos-"))
+	}
+	return false
+}
+
+// 加载设备上已有的对象名
+func (v *commandValidator) load(objectType string) ([]string, error) {
+	names := make([]string, 0)
+	db := database.DB.Where("device_id = ?", v.b.DeviceId)
+	var e error
+	switch objectType {
+	case objAddress:
+		e = db.Model(&model.TDeviceAddressGroup{}).Distinct().Pluck("name", &names).Error
+	case objService:
+		e = db.Model(&model.TDevicePort{}).Distinct().Pluck("name", &names).Error
+	case objPolicy:
+		e = db.Model(&model.TDevicePolicy{}).Distinct().Pluck("name", &names).Error
+	case objNatRule:
+		e = db.Model(&model.TDeviceSrxNat{}).Distinct().Pluck("rule", &names).Error
+	case objPool:
+		if e = db.Model(&model.TDeviceNatPool{}).Distinct().Pluck("name", &names).Error; e == nil {
+			addresses := make([]string, 0)
+			e = database.DB.Model(&model.TDeviceAddressGroup{}).Where("device_id = ?", v.b.DeviceId).
+				Distinct().Pluck("name", &addresses).Error
+			names = append(names, addresses...)
+		}
+	case objZone:
+		zones := make([]*model.TDeviceZone, 0)
+		policies := make([]*model.TDevicePolicy, 0)
+		if e = db.Find(&zones).Error; e == nil {
+			e = database.DB.Model(&model.TDevicePolicy{}).Where("device_id = ?", v.b.DeviceId).
+				Distinct("src_zone", "dst_zone").Find(&policies).Error
+		}
+		for _, z := range zones {
+			names = append(names, z.Name)
+		}
+		for _, p := range policies {
+			names = append(names, p.SrcZone, p.DstZone)
+		}
+		names = append(names, v.b.device.InPolicy, v.b.device.OutPolicy)
+	case objAcl:
+		names = append(names, v.b.device.InPolicy, v.b.device.OutPolicy)
+	}
+	if e != nil {
+		return nil, fmt.Errorf("获取设备已有%s失败, err: %w", objectTypeNames[objectType], e)
+	}
+	return names, nil
+}
+
+func validNetmask(mask string) bool {
+	ip := net.ParseIP(mask).To4()
+	if ip == nil {
+		return false
+	}
+	_, bits := net.IPMask(ip).Size()
+	return bits == 32
+}
+
+func validPrefix(prefix string) bool {
+	p, e := strconv.Atoi(prefix)
+	return e == nil && p >= 0 && p <= 128
+}
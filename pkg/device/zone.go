@@ -0,0 +1,108 @@
+package device
+
+import (
+	"bytes"
+	"netops/conf"
+	"netops/model"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// 解析方向 如果 source-zone in destination-zone out则是出向， source-zone out destination-zone in 则是入向
+// 其他区域对使用"源区域-目标区域"作为方向，真实区域保存在策略的src_zone和dst_zone中
+func (b *base) parseDirection(srcZone, dstZone string) string {
+	switch {
+	case srcZone == b.device.InPolicy && dstZone == b.device.OutPolicy:
+		return "outside"
+	case srcZone == b.device.OutPolicy && dstZone == b.device.InPolicy:
+		return "inside"
+	}
+	return srcZone + "-" + dstZone
+}
+
+// 按方向获取设备默认的区域对
+func (b *base) defaultZonePair(direction string) (srcZone, dstZone string) {
+	switch direction {
+	case "inside":
+		return b.device.OutPolicy, b.device.InPolicy
+	case "outside":
+		return b.device.InPolicy, b.device.OutPolicy
+	}
+	return "", ""
+}
+
+/*
+获取策略的区域对，优先级:
+ 1. 策略指定的源区域和目标区域
+ 2. 设备区域目录中源地址和目标地址所在的区域
+ 3. 按方向使用设备的入向和出向区域
+*/
+func (b *base) zonePair(info *model.TTaskInfo) (srcZone, dstZone string) {
+	if info.SrcZone != "" && info.DstZone != "" {
+		return info.SrcZone, info.DstZone
+	}
+	zones, e := new(model.TDeviceZone).FindByDeviceId(b.DeviceId)
+	if e != nil {
+		zap.L().Error("获取设备区域目录失败, 使用默认区域", zap.Int("device_id", b.DeviceId), zap.Error(e))
+	} else if len(zones) > 0 {
+		srcZone, dstZone = info.SrcZone, info.DstZone
+		if srcZone == "" {
+			srcZone = findZone(zones, info.Src)
+		}
+		if dstZone == "" {
+			dstZone = findZone(zones, info.Dst)
+		}
+		if srcZone != "" && dstZone != "" && srcZone != dstZone {
+			return
+		}
+	}
+	return b.defaultZonePair(info.Direction)
+}
+
+// 是否是设备默认的区域对，只有默认区域对才使用设备配置的拒绝策略名
+func (b *base) isDefaultZonePair(direction, srcZone, dstZone string) bool {
+	src, dst := b.defaultZonePair(direction)
+	return src == srcZone && dst == dstZone
+}
+
+// 获取地址所在的区域，多个区域包含时取网段最小的区域，办公网和多个地址时以第一个地址为准
+func findZone(zones []*model.TDeviceZone, address string) string {
+	if address == "" || address == conf.BanGongWang || address == conf.BanGongWangV6 {
+		return ""
+	}
+	address = strings.Split(address, ",")[0]
+	var (
+		result string
+		size   []byte
+	)
+	for _, zone := range zones {
+		for _, subnet := range strings.Split(zone.Subnet, ",") {
+			subnet = strings.TrimSpace(subnet)
+			if subnet == "" || !addressContains(subnet, address) {
+				continue
+			}
+			spans, _ := parseAddressSpans(subnet)
+			if width := spanWidth(spans[0]); result == "" || bytes.Compare(width, size) < 0 {
+				result, size = zone.Name, width
+			}
+		}
+	}
+	return result
+}
+
+// 地址段的大小，用于比较网段范围
+func spanWidth(s span[[16]byte]) []byte {
+	result := make([]byte, 16)
+	borrow := 0
+	for i := 15; i >= 0; i-- {
+		v := int(s.end[i]) - int(s.start[i]) - borrow
+		borrow = 0
+		if v < 0 {
+			v += 256
+			borrow = 1
+		}
+		result[i] = byte(v)
+	}
+	return result
+}
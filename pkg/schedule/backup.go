@@ -0,0 +1,157 @@
+package schedule
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"netops/pkg/device"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBackupConcurrency = 5
+
+// ReloadBackup 重新加载定时备份任务，修改定时备份配置后调用
+func ReloadBackup() error {
+	schedules, e := new(model.TBackupSchedule).FindEnabled()
+	if e != nil {
+		return e
+	}
+	removePrefix("backup_")
+	for _, v := range schedules {
+		id := v.Id
+		if e := add(fmt.Sprintf("backup_%d", id), v.Cron, func() {
+			if _, e := RunBackup(id); e != nil {
+				zap.L().Error("定时备份执行失败", zap.Int("schedule_id", id), zap.Error(e))
+			}
+		}); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// 备份对象，设备ID及对应的备份方法
+type backupTarget struct {
+	name   string
+	backup func() error
+	prune  func(retention device.BackupRetention) (int, error)
+}
+
+// RunBackup 执行定时备份，备份区域下所有启用的设备并按保留策略清理历史备份
+func RunBackup(scheduleId int) (*model.TBackupRun, error) {
+	schedule := model.TBackupSchedule{}
+	if e := schedule.FirstById(scheduleId); e != nil {
+		return nil, e
+	}
+	l := zap.L().With(zap.String("func", "RunBackup"), zap.Int("schedule_id", scheduleId))
+	run := &model.TBackupRun{ScheduleId: schedule.Id, RegionId: schedule.RegionId, Status: "running"}
+	if e := database.DB.Create(run).Error; e != nil {
+		return nil, fmt.Errorf("保存备份执行记录失败, err: %w", e)
+	}
+	targets, e := getBackupTargets(schedule.RegionId)
+	if e != nil {
+		finishRun(run, "failed", e.Error())
+		return run, e
+	}
+	run.Total = len(targets)
+	retention := device.BackupRetention{Daily: schedule.KeepDaily, Weekly: schedule.KeepWeekly, Monthly: schedule.KeepMonthly}
+	concurrency := schedule.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBackupConcurrency
+	}
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		failures = make([]string, 0)
+		sem      = make(chan struct{}, concurrency)
+	)
+	for _, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t *backupTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			l.Info("备份设备--->", zap.String("device", t.name))
+			e := t.backup()
+			pruned := 0
+			if e == nil {
+				pruned, e = t.prune(retention)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			run.Pruned += pruned
+			if e != nil {
+				run.Failed++
+				failures = append(failures, fmt.Sprintf("%s: %s", t.name, e.Error()))
+				return
+			}
+			run.Success++
+		}(target)
+	}
+	wg.Wait()
+	status := "success"
+	if run.Failed > 0 {
+		status = "failed"
+	}
+	finishRun(run, status, strings.Join(failures, "\n"))
+	l.Info("定时备份完成", zap.Int("total", run.Total), zap.Int("success", run.Success), zap.Int("failed", run.Failed), zap.Int("pruned", run.Pruned))
+	return run, nil
+}
+
+func finishRun(run *model.TBackupRun, status, detail string) {
+	now := time.Now()
+	run.Status = status
+	run.Detail = detail
+	run.FinishedAt = &now
+	if e := database.DB.Save(run).Error; e != nil {
+		zap.L().Error("保存备份执行记录失败", zap.Error(e), zap.Int("run_id", run.Id))
+	}
+}
+
+// 获取区域下所有启用的防火墙和负载设备
+func getBackupTargets(regionId int) ([]*backupTarget, error) {
+	results := make([]*backupTarget, 0)
+	firewalls := make([]*model.TFirewallDevice, 0)
+	if e := database.DB.Where("region_id = ? and enabled = 1", regionId).Find(&firewalls).Error; e != nil {
+		return nil, fmt.Errorf("获取防火墙设备失败, region_id: %d, err: %w", regionId, e)
+	}
+	for _, v := range firewalls {
+		id := v.Id
+		results = append(results, &backupTarget{
+			name: v.Name,
+			backup: func() error {
+				h, e := device.NewDeviceHandler(id)
+				if e != nil {
+					return e
+				}
+				return h.Backup()
+			},
+			prune: func(retention device.BackupRetention) (int, error) {
+				return device.PruneBackups(conf.DeviceTypeFirewall, id, retention)
+			},
+		})
+	}
+	nlbs := make([]*model.TNLBDevice, 0)
+	if e := database.DB.Where("region_id = ? and enabled = 1", regionId).Find(&nlbs).Error; e != nil {
+		return nil, fmt.Errorf("获取负载设备失败, region_id: %d, err: %w", regionId, e)
+	}
+	for _, v := range nlbs {
+		id := v.Id
+		results = append(results, &backupTarget{
+			name: v.Name,
+			backup: func() error {
+				return device.NewF5Policy(id).Backup()
+			},
+			prune: func(retention device.BackupRetention) (int, error) {
+				return device.PruneBackups(conf.DeviceTypeNlb, id, retention)
+			},
+		})
+	}
+	return results, nil
+}
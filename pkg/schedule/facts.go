@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"go.uber.org/zap"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"netops/pkg/device"
+	"sync"
+)
+
+const defaultFactsConcurrency = 5
+
+// 注册设备资产信息定时采集任务
+func loadFactsCollect() error {
+	if conf.Config.Facts.Cron == "" {
+		return nil
+	}
+	return add("facts_collect", conf.Config.Facts.Cron, RunFactsCollect)
+}
+
+// RunFactsCollect 采集所有启用的防火墙设备的资产信息
+func RunFactsCollect() {
+	l := zap.L().With(zap.String("func", "RunFactsCollect"))
+	ids := make([]int, 0)
+	if e := database.DB.Model(&model.TFirewallDevice{}).Where("enabled = 1").Pluck("id", &ids).Error; e != nil {
+		l.Error("获取设备列表失败", zap.Error(e))
+		return
+	}
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		failed = 0
+		sem    = make(chan struct{}, defaultInt(conf.Config.Facts.Concurrency, defaultFactsConcurrency))
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(deviceId int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if _, e := device.CollectFacts(deviceId); e != nil {
+				l.Error("采集设备资产信息失败", zap.Int("device_id", deviceId), zap.Error(e))
+				lock.Lock()
+				failed++
+				lock.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	l.Info("设备资产信息采集完成", zap.Int("total", len(ids)), zap.Int("failed", failed))
+}
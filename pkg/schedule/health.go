@@ -0,0 +1,140 @@
+package schedule
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"netops/pkg/device"
+	"netops/utils"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthThreshold   = 3
+	defaultHealthConcurrency = 10
+	defaultHealthTimeout     = 60
+	defaultHealthKeepDays    = 30
+)
+
+// 注册设备健康检查定时任务
+func loadHealthCheck() error {
+	if conf.Config.Health.Cron == "" {
+		return nil
+	}
+	return add("health_check", conf.Config.Health.Cron, RunHealthCheck)
+}
+
+// 健康检查的设备，防火墙和负载设备使用不同的检查方式
+type healthTarget struct {
+	name     string
+	host     string
+	failures int // 检查前的连续失败次数
+	check    func(timeout time.Duration) (*model.TDeviceHealth, error)
+}
+
+// RunHealthCheck 检查所有启用的防火墙和负载设备，连续失败达到阈值时发送告警，恢复时发送恢复通知
+func RunHealthCheck() {
+	l := zap.L().With(zap.String("func", "RunHealthCheck"))
+	c := conf.Config.Health
+	threshold := defaultInt(c.Threshold, defaultHealthThreshold)
+	timeout := time.Duration(defaultInt(c.Timeout, defaultHealthTimeout)) * time.Second
+	targets, e := getHealthTargets()
+	if e != nil {
+		l.Error("获取设备列表失败", zap.Error(e))
+		return
+	}
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		failed = 0
+		sem    = make(chan struct{}, defaultInt(c.Concurrency, defaultHealthConcurrency))
+	)
+	for _, v := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t *healthTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result, e := t.check(timeout)
+			if e != nil {
+				l.Error("设备健康检查失败", zap.String("device", t.name), zap.Error(e))
+				return
+			}
+			if !result.LoginSuccess {
+				lock.Lock()
+				failed++
+				lock.Unlock()
+			}
+			notifyHealth(t, result, threshold)
+		}(v)
+	}
+	wg.Wait()
+	if count, e := device.PruneHealth(defaultInt(c.KeepDays, defaultHealthKeepDays)); e != nil {
+		l.Error("清理健康检查记录失败", zap.Error(e))
+	} else if count > 0 {
+		l.Info("清理健康检查记录", zap.Int64("count", count))
+	}
+	l.Info("设备健康检查完成", zap.Int("total", len(targets)), zap.Int("failed", failed))
+}
+
+// 获取所有启用的防火墙和负载设备
+func getHealthTargets() ([]*healthTarget, error) {
+	results := make([]*healthTarget, 0)
+	firewalls := make([]*model.TFirewallDevice, 0)
+	if e := database.DB.Where("enabled = 1").Find(&firewalls).Error; e != nil {
+		return nil, fmt.Errorf("获取防火墙设备失败, err: %w", e)
+	}
+	for _, v := range firewalls {
+		id := v.Id
+		results = append(results, &healthTarget{name: v.Name, host: v.Host, failures: v.HealthFailures,
+			check: func(timeout time.Duration) (*model.TDeviceHealth, error) {
+				return device.CheckHealth(id, timeout)
+			},
+		})
+	}
+	nlbs := make([]*model.TNLBDevice, 0)
+	if e := database.DB.Where("enabled = 1").Find(&nlbs).Error; e != nil {
+		return nil, fmt.Errorf("获取负载设备失败, err: %w", e)
+	}
+	for _, v := range nlbs {
+		id := v.Id
+		results = append(results, &healthTarget{name: v.Name, host: v.Host, failures: v.HealthFailures,
+			check: func(timeout time.Duration) (*model.TDeviceHealth, error) {
+				return device.CheckNlbHealth(id, timeout)
+			},
+		})
+	}
+	return results, nil
+}
+
+// 连续失败次数刚达到阈值时告警，之后不重复发送，已告警的设备恢复时发送恢复通知
+func notifyHealth(t *healthTarget, result *model.TDeviceHealth, threshold int) {
+	var subject, body string
+	switch {
+	case result.Failures == threshold:
+		subject = fmt.Sprintf("设备%s连续%d次健康检查失败", t.name, result.Failures)
+		body = fmt.Sprintf("设备: %s(%s)<br>状态: %s<br>错误: %s<br>检查时间: %s",
+			t.name, t.host, result.Status, result.Message, result.CheckedAt.Format(utils.LocalTimeFormat))
+	case result.LoginSuccess && t.failures >= threshold:
+		subject = fmt.Sprintf("设备%s已恢复", t.name)
+		body = fmt.Sprintf("设备: %s(%s)<br>连续失败%d次后恢复, 延迟%dms<br>检查时间: %s",
+			t.name, t.host, t.failures, result.Latency, result.CheckedAt.Format(utils.LocalTimeFormat))
+	default:
+		return
+	}
+	if e := utils.SendMail(subject, body, ""); e != nil {
+		zap.L().Error("发送设备健康告警邮件失败", zap.String("device", t.name), zap.Error(e))
+	}
+}
+
+func defaultInt(value, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,28 @@
+package schedule
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"netops/model"
+	"netops/pkg/tools"
+)
+
+// ReloadInvalidPolicy 重新加载定时采集策略命中数任务，修改无效策略任务后调用
+func ReloadInvalidPolicy() error {
+	tasks, e := new(model.TInvalidPolicyTask).FindScheduled()
+	if e != nil {
+		return e
+	}
+	removePrefix("invalid_policy_")
+	for _, v := range tasks {
+		id := v.Id
+		if e := add(fmt.Sprintf("invalid_policy_%d", id), v.Cron, func() {
+			if e := tools.NewInvalidPolicyHandler(id).Parse(); e != nil {
+				zap.L().Error("定时采集策略命中数失败", zap.Int("task_id", id), zap.Error(e))
+			}
+		}); e != nil {
+			return e
+		}
+	}
+	return nil
+}
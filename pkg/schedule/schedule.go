@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+)
+
+var (
+	c       *cron.Cron
+	entries = make(map[string]cron.EntryID)
+	mu      sync.Mutex
+)
+
+// Start 启动定时任务
+func Start() {
+	// 上一次未执行完时跳过本次，避免同一任务并发执行
+	c = cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
+	c.Start()
+	if e := ReloadBackup(); e != nil {
+		zap.L().Error("加载定时备份任务失败", zap.Error(e))
+	}
+	if e := loadVerifyBackup(); e != nil {
+		zap.L().Error("加载备份校验任务失败", zap.Error(e))
+	}
+	if e := ReloadInvalidPolicy(); e != nil {
+		zap.L().Error("加载定时采集策略命中数任务失败", zap.Error(e))
+	}
+	if e := loadHealthCheck(); e != nil {
+		zap.L().Error("加载设备健康检查任务失败", zap.Error(e))
+	}
+	if e := loadFactsCollect(); e != nil {
+		zap.L().Error("加载设备资产采集任务失败", zap.Error(e))
+	}
+}
+
+// 注册定时任务，key相同的任务会被替换
+func add(key, spec string, job func()) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if c == nil {
+		return fmt.Errorf("定时任务未启动")
+	}
+	if id, ok := entries[key]; ok {
+		c.Remove(id)
+		delete(entries, key)
+	}
+	id, e := c.AddFunc(spec, job)
+	if e != nil {
+		return fmt.Errorf("添加定时任务失败, key: %s, cron: %s, err: %w", key, spec, e)
+	}
+	entries[key] = id
+	return nil
+}
+
+// 移除key前缀匹配的定时任务
+func removePrefix(prefix string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if c == nil {
+		return
+	}
+	for k, id := range entries {
+		if strings.HasPrefix(k, prefix) {
+			c.Remove(id)
+			delete(entries, k)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package schedule
+
+import (
+	"go.uber.org/zap"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	"netops/pkg/device"
+)
+
+// 注册备份文件md5定时校验任务
+func loadVerifyBackup() error {
+	if conf.Config.Backup.VerifyCron == "" {
+		return nil
+	}
+	return add("verify_backup", conf.Config.Backup.VerifyCron, VerifyBackups)
+}
+
+// VerifyBackups 校验所有备份文件的md5
+func VerifyBackups() {
+	l := zap.L().With(zap.String("func", "VerifyBackups"))
+	ids := make([]int, 0)
+	if e := database.DB.Model(&model.TDeviceBackup{}).Pluck("id", &ids).Error; e != nil {
+		l.Error("获取备份列表失败", zap.Error(e))
+		return
+	}
+	failed := 0
+	for _, id := range ids {
+		if e := device.NewBackupHandler(id).Verify(); e != nil {
+			failed++
+			l.Error("备份文件校验失败", zap.Int("backup_id", id), zap.Error(e))
+		}
+	}
+	l.Info("备份文件校验完成", zap.Int("total", len(ids)), zap.Int("failed", failed))
+}
@@ -0,0 +1,73 @@
+package task
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/model"
+	device2 "netops/pkg/device"
+	"strings"
+)
+
+// AddCleanupTask 创建清理设备未使用地址组和端口的工单任务，命令已生成，审核通过后按正常流程执行
+func AddCleanupTask(deviceId int, jiraKey, operator string) (*model.TTask, error) {
+	device := model.TFirewallDevice{}
+	if e := device.FirstById(deviceId); e != nil {
+		return nil, e
+	}
+	report, e := device2.FindUnusedObjects(deviceId)
+	if e != nil {
+		return nil, e
+	}
+	if report.Commands == "" {
+		return nil, fmt.Errorf("设备没有需要清理的对象, 设备: %s", device.Name)
+	}
+	names := make([]string, 0, len(report.Objects))
+	for _, v := range report.Objects {
+		names = append(names, v.Name)
+	}
+	task, e := addCommandTask(&device, jiraKey, fmt.Sprintf("清理设备%s未使用的地址组和端口", device.Name),
+		strings.Join(names, "\n"), report.Commands, operator)
+	if e != nil {
+		return nil, e
+	}
+	model.AddLog(operator, fmt.Sprintf("创建设备<%s>未使用对象清理工单<%s>", device.Name, jiraKey))
+	return task, nil
+}
+
+// 创建命令已生成的工单任务，审核通过后按正常流程执行
+func addCommandTask(device *model.TFirewallDevice, jiraKey, summary, description, commands, operator string) (*model.TTask, error) {
+	jiraKey = strings.TrimSpace(jiraKey)
+	exists, e := new(model.TTask).ExistsByJiraKey(jiraKey)
+	if e != nil {
+		return nil, e
+	}
+	if exists {
+		return nil, fmt.Errorf("工单信息已存在, 工单号: %s", jiraKey)
+	}
+	task := &model.TTask{
+		JiraKey:     jiraKey,
+		Summary:     summary,
+		Creator:     operator,
+		Description: description,
+		Status:      conf.TaskStatusReady,
+		RegionId:    device.RegionId,
+		Type:        conf.TaskTypeFirewall,
+	}
+	if e := task.Create(); e != nil {
+		return nil, e
+	}
+	// action为deny的任务详情才会被执行，没有源目地址，生成配置、策略查询和漂移检测时跳过
+	info := &model.TTaskInfo{
+		TaskId:      task.Id,
+		Protocol:    "ip",
+		Action:      "deny",
+		DeviceId:    device.Id,
+		Command:     commands,
+		CommandOnly: true,
+		Status:      conf.TaskStatusReady,
+	}
+	if e := info.Create(); e != nil {
+		return nil, e
+	}
+	return task, nil
+}
@@ -0,0 +1,255 @@
+package task
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	device2 "netops/pkg/device"
+	"strings"
+	"time"
+)
+
+const (
+	DecommissionStatusDisabling    = "disabling"
+	DecommissionStatusDisabled     = "disabled"
+	DecommissionStatusDeleting     = "deleting"
+	DecommissionStatusDeleted      = "deleted"
+	DecommissionStatusReactivating = "reactivating"
+	DecommissionStatusReactivated  = "reactivated"
+	DecommissionStatusFailed       = "failed"
+
+	defaultDecommissionGraceDays = 14
+)
+
+// 下线流程中的状态，同一条策略不能重复下线
+var decommissionActiveStatus = []string{
+	DecommissionStatusDisabling,
+	DecommissionStatusDisabled,
+	DecommissionStatusDeleting,
+	DecommissionStatusReactivating,
+}
+
+// DecommissionParams 策略下线参数，策略可以来自策略分析或命中数报表
+type DecommissionParams struct {
+	DeviceId    int    `json:"device_id" binding:"required"`
+	PolicyIds   []int  `json:"policy_ids"`
+	HitCountIds []int  `json:"hit_count_ids"`
+	Source      string `json:"source"` // hit_count analysis
+	Reason      string `json:"reason"`
+	GraceDays   int    `json:"grace_days"`
+	JiraKey     string `json:"jira_key" binding:"required"`
+}
+
+// AddDecommission 创建策略下线记录和禁用策略的工单，工单执行成功后进入观察期
+func AddDecommission(params *DecommissionParams, operator string) (*model.TTask, error) {
+	if len(params.PolicyIds) == 0 && len(params.HitCountIds) == 0 {
+		return nil, fmt.Errorf("请选择需要下线的策略")
+	}
+	if params.GraceDays <= 0 {
+		params.GraceDays = defaultDecommissionGraceDays
+	}
+	device := model.TFirewallDevice{}
+	if e := device.FirstById(params.DeviceId); e != nil {
+		return nil, e
+	}
+	items, e := device2.FindDecommissionPolicies(params.DeviceId, params.PolicyIds, params.HitCountIds)
+	if e != nil {
+		return nil, e
+	}
+	actives := make([]*model.TPolicyDecommission, 0)
+	if e := database.DB.Where("device_id = ? and status in ?", params.DeviceId, decommissionActiveStatus).Find(&actives).Error; e != nil {
+		return nil, fmt.Errorf("获取策略下线记录失败, err: %w", e)
+	}
+	for _, v := range items {
+		for _, a := range actives {
+			if a.PolicyName == v.PolicyName && a.Direction == v.Direction && a.Command == v.Command {
+				return nil, fmt.Errorf("策略<%s>已在下线流程中, 状态: %s", v.PolicyName, a.Status)
+			}
+		}
+	}
+	commands, e := device2.DecommissionCommands(params.DeviceId, device2.DecommissionStageDisable, items)
+	if e != nil {
+		return nil, e
+	}
+	task, e := addCommandTask(&device, params.JiraKey, fmt.Sprintf("禁用设备%s的%d条策略", device.Name, len(items)),
+		decommissionDescription(items), commands, operator)
+	if e != nil {
+		return nil, e
+	}
+	for _, v := range items {
+		v.Source = params.Source
+		v.Reason = params.Reason
+		v.GraceDays = params.GraceDays
+		v.Status = DecommissionStatusDisabling
+		v.DisableTaskId = task.Id
+		v.CreatedBy = operator
+	}
+	if e := database.DB.Create(&items).Error; e != nil {
+		return nil, fmt.Errorf("保存策略下线记录失败, err: %w", e)
+	}
+	model.AddLog(operator, fmt.Sprintf("创建设备<%s>策略禁用工单<%s>", device.Name, task.JiraKey))
+	return task, nil
+}
+
+// AddDecommissionDeleteTask 观察期结束后创建删除策略的工单
+func AddDecommissionDeleteTask(ids []int, jiraKey, operator string) (*model.TTask, error) {
+	items, device, e := getDecommissions(ids, DecommissionStatusDisabled)
+	if e != nil {
+		return nil, e
+	}
+	now := time.Now()
+	for _, v := range items {
+		if deleteAt := v.DeleteAt(); deleteAt != nil && deleteAt.After(now) {
+			return nil, fmt.Errorf("策略<%s>还在观察期内, 可删除时间: %s", v.PolicyName, deleteAt.Format("2006-01-02 15:04:05"))
+		}
+	}
+	commands, e := device2.DecommissionCommands(device.Id, device2.DecommissionStageDelete, items)
+	if e != nil {
+		return nil, e
+	}
+	task, e := addCommandTask(device, jiraKey, fmt.Sprintf("删除设备%s已禁用的%d条策略", device.Name, len(items)),
+		decommissionDescription(items), commands, operator)
+	if e != nil {
+		return nil, e
+	}
+	if e := database.DB.Model(&model.TPolicyDecommission{}).Where("id in ?", ids).
+		Updates(map[string]any{"status": DecommissionStatusDeleting, "delete_task_id": task.Id, "updated_by": operator}).Error; e != nil {
+		return nil, fmt.Errorf("更新策略下线记录失败, err: %w", e)
+	}
+	model.AddLog(operator, fmt.Sprintf("创建设备<%s>策略删除工单<%s>", device.Name, task.JiraKey))
+	return task, nil
+}
+
+// AddDecommissionReactivateTask 观察期内有业务反馈时创建重新启用策略的工单
+func AddDecommissionReactivateTask(ids []int, jiraKey, operator string) (*model.TTask, error) {
+	items, device, e := getDecommissions(ids, DecommissionStatusDisabled)
+	if e != nil {
+		return nil, e
+	}
+	commands, e := device2.DecommissionCommands(device.Id, device2.DecommissionStageReactivate, items)
+	if e != nil {
+		return nil, e
+	}
+	task, e := addCommandTask(device, jiraKey, fmt.Sprintf("重新启用设备%s的%d条策略", device.Name, len(items)),
+		decommissionDescription(items), commands, operator)
+	if e != nil {
+		return nil, e
+	}
+	if e := database.DB.Model(&model.TPolicyDecommission{}).Where("id in ?", ids).
+		Updates(map[string]any{"status": DecommissionStatusReactivating, "reactivate_task_id": task.Id, "updated_by": operator}).Error; e != nil {
+		return nil, fmt.Errorf("更新策略下线记录失败, err: %w", e)
+	}
+	model.AddLog(operator, fmt.Sprintf("创建设备<%s>策略重新启用工单<%s>", device.Name, task.JiraKey))
+	return task, nil
+}
+
+// 获取下线记录，必须是同一设备并且状态一致
+func getDecommissions(ids []int, status string) ([]*model.TPolicyDecommission, *model.TFirewallDevice, error) {
+	if len(ids) == 0 {
+		return nil, nil, fmt.Errorf("请选择策略下线记录")
+	}
+	if e := RefreshDecommissions(); e != nil {
+		return nil, nil, e
+	}
+	items := make([]*model.TPolicyDecommission, 0)
+	if e := database.DB.Where("id in ?", ids).Find(&items).Error; e != nil {
+		return nil, nil, fmt.Errorf("获取策略下线记录失败, err: %w", e)
+	}
+	if len(items) != len(ids) {
+		return nil, nil, fmt.Errorf("部分策略下线记录不存在")
+	}
+	for _, v := range items {
+		if v.DeviceId != items[0].DeviceId {
+			return nil, nil, fmt.Errorf("只能选择同一设备的策略")
+		}
+		if v.Status != status {
+			return nil, nil, fmt.Errorf("策略<%s>当前状态为%s, 不能操作", v.PolicyName, v.Status)
+		}
+	}
+	device := model.TFirewallDevice{}
+	if e := device.FirstById(items[0].DeviceId); e != nil {
+		return nil, nil, e
+	}
+	return items, &device, nil
+}
+
+func decommissionDescription(items []*model.TPolicyDecommission) string {
+	names := make([]string, 0, len(items))
+	for _, v := range items {
+		names = append(names, fmt.Sprintf("%s %s", v.Direction, v.PolicyName))
+	}
+	return strings.Join(names, "\n")
+}
+
+// RefreshDecommissions 根据工单执行结果更新下线记录的状态
+func RefreshDecommissions() error {
+	items := make([]*model.TPolicyDecommission, 0)
+	if e := database.DB.Where("status in ?", []string{DecommissionStatusDisabling, DecommissionStatusDeleting, DecommissionStatusReactivating}).
+		Find(&items).Error; e != nil {
+		return fmt.Errorf("获取策略下线记录失败, err: %w", e)
+	}
+	tasks := make(map[int]*model.TTask)
+	getTask := func(id int) *model.TTask {
+		if _, ok := tasks[id]; !ok {
+			t := &model.TTask{}
+			if e := t.FirstById(id); e != nil {
+				// 工单被删除时视为失败
+				t.Status = conf.TaskStatusFailed
+			}
+			tasks[id] = t
+		}
+		return tasks[id]
+	}
+	for _, v := range items {
+		var (
+			task   *model.TTask
+			status string
+		)
+		switch v.Status {
+		case DecommissionStatusDisabling:
+			task = getTask(v.DisableTaskId)
+			switch {
+			case task.Status == conf.TaskStatusSuccess:
+				status = DecommissionStatusDisabled
+				v.DisabledAt = task.ExecuteEndTime
+				if v.DisabledAt == nil {
+					now := time.Now()
+					v.DisabledAt = &now
+				}
+			case isTaskFailed(task):
+				status = DecommissionStatusFailed
+			}
+		case DecommissionStatusDeleting:
+			task = getTask(v.DeleteTaskId)
+			switch {
+			case task.Status == conf.TaskStatusSuccess:
+				status = DecommissionStatusDeleted
+				v.FinishedAt = task.ExecuteEndTime
+			case isTaskFailed(task):
+				status = DecommissionStatusDisabled
+			}
+		case DecommissionStatusReactivating:
+			task = getTask(v.ReactivateTaskId)
+			switch {
+			case task.Status == conf.TaskStatusSuccess:
+				status = DecommissionStatusReactivated
+				v.FinishedAt = task.ExecuteEndTime
+			case isTaskFailed(task):
+				status = DecommissionStatusDisabled
+			}
+		}
+		if status == "" {
+			continue
+		}
+		v.Status = status
+		if e := database.DB.Model(v).Select("status", "disabled_at", "finished_at").Updates(v).Error; e != nil {
+			return fmt.Errorf("更新策略下线记录失败, id: %d, err: %w", v.Id, e)
+		}
+	}
+	return nil
+}
+
+func isTaskFailed(task *model.TTask) bool {
+	return task.Status == conf.TaskStatusFailed || task.Status == conf.TaskStatusReject || task.IsDeleted == 1
+}
@@ -0,0 +1,116 @@
+package task
+
+import (
+	"fmt"
+	"netops/conf"
+	"netops/database"
+	"netops/model"
+	device2 "netops/pkg/device"
+	"netops/pkg/subnet"
+)
+
+// ExplainParams 访问流量说明参数，未指定方向和设备时按工单的规则自动获取
+type ExplainParams struct {
+	Src             string `form:"src" binding:"required"`
+	Dst             string `form:"dst" binding:"required"`
+	Protocol        string `form:"protocol"`
+	Port            string `form:"port"`
+	Direction       string `form:"direction"`
+	DeviceId        int    `form:"device_id"`
+	RegionId        int    `form:"region_id"`
+	ImplementTypeId int    `form:"implement_type_id"`
+}
+
+// ExplainFlow 说明访问流量经过的设备、方向、匹配的策略和nat转换
+func ExplainFlow(params *ExplainParams) (*device2.FlowExplain, error) {
+	if params.Protocol == "" {
+		params.Protocol = "tcp"
+	}
+	direction, directionReason, e := explainDirection(params)
+	if e != nil {
+		return nil, e
+	}
+	device, deviceReason, e := explainDevice(params, direction)
+	if e != nil {
+		return nil, e
+	}
+	if device == nil {
+		return &device2.FlowExplain{
+			Src:             params.Src,
+			Dst:             params.Dst,
+			Protocol:        params.Protocol,
+			Port:            params.Port,
+			Direction:       direction,
+			DirectionReason: directionReason,
+			DeviceReason:    deviceReason,
+			Verdict:         device2.ExplainVerdictNoMatch,
+			Rules:           make([]*device2.RuleExplain, 0),
+			Nats:            make([]*device2.NatExplain, 0),
+			Message:         "未获取到访问经过的设备, 请确认网段是否关联网络设备",
+		}, nil
+	}
+	result, e := device2.ExplainPolicy(device.Id, direction, params.Src, params.Dst, params.Protocol, params.Port)
+	if e != nil {
+		return nil, e
+	}
+	result.DirectionReason = directionReason
+	result.Device = device.Name
+	result.DeviceReason = deviceReason
+	return result, nil
+}
+
+// 源地址是外网或办公网时为入向，否则为出向
+func explainDirection(params *ExplainParams) (string, string, error) {
+	if params.Direction != "" {
+		return params.Direction, "指定方向", nil
+	}
+	if params.Src == conf.BanGongWang || params.Src == conf.BanGongWangV6 {
+		return "inside", "源地址为办公网, 入向访问", nil
+	}
+	src, e := subnet.GetIPNet(params.Src)
+	if e != nil {
+		return "", "", e
+	}
+	if src.Region == "外网" {
+		return "inside", "源地址为外网地址, 入向访问", nil
+	}
+	return "outside", fmt.Sprintf("源地址为%s%s地址, 出向访问", src.Region, src.NetType), nil
+}
+
+// 入向根据目标地址匹配外网网段，出向根据源地址匹配内网网段，取最小的网段关联的设备
+func explainDevice(params *ExplainParams, direction string) (*model.TFirewallDevice, string, error) {
+	device := &model.TFirewallDevice{}
+	if params.DeviceId != 0 {
+		if e := device.FirstById(params.DeviceId); e != nil {
+			return nil, "", e
+		}
+		return device, "指定设备", nil
+	}
+	var (
+		deviceNets []*model.TFirewallSubnet
+		e          error
+	)
+	if params.RegionId != 0 && params.ImplementTypeId != 0 {
+		if deviceNets, e = new(model.TFirewallSubnet).FindByRegionIdImplementTypeId(params.RegionId, params.ImplementTypeId); e != nil {
+			return nil, "", e
+		}
+	} else if e = database.DB.Find(&deviceNets).Error; e != nil {
+		return nil, "", fmt.Errorf("获取网段关联的网络设备失败, err: %w", e)
+	}
+	ip := params.Src
+	if direction == "inside" {
+		ip = params.Dst
+	}
+	dn := findDeviceNet(direction, ip, deviceNets)
+	if dn == nil {
+		return nil, fmt.Sprintf("地址%s不在任何网段关联的设备中", ip), nil
+	}
+	if e := device.FirstById(dn.DeviceId); e != nil {
+		return nil, "", e
+	}
+	subnetName := dn.InnerSubnet
+	if direction == "inside" {
+		subnetName = dn.OuterSubnet
+	}
+	return device, fmt.Sprintf("地址%s属于网段%s, 关联设备%s", ip, subnetName, device.Name), nil
+}
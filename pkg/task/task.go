@@ -2,6 +2,7 @@ package task
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"netops/conf"
@@ -9,6 +10,7 @@ import (
 	net_api2 "netops/grpc_client/net_api"
 	"netops/grpc_client/protobuf/net_api"
 	"netops/model"
+	"netops/pkg/credential"
 	device2 "netops/pkg/device"
 	"netops/pkg/parse"
 	"netops/pkg/subnet"
@@ -47,7 +49,8 @@ func (h *taskHandler) Task() *model.TTask {
 	return h.task
 }
 func (h *taskHandler) init() {
-	if h.task.Type == conf.TaskTypeFirewall {
+	// 未使用对象清理等系统生成的工单没有实施类型
+	if h.task.Type == conf.TaskTypeFirewall && h.task.ImplementType != "" {
 		h.getImplementType()
 	}
 	h.getRegion()
@@ -183,15 +186,29 @@ func (h *taskHandler) UpdateStatusByOperate(operate string) error {
 	return nil
 }
 
-func (h *taskHandler) splitInfos(data *model.TTaskInfo) []*model.TTaskInfo {
+// 地址范围拆分网段数和单条策略拆分工作项数的上限，避免宽范围产生大量工作项
+const (
+	maxRangeCIDRs = 16
+	maxSplitInfos = 256
+)
+
+func (h *taskHandler) splitInfos(data *model.TTaskInfo) ([]*model.TTaskInfo, error) {
 	infos := make([]*model.TTaskInfo, 0)
-	srcL := strings.Split(data.Src, ",")
+	srcL, e := splitRangeAddress(data.Src)
+	if e != nil {
+		return nil, e
+	}
 	dstL := []string{data.Dst}
 	portL := []string{data.DPort}
 	if data.StaticIp == "" {
-		dstL = strings.Split(data.Dst, ",")
+		if dstL, e = splitRangeAddress(data.Dst); e != nil {
+			return nil, e
+		}
 		portL = strings.Split(data.DPort, ",")
 	}
+	if count := len(srcL) * len(dstL) * len(portL); count > maxSplitInfos {
+		return nil, fmt.Errorf("策略拆分后有%d条工作项, 超过%d条, 请合并地址范围或分多次添加", count, maxSplitInfos)
+	}
 	for _, src := range srcL {
 		src = strings.Trim(src, " ")
 		for _, dst := range dstL {
@@ -208,7 +225,33 @@ func (h *taskHandler) splitInfos(data *model.TTaskInfo) []*model.TTaskInfo {
 			}
 		}
 	}
-	return infos
+	return infos, nil
+}
+
+// 按逗号分割地址，范围地址如 10.0.0.5-10.0.3.20 拆分为网段，格式不正确的保留原值由格式校验报错
+func splitRangeAddress(text string) ([]string, error) {
+	results := make([]string, 0)
+	for _, v := range strings.Split(text, ",") {
+		v = strings.TrimSpace(v)
+		if !utils.IsIPRange(v) {
+			results = append(results, v)
+			continue
+		}
+		r, e := utils.ParseIPRange(v)
+		if e != nil {
+			results = append(results, v)
+			continue
+		}
+		cidrs, e := r.CIDRs()
+		if e != nil {
+			return nil, e
+		}
+		if len(cidrs) > maxRangeCIDRs {
+			return nil, fmt.Errorf("地址范围<%s>需要拆分为%d个网段, 超过%d个, 请改为按网段填写", v, len(cidrs), maxRangeCIDRs)
+		}
+		results = append(results, cidrs...)
+	}
+	return results, nil
 }
 
 // AddInfo 添加策略信息
@@ -219,7 +262,11 @@ func (h *taskHandler) AddInfo(data *model.TTaskInfo) error {
 	l := zap.L().With(zap.Int("task_id", h.task.Id), zap.String("func", "AddInfo"))
 	l.Info("添加策略信息--->", zap.Any("data", data))
 	l.Info("1. 拆分工作项--->")
-	infos := h.splitInfos(data)
+	infos, e := h.splitInfos(data)
+	if e != nil {
+		l.Error(e.Error())
+		return e
+	}
 	l.Info("2. 校验基本格式--->")
 	if e := h.checkInfoStyle(infos); e != nil {
 		l.Error(e.Error())
@@ -609,6 +656,17 @@ func (h *taskHandler) updateDevicePolicy(deviceInfos *map[int][]model.TTaskInfo)
 	return nil
 }
 
+// 排除直接下发命令的任务项，命令创建时已生成
+func excludeCommandOnly(infos []*model.TTaskInfo) []*model.TTaskInfo {
+	results := make([]*model.TTaskInfo, 0, len(infos))
+	for _, v := range infos {
+		if !v.CommandOnly {
+			results = append(results, v)
+		}
+	}
+	return results
+}
+
 // 将设备ID一致的策略信息组装在一起
 func (h *taskHandler) makeDeviceIdSameInfos(infos []*model.TTaskInfo) map[int][]*model.TTaskInfo {
 	result := make(map[int][]*model.TTaskInfo)
@@ -631,10 +689,29 @@ func (h *taskHandler) sendInfos(deviceInfos map[int][]*model.TTaskInfo) error {
 				h.addLog(e.Error())
 			}
 		}
+		h.checkHaSync(deviceId)
 	}
 	return nil
 }
 
+// 下发后对比HA两台设备的配置，不一致时只告警，不影响工单结果
+func (h *taskHandler) checkHaSync(deviceId int) {
+	dh, e := device2.NewDeviceHandler(deviceId)
+	if e != nil {
+		h.addLog(fmt.Sprintf("检查HA配置同步失败: %s", e.Error()))
+		return
+	}
+	diff, e := dh.CheckHaSync()
+	if e != nil {
+		h.addLog(fmt.Sprintf("检查HA配置同步失败: %s", e.Error()))
+		return
+	}
+	if diff != "" {
+		zap.L().Warn("HA设备配置不一致", zap.Int("device_id", deviceId), zap.String("jira_key", h.task.JiraKey))
+		h.addLog(fmt.Sprintf("警告: %s", diff))
+	}
+}
+
 // 调用F5API推送F5配置
 func (h *taskHandler) sendF5Infos(deviceInfos map[int][]*model.TTaskInfo) error {
 	for deviceId, infos := range deviceInfos {
@@ -790,22 +867,121 @@ func (h *taskHandler) send(deviceId int, infos []*model.TTaskInfo) (result []*ne
 	for _, i := range infos {
 		commands = append(commands, &net_api.Command{Id: int32(i.Id), Cmd: i.Command})
 	}
-	client := net_api2.NewClient(h.region.ApiServer)
-	result, e := client.Config(&net_api.ConfigRequest{
+	account, e := credential.Resolve(&d, credential.PurposeWrite)
+	if e != nil {
+		return nil, e
+	}
+	// HA设备只在主设备上下发
+	host, e := device2.ActiveHost(deviceId)
+	if e != nil {
+		return nil, e
+	}
+	if host != d.Host {
+		h.addLog(fmt.Sprintf("设备<%s>当前HA主设备为%s", d.Name, host))
+	}
+	request := &net_api.ConfigRequest{
 		DeviceType:     deviceType.Name,
-		Host:           d.Host,
-		Username:       d.Username,
-		Password:       d.Password,
-		EnablePassword: d.EnablePassword,
+		Host:           host,
+		Username:       account.Username,
+		Password:       account.Password,
+		EnablePassword: account.EnablePassword,
 		Port:           22,
 		Commands:       commands,
-	})
+	}
+	client := net_api2.NewClient(h.region.ApiServer)
+	if sc := device2.NewSafeCommit(deviceType.Name); sc != nil {
+		return h.safeConfig(client, request, sc, infos)
+	}
+	result, e = client.Config(request)
 	if e != nil {
 		return nil, e
 	}
 	return result, nil
 }
 
+/*
+安全提交:
+ 1. 下发配置并检查，检查失败时清除未提交的配置
+ 2. 检查通过后单独下发带自动回滚的提交，h3c在配置前已开启
+ 3. 重新登录设备，确认提交后管理连接正常
+ 4. 最终提交，未执行最终提交时设备超时后自动回滚
+*/
+func (h *taskHandler) safeConfig(client *net_api2.Client, request *net_api.ConfigRequest, sc *device2.SafeCommit, infos []*model.TTaskInfo) ([]*net_api.Command, error) {
+	h.addLog("下发配置并检查--->")
+	request.Commands = sc.CheckCommands(request.Commands)
+	checks, e := client.Config(request)
+	if e != nil {
+		return nil, e
+	}
+	results, failure := sc.Split(checks)
+	if failure != "" {
+		if sc.Trialed(checks) {
+			return nil, h.failInfos(infos, fmt.Sprintf("配置失败, 设备将在%d分钟后自动回滚: %s", sc.Minutes(), failure))
+		}
+		if !sc.Candidate() {
+			return nil, h.failInfos(infos, fmt.Sprintf("开启自动回滚失败, 配置可能已部分生效, 请登录设备确认: %s", failure))
+		}
+		return nil, h.failInfos(infos, h.revertConfig(client, request, sc, fmt.Sprintf("配置检查失败: %s", failure)))
+	}
+	if trials := sc.TrialCommands(); trials != nil {
+		h.addLog(fmt.Sprintf("检查通过, 提交配置, 未确认时%d分钟后自动回滚--->", sc.Minutes()))
+		request.Commands = trials
+		confirmed, e := client.Config(request)
+		if e != nil {
+			return nil, h.failInfos(infos, fmt.Sprintf("提交结果未知, 如已提交设备将在%d分钟后自动回滚: %s", sc.Minutes(), e.Error()))
+		}
+		if failure := sc.Failure(confirmed); failure != "" {
+			return nil, h.failInfos(infos, h.revertConfig(client, request, sc, fmt.Sprintf("提交失败: %s", failure)))
+		}
+	}
+	h.addLog("确认设备管理连接--->")
+	request.Commands = sc.VerifyCommands()
+	if _, e := client.Show(request); e != nil {
+		return nil, h.failInfos(infos, fmt.Sprintf("提交后无法登录设备, 设备将在%d分钟后自动回滚: %s", sc.Minutes(), e.Error()))
+	}
+	request.Commands = sc.ConfirmCommands()
+	confirms, e := client.Config(request)
+	if e == nil {
+		if failure := sc.Failure(confirms); failure != "" {
+			e = errors.New(failure)
+		}
+	}
+	if e != nil {
+		return nil, h.failInfos(infos, fmt.Sprintf("最终提交失败, 设备将在%d分钟后自动回滚: %s", sc.Minutes(), e.Error()))
+	}
+	h.addLog("最终提交完成--->")
+	return results, nil
+}
+
+// 未提交时清除候选配置，返回包含清除结果的失败信息
+func (h *taskHandler) revertConfig(client *net_api2.Client, request *net_api.ConfigRequest, sc *device2.SafeCommit, message string) string {
+	reverts := sc.RevertCommands()
+	if reverts == nil {
+		return fmt.Sprintf("%s, 配置未提交", message)
+	}
+	request.Commands = reverts
+	results, e := client.Config(request)
+	if e == nil {
+		if failure := sc.Failure(results); failure != "" {
+			e = errors.New(failure)
+		}
+	}
+	if e != nil {
+		return fmt.Sprintf("%s, 清除未提交的配置失败, 请登录设备确认: %s", message, e.Error())
+	}
+	return fmt.Sprintf("%s, 已清除未提交的配置, 配置未生效", message)
+}
+
+// 将工单策略标记为失败，返回失败信息
+func (h *taskHandler) failInfos(infos []*model.TTaskInfo, message string) error {
+	for _, v := range infos {
+		if e := h.updateInfo(v.Id, conf.TaskStatusFailed, message); e != nil {
+			h.addLog(e.Error())
+		}
+	}
+	return errors.New(message)
+}
+
 // 更新策略信息
 func (h *taskHandler) updateInfo(infoId int, status, result string) error {
 	taskInfo := model.TTaskInfo{}
@@ -829,6 +1005,7 @@ func (h *taskHandler) GeneFirewallConfig() error {
 	if e != nil {
 		return e
 	}
+	infos = excludeCommandOnly(infos)
 	infos, e = h.splitInfoList(infos)
 	if e != nil {
 		return e
@@ -913,6 +1090,8 @@ func (h *taskHandler) splitInfoList(infos []*model.TTaskInfo) ([]*model.TTaskInf
 						Dst:                 dst,
 						DPort:               port,
 						Direction:           item.Direction,
+						SrcZone:             item.SrcZone,
+						DstZone:             item.DstZone,
 						StaticIp:            item.StaticIp,
 						StaticPort:          item.StaticPort,
 						OutboundNetworkType: item.OutboundNetworkType,
@@ -1142,6 +1321,10 @@ func (h *taskHandler) geneDenyConfig(denyInfos []*model.TTaskInfo) error {
 		if e != nil {
 			return e
 		}
+		// 语法错误的命令在审批前拦截，避免下发到一半被设备拒绝
+		if e := parser.ValidateCommand(command); e != nil {
+			return fmt.Errorf("工单项<%d>%w", info.Id, e)
+		}
 		info.Command = command
 		info.Status = conf.TaskStatusReady
 		if e := info.Save(); e != nil {
@@ -1279,6 +1462,14 @@ func (h *taskHandler) getInfoDeviceId(data *model.TTaskInfo) (int, error) {
 }
 
 func (h *taskHandler) getDeviceIdByDeviceNets(direction, ip string, deviceNets []*model.TFirewallSubnet) (deviceId int) {
+	if dn := findDeviceNet(direction, ip, deviceNets); dn != nil {
+		deviceId = dn.DeviceId
+	}
+	return
+}
+
+// 获取包含地址的最小网段，入向匹配外网网段，出向匹配内网网段
+func findDeviceNet(direction, ip string, deviceNets []*model.TFirewallSubnet) (result *model.TFirewallSubnet) {
 	minSubnet := ""
 	for _, dn := range deviceNets {
 		var sNet string
@@ -1287,16 +1478,16 @@ func (h *taskHandler) getDeviceIdByDeviceNets(direction, ip string, deviceNets [
 		} else {
 			sNet = dn.InnerSubnet
 		}
-		if result, _ := subnet.IsNet(sNet, ip); result {
+		if ok, _ := subnet.IsNet(sNet, ip); ok {
 			if minSubnet == "" {
 				minSubnet = sNet
-				deviceId = dn.DeviceId
+				result = dn
 				continue
 			}
 			// 最小优先，如果s比最小的还小，则替换
 			if ok, _ := subnet.IsNet(minSubnet, sNet); ok {
 				minSubnet = sNet
-				deviceId = dn.DeviceId
+				result = dn
 			}
 		}
 	}
@@ -78,13 +78,15 @@ func (h *invalidPolicyHandler) Parse() error {
 	}
 	log.Debug("3. 开始解析----------->")
 	if e := h.parse(); e != nil {
-		return e
+		// 解析失败时需要更新状态，否则任务一直处于running，定时采集无法再执行
+		h.error = e
 	}
 	if h.error != nil {
 		log.Debug(fmt.Sprintf("解析失败: <%s>", h.error.Error()))
 		if e := h.updateStatus("failed"); e != nil {
 			return e
 		}
+		return h.error
 	} else {
 		log.Debug("4. 解析成功！")
 		if e := h.updateStatus("success"); e != nil {
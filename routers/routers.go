@@ -19,11 +19,24 @@ import (
 	"netops/api/admin/platform/task_template"
 	"netops/api/auth"
 	"netops/api/device/backup"
+	"netops/api/device/backup_schedule"
+	"netops/api/device/credential"
+	"netops/api/device/facts"
 	"netops/api/device/firewall"
 	"netops/api/device/nlb"
+	"netops/api/device/zone"
+	"netops/api/policy/drift_finding"
 	firewall2 "netops/api/policy/firewall"
+	"netops/api/policy/firewall_analysis"
+	"netops/api/policy/firewall_change"
+	"netops/api/policy/firewall_decommission"
 	"netops/api/policy/firewall_nat"
+	"netops/api/policy/firewall_snapshot"
+	"netops/api/policy/firewall_unused"
 	nlb2 "netops/api/policy/nlb"
+	"netops/api/policy/risk_exception"
+	"netops/api/policy/risk_finding"
+	"netops/api/policy/risk_rule"
 	"netops/api/system/log"
 	"netops/api/system/role"
 	"netops/api/system/user"
@@ -55,6 +68,10 @@ func IncludeRouter() {
 	Include(firewall.Routers)
 	Include(nlb.Routers)
 	Include(backup.Routers)
+	Include(backup_schedule.Routers)
+	Include(zone.Routers)
+	Include(credential.Routers)
+	Include(facts.Routers)
 
 	Include(public_whitelist.Routers)
 	Include(invalid_policy_task.Routers)
@@ -62,6 +79,15 @@ func IncludeRouter() {
 	Include(firewall2.Routers)
 	Include(nlb2.Routers)
 	Include(firewall_nat.Routers)
+	Include(firewall_change.Routers)
+	Include(firewall_snapshot.Routers)
+	Include(firewall_analysis.Routers)
+	Include(firewall_unused.Routers)
+	Include(firewall_decommission.Routers)
+	Include(risk_rule.Routers)
+	Include(risk_finding.Routers)
+	Include(drift_finding.Routers)
+	Include(risk_exception.Routers)
 
 	Include(api.Routers)
 	Include(subnet.Routers)
@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffLine 差异行，OldLine和NewLine为原文件中的行号，从1开始，不存在时为0
+type DiffLine struct {
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line"`
+	NewLine int    `json:"new_line"`
+}
+
+// DiffHunk 差异块，与unified diff的@@ -a,b +c,d @@对应
+type DiffHunk struct {
+	OldStart int         `json:"old_start"`
+	OldLines int         `json:"old_lines"`
+	NewStart int         `json:"new_start"`
+	NewLines int         `json:"new_lines"`
+	Lines    []*DiffLine `json:"lines"`
+}
+
+// TextDiff 文本差异，ignore中匹配的行不参与对比
+type TextDiff struct {
+	Lines  []*DiffLine
+	ignore func(line string) bool
+}
+
+func NewTextDiff(ignore func(line string) bool) *TextDiff {
+	return &TextDiff{ignore: ignore}
+}
+
+// Diff 按行对比两个文本
+func (d *TextDiff) Diff(oldText, newText string) []*DiffLine {
+	oldLines, oldNums := d.splitLines(oldText)
+	newLines, newNums := d.splitLines(newText)
+	d.Lines = make([]*DiffLine, 0)
+	for _, op := range myersDiff(oldLines, newLines) {
+		line := &DiffLine{Type: op.typ}
+		switch op.typ {
+		case DiffEqual:
+			line.Text = newLines[op.newIndex]
+			line.OldLine = oldNums[op.oldIndex]
+			line.NewLine = newNums[op.newIndex]
+		case DiffDelete:
+			line.Text = oldLines[op.oldIndex]
+			line.OldLine = oldNums[op.oldIndex]
+		case DiffInsert:
+			line.Text = newLines[op.newIndex]
+			line.NewLine = newNums[op.newIndex]
+		}
+		d.Lines = append(d.Lines, line)
+	}
+	return d.Lines
+}
+
+// 拆分文本，返回参与对比的行和对应的原始行号
+func (d *TextDiff) splitLines(text string) ([]string, []int) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := make([]string, 0)
+	nums := make([]int, 0)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if d.ignore != nil && d.ignore(line) {
+			continue
+		}
+		lines = append(lines, line)
+		nums = append(nums, i+1)
+	}
+	return lines, nums
+}
+
+// Hunks 根据差异行生成差异块，context为差异前后保留的相同行数
+func (d *TextDiff) Hunks(context int) []*DiffHunk {
+	results := make([]*DiffHunk, 0)
+	start, end := -1, -1
+	for i, line := range d.Lines {
+		if line.Type == DiffEqual {
+			continue
+		}
+		s, e := i-context, i+context
+		if s < 0 {
+			s = 0
+		}
+		if e > len(d.Lines)-1 {
+			e = len(d.Lines) - 1
+		}
+		// 与上一个差异块的上下文相连则合并
+		if start >= 0 && s <= end+1 {
+			end = e
+			continue
+		}
+		if start >= 0 {
+			results = append(results, newDiffHunk(d.Lines[start:end+1]))
+		}
+		start, end = s, e
+	}
+	if start >= 0 {
+		results = append(results, newDiffHunk(d.Lines[start:end+1]))
+	}
+	return results
+}
+
+func newDiffHunk(lines []*DiffLine) *DiffHunk {
+	h := &DiffHunk{Lines: lines}
+	h.count()
+	return h
+}
+
+func (h *DiffHunk) count() {
+	for _, l := range h.Lines {
+		if l.Type != DiffInsert {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldLine
+			}
+			h.OldLines++
+		}
+		if l.Type != DiffDelete {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewLine
+			}
+			h.NewLines++
+		}
+	}
+}
+
+// Unified 生成unified diff格式的文本
+func (d *TextDiff) Unified(oldName, newName string, context int) string {
+	hunks := d.Hunks(context)
+	if len(hunks) == 0 {
+		return ""
+	}
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+	for _, h := range hunks {
+		builder.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines))
+		for _, l := range h.Lines {
+			switch l.Type {
+			case DiffEqual:
+				builder.WriteString(" ")
+			case DiffDelete:
+				builder.WriteString("-")
+			case DiffInsert:
+				builder.WriteString("+")
+			}
+			builder.WriteString(l.Text)
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
+
+type diffOp struct {
+	typ      string
+	oldIndex int
+	newIndex int
+}
+
+// myers差分算法，先去掉相同的前缀和后缀，减少计算量
+func myersDiff(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	results := make([]diffOp, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		results = append(results, diffOp{DiffEqual, i, i})
+	}
+	results = append(results, myersMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix)...)
+	for i := 0; i < suffix; i++ {
+		results = append(results, diffOp{DiffEqual, len(a) - suffix + i, len(b) - suffix + i})
+	}
+	return results
+}
+
+// 差异过大时不再计算最短路径，直接视为全部删除后新增，避免占用过多内存
+const myersMaxEdit = 2000
+
+func myersMiddle(a, b []string, offset int) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	results := make([]diffOp, 0)
+	if max == 0 {
+		return results
+	}
+	limit := max
+	if limit > myersMaxEdit {
+		limit = myersMaxEdit
+	}
+	v := make([]int, 2*max+1)
+	// trace[d]保存第d轮开始前k在[-d-1, d+1]范围内的v
+	trace := make([][]int, 0)
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		lo, hi := max-d-1, max+d+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > 2*max {
+			hi = 2 * max
+		}
+		snapshot := make([]int, hi-lo+1)
+		copy(snapshot, v[lo:hi+1])
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		for i := range a {
+			results = append(results, diffOp{DiffDelete, i + offset, offset})
+		}
+		for j := range b {
+			results = append(results, diffOp{DiffInsert, n + offset, j + offset})
+		}
+		return results
+	}
+	// 回溯生成编辑路径
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		lo := max - d - 1
+		if lo < 0 {
+			lo = 0
+		}
+		get := func(k int) int {
+			return snapshot[max+k-lo]
+		}
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			results = append(results, diffOp{DiffEqual, x + offset, y + offset})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				results = append(results, diffOp{DiffInsert, x + offset, y + offset})
+			} else {
+				x--
+				results = append(results, diffOp{DiffDelete, x + offset, y + offset})
+			}
+		}
+	}
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+	}
+	return results
+}
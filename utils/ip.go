@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"netops/conf"
 	"strconv"
 	"strings"
@@ -150,3 +151,90 @@ func ipv4Mask(subnet string) (ip, mask string) {
 	ip = n.IP.String()
 	return
 }
+
+// IPRange 地址范围，支持ipv4和ipv6，如 10.0.0.5-10.0.3.20
+type IPRange struct {
+	Start netip.Addr
+	End   netip.Addr
+}
+
+// IsIPRange 是否是地址范围格式
+func IsIPRange(text string) bool {
+	return strings.Count(text, "-") == 1 && !strings.Contains(text, "/")
+}
+
+// ParseIPRange 解析 start-end 格式的地址范围
+func ParseIPRange(text string) (IPRange, error) {
+	items := strings.Split(text, "-")
+	if len(items) != 2 {
+		return IPRange{}, fmt.Errorf("地址范围<%s>格式不正确", text)
+	}
+	return NewIPRange(items[0], items[1])
+}
+
+// NewIPRange 根据起止地址创建地址范围，地址可以带掩码，带掩码时只取地址部分
+func NewIPRange(start, end string) (IPRange, error) {
+	s, e1 := netip.ParseAddr(strings.Split(strings.TrimSpace(start), "/")[0])
+	e, e2 := netip.ParseAddr(strings.Split(strings.TrimSpace(end), "/")[0])
+	if e1 != nil || e2 != nil {
+		return IPRange{}, fmt.Errorf("地址范围<%s-%s>格式不正确", start, end)
+	}
+	if s.Zone() != "" || e.Zone() != "" {
+		return IPRange{}, fmt.Errorf("地址范围<%s-%s>不支持带区域的ipv6地址", start, end)
+	}
+	s, e = s.Unmap(), e.Unmap()
+	if s.Is4() != e.Is4() {
+		return IPRange{}, fmt.Errorf("地址范围<%s-%s>起止地址类型不一致", start, end)
+	}
+	if e.Less(s) {
+		return IPRange{}, fmt.Errorf("地址范围<%s-%s>起始地址大于结束地址", start, end)
+	}
+	return IPRange{Start: s, End: e}, nil
+}
+
+func (r IPRange) String() string {
+	return fmt.Sprintf("%s-%s", r.Start, r.End)
+}
+
+// CIDRs 将地址范围拆分为最少的网段
+func (r IPRange) CIDRs() ([]string, error) {
+	if !r.Start.IsValid() || !r.End.IsValid() {
+		return nil, fmt.Errorf("地址范围<%s>格式不正确", r)
+	}
+	results := make([]string, 0)
+	start := r.Start
+	for {
+		// 从最大的网段开始找，网段起始地址必须是start，并且不能超出结束地址
+		var prefix netip.Prefix
+		for bits := 0; bits <= start.BitLen(); bits++ {
+			p, e := start.Prefix(bits)
+			if e != nil {
+				return nil, fmt.Errorf("地址范围<%s>拆分网段失败, err: %w", r, e)
+			}
+			if p.Addr() == start && !r.End.Less(lastAddr(p)) {
+				prefix = p
+				break
+			}
+		}
+		if !prefix.IsValid() {
+			return nil, fmt.Errorf("地址范围<%s>拆分网段失败, 起止地址类型不一致", r)
+		}
+		results = append(results, prefix.String())
+		last := lastAddr(prefix)
+		if last == r.End {
+			break
+		}
+		start = last.Next()
+	}
+	return results, nil
+}
+
+// 网段的最后一个地址
+func lastAddr(p netip.Prefix) netip.Addr {
+	bs := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(bs)*8; i++ {
+		bs[i/8] |= 0x80 >> (i % 8)
+	}
+	result, _ := netip.AddrFromSlice(bs)
+	return result
+}
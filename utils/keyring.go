@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"fmt"
+	"netops/conf"
+)
+
+// 未配置密钥版本时使用aes_key，兼容历史数据
+const defaultKeyVersion = "0"
+
+// CredentialKey 根据版本获取凭据加密密钥
+func CredentialKey(version string) (string, error) {
+	keys := conf.Config.Credential.Keys
+	if version == "" {
+		version = defaultKeyVersion
+	}
+	if key, ok := keys[version]; ok {
+		return key, nil
+	}
+	if version == defaultKeyVersion {
+		return conf.Config.AesKey, nil
+	}
+	return "", fmt.Errorf("凭据密钥版本<%s>不存在", version)
+}
+
+// ActiveKeyVersion 当前用于加密的密钥版本
+func ActiveKeyVersion() string {
+	if conf.Config.Credential.Active != "" {
+		return conf.Config.Credential.Active
+	}
+	return defaultKeyVersion
+}
+
+// EncryptCredential 使用当前密钥版本加密，返回密文和密钥版本
+func EncryptCredential(text string) (string, string, error) {
+	version := ActiveKeyVersion()
+	key, e := CredentialKey(version)
+	if e != nil {
+		return "", "", e
+	}
+	result, e := AesEncrypt(text, key)
+	if e != nil {
+		return "", "", fmt.Errorf("加密凭据失败, key_version: %s, err: %w", version, e)
+	}
+	return result, version, nil
+}
+
+// DecryptCredential 使用加密时的密钥版本解密
+func DecryptCredential(text, version string) (string, error) {
+	key, e := CredentialKey(version)
+	if e != nil {
+		return "", e
+	}
+	result, e := AesDecrypt(text, key)
+	if e != nil {
+		return "", fmt.Errorf("解密凭据失败, key_version: %s, err: %w", version, e)
+	}
+	return result, nil
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/minio/minio-go"
 	"io/ioutil"
@@ -12,6 +13,7 @@ type Minio struct {
 	AccessKey string
 	SecretKey string
 	Secure    bool
+	Region    string
 	client    *minio.Client
 	error     error
 }
@@ -31,8 +33,21 @@ func NewMinio(endpoint, accessKey, secretKey string, secure bool) *Minio {
 	return m
 }
 
+// NewMinioWithRegion 连接兼容s3协议的存储，如aws s3、oss等
+func NewMinioWithRegion(endpoint, accessKey, secretKey, region string, secure bool) *Minio {
+	m := &Minio{
+		Endpoint:  endpoint,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Secure:    secure,
+		Region:    region,
+	}
+	m.Connect()
+	return m
+}
+
 func (m *Minio) Connect() {
-	client, err := minio.New(m.Endpoint, m.AccessKey, m.SecretKey, m.Secure)
+	client, err := minio.NewWithRegion(m.Endpoint, m.AccessKey, m.SecretKey, m.Secure, m.Region)
 	if err != nil {
 		m.error = fmt.Errorf("连接minio服务器:<%s>异常:  <%s>", m.SecretKey, err.Error())
 	}
@@ -61,6 +76,34 @@ func (m *Minio) UploadFile(bucket, filename, filePath string) error {
 	return nil
 }
 
+// 校验bucket是否存在，不存在则创建
+func (m *Minio) makeBucket(bucket string) error {
+	result, err := m.client.BucketExists(bucket)
+	if err != nil {
+		return fmt.Errorf("校验bucket<%s>是否存在异常: <%s>", bucket, err.Error())
+	}
+	if !result {
+		if err := m.client.MakeBucket(bucket, m.Region); err != nil {
+			return fmt.Errorf("创建bucket<%s>发生异常: <%s>", bucket, err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *Minio) UploadBytes(bucket, filename string, body []byte) error {
+	if m.error != nil {
+		return m.error
+	}
+	if err := m.makeBucket(bucket); err != nil {
+		return err
+	}
+	opts := minio.PutObjectOptions{ContentType: "application/octet-stream"}
+	if _, err := m.client.PutObject(bucket, filename, bytes.NewReader(body), int64(len(body)), opts); err != nil {
+		return fmt.Errorf("文件:<%s>上传到minio发生异常: <%s>", filename, err.Error())
+	}
+	return nil
+}
+
 func (m *Minio) DownloadFile(bucket, filename, filePath, md5Str string) error {
 	if m.error != nil {
 		return m.error
@@ -92,3 +135,13 @@ func (m *Minio) GetFile(bucket, filename string) ([]byte, error) {
 	}
 	return b, nil
 }
+
+func (m *Minio) RemoveFile(bucket, filename string) error {
+	if m.error != nil {
+		return m.error
+	}
+	if err := m.client.RemoveObject(bucket, filename); err != nil {
+		return fmt.Errorf("从minio删除文件<%s>发生异常: <%s>", filename, err.Error())
+	}
+	return nil
+}